@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/viper"
+	"regexp"
+	"strings"
+)
+
+// adfNode is a node of an Atlassian Document Format document, the rich text
+// format used by version 3 of the Jira Cloud API.
+type adfNode struct {
+	Type    string                 `json:"type"`
+	Version int                    `json:"version,omitempty"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Content []adfNode              `json:"content,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Marks   []adfMark              `json:"marks,omitempty"`
+}
+
+type adfMark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// adfLinkPattern matches Markdown links and bare URLs.
+var adfLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)|https?://[^\s<>()]+`)
+
+// jiraAPIVersion returns jira.apiVersion, 2 for wiki markup or 3 for ADF.
+func jiraAPIVersion() int {
+
+	return viper.GetInt("jira.apiVersion")
+}
+
+// validateJiraAPIVersion checks jira.apiVersion.
+func validateJiraAPIVersion() error {
+
+	if version := jiraAPIVersion(); version != 2 && version != 3 {
+		return fmt.Errorf("unsupported jira.apiVersion %d, expected 2 or 3", version)
+	}
+
+	return nil
+}
+
+// adfDocument builds an ADF document from plain text or Markdown. Blank lines
+// separate paragraphs, lines starting with # are headings, fenced blocks are
+// code blocks, and links and bare URLs become links.
+func adfDocument(text string) adfNode {
+
+	doc := adfNode{Type: "doc", Version: 1, Content: []adfNode{}}
+
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			doc.Content = append(doc.Content, adfParagraph(paragraph))
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			code := []string{}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			block := adfNode{Type: "codeBlock"}
+			if lang := strings.TrimPrefix(trimmed, "```"); lang != "" {
+				block.Attrs = map[string]interface{}{"language": lang}
+			}
+			if len(code) > 0 {
+				block.Content = []adfNode{{Type: "text", Text: strings.Join(code, "\n")}}
+			}
+			doc.Content = append(doc.Content, block)
+
+		case mdHeading.MatchString(line):
+			flush()
+			match := mdHeading.FindStringSubmatch(line)
+			doc.Content = append(doc.Content, adfNode{
+				Type:    "heading",
+				Attrs:   map[string]interface{}{"level": len(match[1])},
+				Content: adfInline(match[2]),
+			})
+
+		case trimmed == "":
+			flush()
+
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	flush()
+
+	return doc
+}
+
+// adfParagraph joins lines into a paragraph, keeping the line breaks.
+func adfParagraph(lines []string) adfNode {
+
+	paragraph := adfNode{Type: "paragraph"}
+	for i, line := range lines {
+		if i > 0 {
+			paragraph.Content = append(paragraph.Content, adfNode{Type: "hardBreak"})
+		}
+		paragraph.Content = append(paragraph.Content, adfInline(line)...)
+	}
+
+	return paragraph
+}
+
+// adfInline splits a line into text nodes, with link marks on links.
+func adfInline(line string) []adfNode {
+
+	nodes := []adfNode{}
+
+	last := 0
+	for _, match := range adfLinkPattern.FindAllStringSubmatchIndex(line, -1) {
+		if match[0] > last {
+			nodes = append(nodes, adfNode{Type: "text", Text: line[last:match[0]]})
+		}
+
+		label, href := line[match[0]:match[1]], line[match[0]:match[1]]
+		if match[2] >= 0 {
+			label, href = line[match[2]:match[3]], line[match[4]:match[5]]
+		}
+		nodes = append(nodes, adfNode{
+			Type:  "text",
+			Text:  label,
+			Marks: []adfMark{{Type: "link", Attrs: map[string]interface{}{"href": href}}},
+		})
+
+		last = match[1]
+	}
+
+	if last < len(line) {
+		nodes = append(nodes, adfNode{Type: "text", Text: line[last:]})
+	}
+
+	return nodes
+}
+
+// createIssueV3 creates an issue through the v3 API, which go-jira doesn't
+// cover, with the description as an ADF document.
+func createIssueV3(jiraClient *jira.Client, jiraIssue *jira.Issue, description string) (*jira.Issue, error) {
+
+	jiraIssue.Fields.Description = ""
+	if description != "" {
+		setCustomField(jiraIssue.Fields, "description", adfDocument(description))
+	}
+
+	req, err := jiraClient.NewRequest("POST", "rest/api/3/issue", jiraIssue)
+	if err != nil {
+		return nil, err
+	}
+
+	created := new(jira.Issue)
+	resp, err := jiraClient.Do(req, created)
+	if err != nil {
+		return nil, jira.NewJiraError(resp, err)
+	}
+
+	return created, nil
+}
+
+// updateDescriptionV3 replaces the description of an issue with an ADF
+// document built from description.
+func updateDescriptionV3(jiraClient *jira.Client, key string, description string) error {
+
+	data := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"description": adfDocument(description),
+		},
+	}
+
+	req, err := jiraClient.NewRequest("PUT", "rest/api/3/issue/"+key, data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := jiraClient.Do(req, nil)
+	if err != nil {
+		return jira.NewJiraError(resp, err)
+	}
+
+	return nil
+}
+
+// addCommentV3 comments on an issue with an ADF document built from body.
+func addCommentV3(jiraClient *jira.Client, key string, body string) error {
+
+	req, err := jiraClient.NewRequest("POST", "rest/api/3/issue/"+key+"/comment", map[string]interface{}{
+		"body": adfDocument(body),
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := jiraClient.Do(req, nil)
+	if err != nil {
+		return jira.NewJiraError(resp, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestADFDocument(t *testing.T) {
+
+	text := func(value string) adfNode {
+		return adfNode{Type: "text", Text: value}
+	}
+	link := func(label string, href string) adfNode {
+		return adfNode{Type: "text", Text: label, Marks: []adfMark{{Type: "link", Attrs: map[string]interface{}{"href": href}}}}
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		content []adfNode
+	}{
+		{
+			name:    "empty",
+			text:    "",
+			content: []adfNode{},
+		},
+		{
+			name: "paragraphs and line breaks",
+			text: "one\ntwo\n\nthree",
+			content: []adfNode{
+				{Type: "paragraph", Content: []adfNode{text("one"), {Type: "hardBreak"}, text("two")}},
+				{Type: "paragraph", Content: []adfNode{text("three")}},
+			},
+		},
+		{
+			name: "heading",
+			text: "## Next steps",
+			content: []adfNode{
+				{Type: "heading", Attrs: map[string]interface{}{"level": 2}, Content: []adfNode{text("Next steps")}},
+			},
+		},
+		{
+			name: "links",
+			text: "see [the guide](https://example.com/guide) or https://example.com/faq",
+			content: []adfNode{
+				{Type: "paragraph", Content: []adfNode{
+					text("see "),
+					link("the guide", "https://example.com/guide"),
+					text(" or "),
+					link("https://example.com/faq", "https://example.com/faq"),
+				}},
+			},
+		},
+		{
+			name: "code block",
+			text: "before\n```sh\nmake all\nmake test\n```\nafter",
+			content: []adfNode{
+				{Type: "paragraph", Content: []adfNode{text("before")}},
+				{Type: "codeBlock", Attrs: map[string]interface{}{"language": "sh"}, Content: []adfNode{text("make all\nmake test")}},
+				{Type: "paragraph", Content: []adfNode{text("after")}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			//Compared as JSON, the form sent to Jira
+			got, _ := json.Marshal(adfDocument(test.text))
+			want, _ := json.Marshal(adfNode{Type: "doc", Version: 1, Content: test.content})
+			if string(got) != string(want) {
+				t.Errorf("adfDocument(%q) =\n%s\nwant\n%s", test.text, got, want)
+			}
+		})
+	}
+}
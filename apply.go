@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/notify"
+	"imp/pkg/run"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var applyFlags struct {
+	concurrency int
+	yes         bool
+	reportFile  string
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply plan.json",
+	Args:  cobra.ExactArgs(1),
+	Short: "File exactly the tickets of a plan written by imp plan",
+	Long: `Create the tickets and send the notifications of a plan written by imp plan,
+as they were rendered when the plan was made. Tickets the ledger shows were
+already filed are skipped, so an interrupted apply can be run again.`,
+	RunE: runApply,
+}
+
+func init() {
+
+	flags := applyCmd.Flags()
+	flags.IntVarP(&applyFlags.concurrency, "concurrency", "c", 1, "number of tickets to file in parallel")
+	flags.BoolVarP(&applyFlags.yes, "yes", "y", false, "file the tickets without asking for confirmation")
+	flags.StringVar(&applyFlags.reportFile, "report-out", "", "write a csv or json report of the run to this file")
+
+	rootCmd.AddCommand(applyCmd)
+}
+
+// applier files the tickets of a plan with the clients of a creator.
+type applier struct {
+	*creator
+	tickets map[string]plannedTicket
+}
+
+func runApply(cmd *cobra.Command, args []string) error {
+
+	p, err := readPlan(args[0])
+	if err != nil {
+		return err
+	}
+
+	//A plan holds project keys and users of the tracker it was made against
+	baseURL := viper.GetString(trackerKind() + ".baseurl")
+	if p.Tracker != trackerKind() || strings.TrimRight(p.BaseURL, "/") != strings.TrimRight(baseURL, "/") {
+		return configError(fmt.Errorf("plan was made for %s at %s, not %s at %s", p.Tracker, p.BaseURL, trackerKind(), baseURL))
+	}
+
+	if _, err := runReportFormat(applyFlags.reportFile); err != nil {
+		return configError(err)
+	}
+
+	c, err := newApplyCreator(applyFlags.concurrency)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	a := &applier{creator: c, tickets: make(map[string]plannedTicket)}
+	rows := []run.Row{}
+	for _, ticket := range p.Tickets {
+		a.tickets[ticket.Row.Repository] = ticket
+		rows = append(rows, ticket.Row)
+	}
+
+	if !applyFlags.yes {
+		printPlan(p)
+
+		ok, err := confirm("File these tickets?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	if approvalRequired(len(rows)) {
+		var preview strings.Builder
+		writePlanPreview(&preview, p)
+		if err := awaitApproval(cmd.Context(), c.api, fmt.Sprintf("apply the plan %s", args[0]), preview.String()); err != nil {
+			return err
+		}
+	}
+
+	//Ctrl-C from here on stops the run after the tickets in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	slog.Info("Applying plan", "run", c.runID, "plan", args[0], "planned", p.CreatedAt.Format(time.RFC3339))
+
+	progress := newProgress(len(rows), viper.GetBool("progress.bar"))
+	record := func(result run.Result) {
+		c.record(result)
+		progress.Add(result)
+	}
+	runner := &run.Runner{Processor: a, Concurrency: c.concurrency, OnResult: record}
+	results := runner.Run(ctx, rows)
+	progress.Finish()
+
+	printRunSummary(results)
+
+	if applyFlags.reportFile != "" {
+		if err := writeRunReport(results, applyFlags.reportFile); err != nil {
+			return err
+		}
+	}
+
+	format, _ := runReportFormat(applyFlags.reportFile)
+	c.share(results, format)
+
+	failures := printFailures(results)
+
+	if ctx.Err() != nil {
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted, run imp apply %s again to file the rest of the plan", args[0]))
+	}
+
+	if failures > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d tickets failed", failures, len(results)))
+	}
+
+	return nil
+}
+
+// newApplyCreator sets up the tracker, notifiers and ledger of a creator
+// without the templates and catalog a plan has already been rendered with.
+func newApplyCreator(concurrency int) (*creator, error) {
+
+	api := newSlackClient()
+	if notifierEnabled("slack") && !slackWebhookMode() {
+		slackChannelNames = newChannelNames(api)
+	}
+
+	tr, err := newTracker()
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	c := &creator{
+		api:          api,
+		tracker:      tr,
+		concurrency:  concurrency,
+		trackerLimit: newRateLimiter(viper.GetFloat64(trackerKind() + ".requestsPerSecond")),
+		slackLimit:   newRateLimiter(viper.GetFloat64("slack.requestsPerSecond")),
+		slackUsers:   newSlackUsers(api),
+		slackGroups:  newSlackUsergroups(api),
+		runID:        newRunID(),
+		startedAt:    time.Now(),
+	}
+
+	c.notifiers, err = newNotifiers(api, c.slackLimit, c.slackUsers)
+	if err != nil {
+		c.Close()
+		return nil, configError(err)
+	}
+
+	c.ledger, err = openRunLedger()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Process files the planned ticket of a repository and sends its
+// notification, recording both in the ledger as imp create does.
+func (a *applier) Process(row run.Row) run.Result {
+
+	ticket := a.tickets[row.Repository]
+	result := run.Result{Repository: row.Repository, Service: ticket.Service.ServiceId, Channel: ticket.Channel, JiraKey: ticket.Key}
+
+	entry, err := a.ledger.Get(row.Repository)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	if ticket.Action == "update" {
+		a.trackerLimit.Wait()
+		if err := a.tracker.UpdateDescription(ticket.Key, ticket.Issue.Description); err != nil {
+			return failed(result, err)
+		}
+		if ticket.Comment {
+			a.trackerLimit.Wait()
+			if err := a.tracker.Comment(ticket.Key, fmt.Sprintf("Description updated by imp run %s.", a.runID)); err != nil {
+				return failed(result, err)
+			}
+		}
+		slog.Info("Updated existing ticket", "ticket", ticket.Key, "repository", row.Repository)
+		result.Status = run.StatusUpdated
+		return result
+	}
+
+	//Applying a plan again files each ticket and notification once
+	if entry != nil && entry.SlackTs != "" && len(entry.PendingNotifiers) == 0 {
+		slog.Info("Skipping repository already processed", "repository", row.Repository, "run", entry.RunID, "ticket", entry.JiraKey)
+		result.JiraKey = entry.JiraKey
+		result.Status = run.StatusSkipped
+		return result
+	}
+
+	switch {
+	case entry != nil:
+		result.JiraKey = entry.JiraKey
+	case ticket.Action == "create":
+		a.trackerLimit.Wait()
+		key, err := a.tracker.CreateIssue(ticket.Issue)
+		if err != nil {
+			return failed(result, err)
+		}
+		slog.Info("Created ticket", "ticket", key, "repository", row.Repository)
+		ticketsCreated.Inc()
+		result.JiraKey = key
+
+		//Record the ticket straight away so a crash before the notification
+		//does not lead to a second ticket when the plan is applied again
+		created := LedgerEntry{
+			RunID:        a.runID,
+			Repository:   row.Repository,
+			Service:      ticket.Service.ServiceId,
+			JiraKey:      key,
+			SlackChannel: ticket.Channel,
+			CreatedAt:    time.Now(),
+		}
+		if err := a.ledger.Record(created); err != nil {
+			return failed(result, err)
+		}
+	case ticket.Action != "notify":
+		return failed(result, fmt.Errorf("unknown plan action %q", ticket.Action))
+	}
+
+	n, err := ticket.notification(a.runID, result.JiraKey)
+	if err != nil {
+		return failed(result, err)
+	}
+	if err := a.deliver(n, entry); err != nil {
+		return failed(result, err)
+	}
+
+	result.Status = run.StatusCreated
+	return result
+}
+
+// notification builds the notification of a planned ticket once its key is
+// known, filling it in where the plan has placeholders.
+func (t plannedTicket) notification(runID string, key string) (notify.Notification, error) {
+
+	replacer := strings.NewReplacer(planKeyPlaceholder, key, planURLPlaceholder, issueURL(key))
+	text := replacer.Replace(t.Message)
+
+	data := templateData(t.Row, t.Service)
+	data["jira_ticket"] = key
+	data["jira_url"] = issueURL(key)
+	data["mentions"] = t.Mentions
+	data["usergroup"] = t.Usergroup
+	data["message"] = text
+
+	var blocks []slack.Block
+	if t.Blocks != "" {
+		var set slack.Blocks
+		if err := json.Unmarshal([]byte(replacer.Replace(t.Blocks)), &set); err != nil {
+			return notify.Notification{}, fmt.Errorf("invalid block kit json in the plan: %w", err)
+		}
+		blocks = set.BlockSet
+	}
+
+	return notify.Notification{
+		RunID:      runID,
+		Service:    t.Service,
+		Repository: t.Row.Repository,
+		Channel:    t.Channel,
+		Text:       text,
+		Blocks:     blocks,
+		Data:       data,
+	}, nil
+}
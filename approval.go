@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Identifiers of the approval buttons handled by imp listen. The decision is
+// written into the message as a context block whose ID says which it was,
+// which is what the waiting run looks for.
+const (
+	approvalBlockID  = "imp_approval"
+	approveActionID  = "imp_approve"
+	rejectActionID   = "imp_reject"
+	approvedBlockID  = "imp_approval_approved"
+	rejectedBlockID  = "imp_approval_rejected"
+	approvalMaxChars = 2800
+)
+
+// approvalRequired reports whether a batch of the given size has to be
+// approved on Slack first: approval.channel is set and the batch has at
+// least approval.minRepositories rows.
+func approvalRequired(size int) bool {
+
+	return viper.GetString("approval.channel") != "" && size >= viper.GetInt("approval.minRepositories")
+}
+
+// approve waits for the sign-off on Slack that approval.channel asks for
+// before large batches, whichever command or daemon runs them, so nothing is
+// written before it.
+func (c *creator) approve(ctx context.Context) error {
+
+	if c.dryRun || !approvalRequired(len(c.rows)) {
+		return nil
+	}
+
+	var preview strings.Builder
+	writePreview(&preview, c.rows, c.repoLookup)
+
+	return awaitApproval(ctx, c.api, fmt.Sprintf("create tickets for %d repositories", len(c.rows)), preview.String())
+}
+
+// awaitApproval posts the preview of a batch to approval.channel with Approve
+// and Reject buttons and waits until one of approval.approvers clicks one.
+// The clicks are handled by imp listen, which writes the decision into the
+// message; this reads the message again every approval.pollInterval until
+// it finds one, or approval.timeout passes.
+func awaitApproval(parent context.Context, api *slack.Client, summary string, preview string) error {
+
+	if len(viper.GetStringSlice("approval.approvers")) == 0 {
+		return configError(fmt.Errorf("approval.channel is set but approval.approvers is empty, nobody could approve the run"))
+	}
+	if viper.GetString("slack.token") == "" {
+		return configError(fmt.Errorf("approvals need slack.token to post the request and read the decision"))
+	}
+
+	if utf8.RuneCountInString(preview) > approvalMaxChars {
+		preview = string([]rune(preview)[:approvalMaxChars]) + "\n…"
+	}
+	requester := firstNonEmpty(os.Getenv("USER"), "someone")
+	if host, err := os.Hostname(); err == nil {
+		requester += "@" + host
+	}
+
+	text := fmt.Sprintf("*%s* asks to %s", requester, summary)
+	approve := slack.NewButtonBlockElement(approveActionID, summary, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	reject := slack.NewButtonBlockElement(rejectActionID, summary, slack.NewTextBlockObject(slack.PlainTextType, "Reject", false, false))
+	reject.Style = slack.StyleDanger
+
+	channel, ts, err := api.PostMessage(viper.GetString("approval.channel"),
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "```"+preview+"```", false, false), nil, nil),
+			slack.NewActionBlock(approvalBlockID, approve, reject),
+		),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to post the approval request: %w", err)
+	}
+	slog.Info("Waiting for approval on Slack", "channel", viper.GetString("approval.channel"), "message", ts)
+
+	//Ctrl-C while waiting gives up on the run
+	ctx, stop := interruptible(parent)
+	defer stop()
+	if timeout := viper.GetDuration("approval.timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(viper.GetDuration("approval.pollInterval"))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if parent.Err() == nil && ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("no approval within %s", viper.GetDuration("approval.timeout"))
+			}
+			return fmt.Errorf("aborted while waiting for approval")
+		case <-ticker.C:
+		}
+
+		history, err := api.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+			ChannelID: channel,
+			Latest:    ts,
+			Oldest:    ts,
+			Inclusive: true,
+			Limit:     1,
+		})
+		if err != nil {
+			slog.Warn("Unable to read the approval request", "error", err)
+			continue
+		}
+
+		for _, msg := range history.Messages {
+			for _, block := range msg.Blocks.BlockSet {
+				decision, ok := block.(*slack.ContextBlock)
+				if !ok {
+					continue
+				}
+				switch decision.BlockID {
+				case approvedBlockID:
+					slog.Info("Approved on Slack", "message", ts)
+					return nil
+				case rejectedBlockID:
+					return fmt.Errorf("rejected on Slack")
+				}
+			}
+		}
+	}
+}
+
+// mayApprove reports whether a Slack user is one of approval.approvers, given
+// by Slack user ID or email.
+func mayApprove(api *slack.Client, userID string) (bool, error) {
+
+	approvers := viper.GetStringSlice("approval.approvers")
+	for _, approver := range approvers {
+		if approver == userID {
+			return true, nil
+		}
+	}
+
+	user, err := api.GetUserInfo(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, approver := range approvers {
+		if user.Profile.Email != "" && strings.EqualFold(approver, user.Profile.Email) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// decide records an approver's click on an approval request by replacing the
+// buttons with the decision, which the waiting run picks up.
+func (l *listener) decide(callback slack.InteractionCallback, action *slack.BlockAction) error {
+
+	ok, err := mayApprove(l.api, callback.User.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		_, err := l.api.PostEphemeral(callback.Channel.ID, callback.User.ID, slack.MsgOptionText("Only approval.approvers can approve or reject imp runs.", false))
+		return err
+	}
+
+	blockID, note := approvedBlockID, ":white_check_mark: Approved by <@%s> on %s"
+	if action.ActionID == rejectActionID {
+		blockID, note = rejectedBlockID, ":no_entry: Rejected by <@%s> on %s"
+	}
+
+	blocks := []slack.Block{}
+	for _, block := range callback.Message.Blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.ActionBlock:
+			if b.BlockID == approvalBlockID {
+				continue
+			}
+		case *slack.ContextBlock:
+			//The first decision stands
+			if b.BlockID == approvedBlockID || b.BlockID == rejectedBlockID {
+				return nil
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	note = fmt.Sprintf(note, callback.User.ID, time.Now().Format("2006-01-02 15:04"))
+	blocks = append(blocks, slack.NewContextBlock(blockID, slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+
+	_, _, _, err = l.api.UpdateMessage(callback.Channel.ID, callback.Message.Timestamp,
+		slack.MsgOptionText(callback.Message.Text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update the approval request: %w", err)
+	}
+	slog.Info("Approval request decided", "request", action.Value, "decision", action.ActionID, "user", callback.User.Name)
+
+	return nil
+}
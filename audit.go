@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditedAPIs are the APIs whose writes go to the audit log: the trackers and
+// everything that posts a notification.
+var auditedAPIs = map[string]bool{"jira": true, "slack": true, "github": true, "gitlab": true, "teams": true, "webhook": true}
+
+// auditRequestIDHeaders are the response headers the APIs return their
+// request ID in, for matching an entry with the API's own logs.
+var auditRequestIDHeaders = []string{"X-Arequestid", "X-Slack-Req-Id", "X-Github-Request-Id", "X-Request-Id"}
+
+// auditResultFields are the fields of a response that say what was written,
+// e.g. the key of a Jira ticket or the ts of a Slack message.
+var auditResultFields = []string{"key", "id", "number", "iid", "ts", "channel", "html_url", "web_url", "error"}
+
+// auditMaxBody is the largest response read for its result fields.
+const auditMaxBody = 1 << 20
+
+// auditTrail is the audit log of the process, nil unless audit.path is set.
+var auditTrail *auditLog
+
+// auditLog appends an entry per write to an external system to a JSON lines
+// file, with who made it and under which config.
+type auditLog struct {
+	mu    sync.Mutex
+	f     *os.File
+	actor auditActor
+}
+
+// auditActor is who and what made the requests of a process.
+type auditActor struct {
+	Command  string `json:"command"`
+	User     string `json:"user,omitempty"`
+	Host     string `json:"host,omitempty"`
+	PID      int    `json:"pid"`
+	Config   string `json:"config,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+}
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time      time.Time         `json:"time"`
+	API       string            `json:"api"`
+	Account   string            `json:"account,omitempty"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Status    int               `json:"status,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	RequestID string            `json:"requestId,omitempty"`
+	Result    map[string]string `json:"result,omitempty"`
+	Duration  string            `json:"duration"`
+	auditActor
+}
+
+// openAuditLog opens audit.path for appending, if set, so a run that can't
+// be audited fails before it writes anything.
+func openAuditLog(command string) error {
+
+	path := viper.GetString("audit.path")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("unable to open the audit log: %w", err)
+	}
+
+	host, _ := os.Hostname()
+	auditTrail = &auditLog{
+		f: f,
+		actor: auditActor{
+			Command:  command,
+			User:     firstNonEmpty(os.Getenv("USER"), os.Getenv("USERNAME")),
+			Host:     host,
+			PID:      os.Getpid(),
+			Config:   viper.ConfigFileUsed(),
+			Profile:  firstNonEmpty(profileName, viper.GetString("profile")),
+			Campaign: campaignName,
+		},
+	}
+	slog.Debug("Writing audit log", "path", path)
+
+	return nil
+}
+
+// Record appends an entry as a single write, so entries of concurrent
+// requests and processes don't interleave.
+func (a *auditLog) Record(entry auditEntry) {
+
+	entry.auditActor = a.actor
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Unable to write the audit log", "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.f.Write(append(line, '\n')); err != nil {
+		slog.Error("Unable to write the audit log", "error", err)
+	}
+}
+
+// auditTransport records the writes made through it in the audit log, each
+// attempt of a retried request on its own.
+type auditTransport struct {
+	api  string
+	base http.RoundTripper
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if auditTrail == nil || !auditedWrite(t.api, req) {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	entry := auditEntry{
+		Time:     start.UTC(),
+		API:      t.api,
+		Account:  viper.GetString(t.api + ".user"),
+		Method:   req.Method,
+		URL:      auditURL(t.api, req.URL),
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		auditTrail.Record(entry)
+		return resp, err
+	}
+
+	entry.Status = resp.StatusCode
+	for _, header := range auditRequestIDHeaders {
+		if id := resp.Header.Get(header); id != "" {
+			entry.RequestID = id
+			break
+		}
+	}
+
+	//Read the start of the response for what was written and hand on what
+	//was read followed by the rest
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") && resp.ContentLength <= auditMaxBody {
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, auditMaxBody))
+		resp.Body = &auditBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		if readErr == nil && len(body) < auditMaxBody {
+			entry.Result = auditResult(body)
+		}
+	}
+	auditTrail.Record(entry)
+
+	return resp, nil
+}
+
+// auditBody is a response body partly read for the audit log.
+type auditBody struct {
+	io.Reader
+	io.Closer
+}
+
+// auditedWrite reports whether a request changes something: any method but
+// GET to the trackers and notifiers, except Jira searches, posts to Slack
+// incoming webhooks, and on Slack's web API the methods that post, edit or
+// delete messages and files or join channels.
+func auditedWrite(api string, req *http.Request) bool {
+
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+		return false
+	}
+
+	switch api {
+	case "jira":
+		return !strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/jql"), "/search")
+	case "slack":
+		if webhookRequest(api, req.URL) {
+			return true
+		}
+		method := strings.TrimPrefix(req.URL.Path, "/api/")
+		for _, prefix := range []string{"chat.", "files.", "reactions.", "conversations.join"} {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// auditURL is the URL of a request without its query and credentials. The
+// path of a webhook is usually its secret, so only the host of those is kept.
+func auditURL(api string, u *url.URL) string {
+
+	redacted := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}
+	if webhookRequest(api, u) {
+		redacted.Path = ""
+		return redacted.String() + "/***"
+	}
+
+	return redacted.String()
+}
+
+// webhookRequest reports whether a request goes to a webhook: everything the
+// teams and webhook notifiers send, and on Slack hooks.slack.com and the
+// slack.webhookUrl and slack.webhooks of Slack compatible services such as
+// Mattermost.
+func webhookRequest(api string, u *url.URL) bool {
+
+	switch api {
+	case "teams", "webhook":
+		return true
+	case "slack":
+		if u.Host == "hooks.slack.com" {
+			return true
+		}
+		webhooks := []string{viper.GetString("slack.webhookUrl")}
+		for _, webhook := range viper.GetStringMapString("slack.webhooks") {
+			webhooks = append(webhooks, webhook)
+		}
+		for _, webhook := range webhooks {
+			configured, err := url.Parse(webhook)
+			if err == nil && webhook != "" && configured.Host == u.Host && configured.Path == u.Path {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// auditResult picks the auditResultFields out of a JSON response.
+func auditResult(body []byte) map[string]string {
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+
+	result := make(map[string]string)
+	for _, name := range auditResultFields {
+		switch value := fields[name].(type) {
+		case string:
+			if value != "" {
+				result[name] = value
+			}
+		case float64:
+			result[name] = fmt.Sprint(value)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+
+	return result
+}
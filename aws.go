@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Prefixes of secrets read from AWS: aws-sm:<secret id>[#<json key>] for
+// Secrets Manager and ssm:<parameter name> for SSM Parameter Store.
+const (
+	secretsManagerPrefix = "aws-sm:"
+	parameterStorePrefix = "ssm:"
+)
+
+// awsCredentials are the keys requests are signed with.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+// awsClient calls the Secrets Manager or SSM JSON API with SigV4 signed
+// requests, using the ambient credentials of the environment.
+type awsClient struct {
+	client      *http.Client
+	service     string
+	region      string
+	endpoint    string
+	credentials awsCredentials
+
+	//Secrets Manager secrets are cached, several keys often live in one secret
+	secrets map[string]string
+}
+
+// newAWSClient creates a client for service, secretsmanager or ssm, in
+// aws.region or the region of the environment.
+func newAWSClient(service string) (*awsClient, error) {
+
+	a := &awsClient{
+		client:   &http.Client{Transport: newMetricsTransport("aws", nil)},
+		service:  service,
+		region:   firstNonEmpty(viper.GetString("aws.region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		endpoint: strings.TrimSuffix(viper.GetString("aws."+service+"Endpoint"), "/"),
+		secrets:  make(map[string]string),
+	}
+	if a.region == "" {
+		return nil, fmt.Errorf("aws secrets need a region: set aws.region or AWS_REGION")
+	}
+	if a.endpoint == "" {
+		a.endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, a.region)
+	}
+
+	credentials, err := ambientAWSCredentials(a.client, a.region)
+	if err != nil {
+		return nil, err
+	}
+	a.credentials = credentials
+
+	return a, nil
+}
+
+func (a *awsClient) Read(reference string) (string, error) {
+
+	if a.service == "ssm" {
+		return a.parameter(reference)
+	}
+
+	return a.secret(reference)
+}
+
+// secret returns a Secrets Manager secret, or one key of it when the secret
+// is a JSON object and the reference ends in #key.
+func (a *awsClient) secret(reference string) (string, error) {
+
+	id, key, _ := strings.Cut(reference, "#")
+	if id == "" {
+		return "", fmt.Errorf("invalid reference %q, expected %s<secret id>[#<key>]", secretsManagerPrefix+reference, secretsManagerPrefix)
+	}
+
+	value, ok := a.secrets[id]
+	if !ok {
+		var out struct {
+			SecretString string `json:"SecretString"`
+		}
+		if err := a.call("secretsmanager.GetSecretValue", map[string]interface{}{"SecretId": id}, &out); err != nil {
+			return "", fmt.Errorf("unable to read secret %s: %w", id, err)
+		}
+		value = out.SecretString
+		a.secrets[id] = value
+	}
+
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a json object, remove #%s to use it whole", id, key)
+	}
+	field, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string key %s", id, key)
+	}
+
+	return field, nil
+}
+
+// parameter returns an SSM parameter, decrypting SecureString parameters.
+func (a *awsClient) parameter(name string) (string, error) {
+
+	var out struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := a.call("AmazonSSM.GetParameter", map[string]interface{}{"Name": name, "WithDecryption": true}, &out); err != nil {
+		return "", fmt.Errorf("unable to read parameter %s: %w", name, err)
+	}
+
+	return out.Parameter.Value, nil
+}
+
+// call sends a signed request to an AWS JSON API and decodes the response.
+func (a *awsClient) call(target string, input interface{}, out interface{}) error {
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, body, a.credentials, a.region, a.service, time.Now().UTC())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("aws returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// signAWSRequest adds a Signature Version 4 Authorization header. Every
+// header set on the request is signed.
+func signAWSRequest(req *http.Request, body []byte, credentials awsCredentials, region string, service string, now time.Time) {
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(strings.Fields(req.Header.Get(name)), " ")
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query of a request as SigV4 expects: sorted by
+// name and then value, with spaces as %20.
+func canonicalQuery(query url.Values) string {
+
+	escaped := make(map[string][]string)
+	names := []string{}
+	for name, values := range query {
+		key := awsEscape(name)
+		names = append(names, key)
+		for _, value := range values {
+			escaped[key] = append(escaped[key], awsEscape(value))
+		}
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		values := escaped[name]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, name+"="+value)
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters.
+func awsEscape(s string) string {
+
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// ambientAWSCredentials finds credentials the way the AWS SDKs do, in order:
+// environment variables, a web identity token (EKS service accounts), the
+// shared credentials file, the ECS or Batch container endpoint and the EC2
+// instance metadata service.
+func ambientAWSCredentials(client *http.Client, region string) (awsCredentials, error) {
+
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return webIdentityCredentials(client, region, tokenFile, role)
+	}
+
+	if credentials, ok := sharedFileCredentials(); ok {
+		return credentials, nil
+	}
+
+	if uri := containerCredentialsURI(); uri != "" {
+		req, err := http.NewRequest(http.MethodGet, uri, nil)
+		if err != nil {
+			return awsCredentials{}, err
+		}
+		if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		var credentials awsCredentials
+		if err := getJSON(awsMetadataClient(10*time.Second), req, &credentials); err != nil {
+			return awsCredentials{}, fmt.Errorf("unable to get container credentials: %w", err)
+		}
+		if credentials.AccessKeyID == "" {
+			return awsCredentials{}, fmt.Errorf("the container credentials endpoint returned no keys")
+		}
+		return credentials, nil
+	}
+
+	credentials, err := instanceCredentials()
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("no aws credentials found in the environment, shared credentials file, container or instance metadata: %w", err)
+	}
+
+	return credentials, nil
+}
+
+// containerCredentialsURI returns the credentials endpoint ECS and Batch
+// provide to containers, if any.
+func containerCredentialsURI() string {
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return "http://169.254.170.2" + uri
+	}
+
+	return os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+}
+
+// webIdentityCredentials exchanges a web identity token for credentials of
+// the role. The STS call needs no signature.
+func webIdentityCredentials(client *http.Client, region string, tokenFile string, role string) (awsCredentials, error) {
+
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("unable to read web identity token: %w", err)
+	}
+
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {firstNonEmpty(os.Getenv("AWS_ROLE_SESSION_NAME"), "imp")},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := firstNonEmpty(viper.GetString("aws.stsEndpoint"), fmt.Sprintf("https://sts.%s.amazonaws.com", region))
+
+	resp, err := client.Get(strings.TrimSuffix(endpoint, "/") + "/?" + query.Encode())
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("unable to assume %s: %w", role, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return awsCredentials{}, fmt.Errorf("unable to assume %s: sts returned %s: %s", role, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return awsCredentials{}, fmt.Errorf("unable to read sts response: %w", err)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     out.Credentials.AccessKeyID,
+		SecretAccessKey: out.Credentials.SecretAccessKey,
+		SessionToken:    out.Credentials.SessionToken,
+	}, nil
+}
+
+// sharedFileCredentials reads static keys for AWS_PROFILE, or default, from
+// the shared credentials file.
+func sharedFileCredentials() (awsCredentials, bool) {
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return awsCredentials{}, false
+	}
+	defer f.Close()
+
+	profile := firstNonEmpty(os.Getenv("AWS_PROFILE"), "default")
+	section := ""
+	values := map[string]string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	credentials := awsCredentials{
+		AccessKeyID:     values["aws_access_key_id"],
+		SecretAccessKey: values["aws_secret_access_key"],
+		SessionToken:    values["aws_session_token"],
+	}
+
+	return credentials, credentials.AccessKeyID != "" && credentials.SecretAccessKey != ""
+}
+
+// awsMetadataClient returns a client for the container and instance
+// metadata endpoints. They are local to the host, so requests never go
+// through a proxy, whatever aws.http.proxy or HTTPS_PROXY say.
+func awsMetadataClient(timeout time.Duration) *http.Client {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+
+	return &http.Client{Timeout: timeout, Transport: newMetricsTransport("aws", transport)}
+}
+
+// instanceCredentials reads the instance profile's credentials from the EC2
+// metadata service using IMDSv2.
+func instanceCredentials() (awsCredentials, error) {
+
+	//The metadata service answers fast or not at all
+	client := awsMetadataClient(2 * time.Second)
+	base := "http://169.254.169.254/latest"
+
+	req, err := http.NewRequest(http.MethodPut, base+"/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	token, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("the metadata service returned %s for a token", resp.Status)
+	}
+
+	get := func(path string) (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodGet, base+"/meta-data/iam/security-credentials/"+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return req, nil
+	}
+
+	req, err = get("")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	roles, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("the metadata service returned %s for the instance role", resp.Status)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if role == "" {
+		return awsCredentials{}, fmt.Errorf("the instance has no iam role")
+	}
+
+	req, err = get(role)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var credentials awsCredentials
+	if err := getJSON(client, req, &credentials); err != nil {
+		return awsCredentials{}, err
+	}
+
+	return credentials, nil
+}
+
+// getJSON sends the request and decodes a successful JSON response.
+func getJSON(client *http.Client, req *http.Request, out interface{}) error {
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
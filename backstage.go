@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// backstageEntity is the part of a Backstage catalog entity imp uses.
+type backstageEntity struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+		Labels      map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Owner   string `json:"owner"`
+		Profile struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+	} `json:"spec"`
+	Relations []struct {
+		Type      string `json:"type"`
+		TargetRef string `json:"targetRef"`
+	} `json:"relations"`
+}
+
+// queryBackstage builds the service list from the components, groups and
+// users in the Backstage catalog at backstage.url. A component's owner group
+// becomes its team and the group's members the team members.
+func queryBackstage() ([]catalog.Service, error) {
+
+	baseURL := strings.TrimRight(viper.GetString("backstage.url"), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("backstage.url is not configured; set it or use --catalog-file")
+	}
+
+	client := &http.Client{Transport: newMetricsTransport("backstage", nil)}
+
+	components, err := fetchBackstageEntities(client, baseURL, "component")
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := fetchBackstageEntities(client, baseURL, "group")
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := fetchBackstageEntities(client, baseURL, "user")
+	if err != nil {
+		return nil, err
+	}
+
+	emails := make(map[string]string)
+	for _, user := range users {
+		emails[backstageRef(user)] = user.Spec.Profile.Email
+	}
+
+	teams := make(map[string]catalog.Team)
+	for _, group := range groups {
+		team := catalog.Team{TeamId: group.Metadata.Name}
+		for _, relation := range group.Relations {
+			if relation.Type == "hasMember" && emails[relation.TargetRef] != "" {
+				team.TeamMembers = append(team.TeamMembers, catalog.TeamMember{User: catalog.User{Email: emails[relation.TargetRef]}})
+			}
+		}
+		teams[backstageRef(group)] = team
+	}
+
+	services := []catalog.Service{}
+	for _, component := range components {
+		services = append(services, backstageService(component, teams))
+	}
+
+	return services, nil
+}
+
+// backstageService maps a component to a Service. Repositories come from the
+// github.com/project-slug and backstage.io/source-location annotations, the
+// Slack channel from backstage.slackChannelAnnotation, the Jira project from
+// jira/project-key and the tier and language from the tier and language labels.
+func backstageService(component backstageEntity, teams map[string]catalog.Team) catalog.Service {
+
+	annotations := component.Metadata.Annotations
+
+	labels := component.Metadata.Labels
+	service := catalog.Service{ServiceId: component.Metadata.Name, Tier: labels["tier"], Language: labels["language"]}
+
+	if slug := annotations["github.com/project-slug"]; slug != "" {
+		service.RepositoryUrls = append(service.RepositoryUrls, "https://github.com/"+slug)
+	}
+	if location := backstageSourceLocation(annotations["backstage.io/source-location"]); location != "" {
+		service.RepositoryUrls = append(service.RepositoryUrls, location)
+	}
+
+	service.SlackGeneralChannel.ChannelId = annotations[viper.GetString("backstage.slackChannelAnnotation")]
+
+	if key := annotations["jira/project-key"]; key != "" {
+		service.IssueTrackerUrl = strings.TrimRight(viper.GetString("jira.baseurl"), "/") + "/projects/" + key
+	}
+
+	owner := component.Spec.Owner
+	if !strings.Contains(owner, ":") {
+		owner = "group:" + owner
+	}
+	if !strings.Contains(owner, "/") {
+		kind, name, _ := strings.Cut(owner, ":")
+		owner = kind + ":default/" + name
+	}
+	if team, ok := teams[strings.ToLower(owner)]; ok {
+		service.Team = team
+	} else {
+		_, name, _ := strings.Cut(owner, "/")
+		service.Team = catalog.Team{TeamId: name}
+	}
+
+	return service
+}
+
+// backstageSourceLocation turns a source-location annotation such as
+// url:https://github.com/org/x/tree/main/ into the repository URL.
+func backstageSourceLocation(location string) string {
+
+	location, ok := strings.CutPrefix(location, "url:")
+	if !ok {
+		return ""
+	}
+
+	for _, marker := range []string{"/tree/", "/blob/", "/-/tree/"} {
+		if before, _, found := strings.Cut(location, marker); found {
+			location = before
+		}
+	}
+
+	return strings.TrimRight(location, "/")
+}
+
+// backstageRef returns the entity reference, e.g. group:default/platform,
+// that relations use to point at an entity.
+func backstageRef(entity backstageEntity) string {
+
+	namespace := firstNonEmpty(entity.Metadata.Namespace, "default")
+	return strings.ToLower(entity.Kind + ":" + namespace + "/" + entity.Metadata.Name)
+}
+
+// fetchBackstageEntities returns every entity of a kind, a page at a time.
+func fetchBackstageEntities(client *http.Client, baseURL string, kind string) ([]backstageEntity, error) {
+
+	pageSize := viper.GetInt("backstage.pageSize")
+	entities := []backstageEntity{}
+
+	for offset := 0; ; offset += pageSize {
+		query := url.Values{}
+		query.Set("filter", "kind="+kind)
+		query.Set("limit", fmt.Sprint(pageSize))
+		query.Set("offset", fmt.Sprint(offset))
+
+		req, err := http.NewRequest(http.MethodGet, baseURL+"/api/catalog/entities?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if token := viper.GetString("backstage.token"); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("backstage request failed: %w", err)
+		}
+
+		byteValue, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read backstage response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("backstage returned %s: %s", resp.Status, string(byteValue))
+		}
+
+		var page []backstageEntity
+		if err := json.Unmarshal(byteValue, &page); err != nil {
+			return nil, fmt.Errorf("unable to parse backstage response: %w", err)
+		}
+
+		entities = append(entities, page...)
+
+		if len(page) < pageSize {
+			return entities, nil
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"text/template"
+)
+
+// defaultBlocksTemplate is the Block Kit layout used when slack.blocksTemplate
+// is not set. The plain text message rendered from the Slack template is
+// available as .message and is also sent as the notification fallback text.
+const defaultBlocksTemplate = `[
+  {"type": "header", "text": {"type": "plain_text", "text": {{json (printf "Migration: %s" .service)}}}},
+  {"type": "section", "fields": [
+    {"type": "mrkdwn", "text": {{json (printf "*Service*\n%s" .service)}}},
+    {"type": "mrkdwn", "text": {{json (printf "*Repository*\n%s" .repository)}}}
+  ]},
+  {"type": "section", "text": {"type": "mrkdwn", "text": {{json .message}}}},
+  {{- if .jira_url}}
+  {"type": "actions", "elements": [
+    {"type": "button", "text": {"type": "plain_text", "text": {{json (printf "Open %s" .jira_ticket)}}}, "url": {{json .jira_url}}}
+  ]},
+  {{- end}}
+  {"type": "context", "elements": [{"type": "mrkdwn", "text": {{json (printf "Team: %s" .team)}}}]}
+]`
+
+// useBlocks reports whether notifications are sent as Block Kit layouts
+// (slack.format: blocks, the default) rather than plain text.
+func useBlocks(format string) bool {
+	return format != "text"
+}
+
+// loadBlocksTemplate loads the Block Kit layout from fileName, or the default
+// layout when no file is given.
+func loadBlocksTemplate(fileName string) (*template.Template, error) {
+	return loadTemplate("blocksTemplate", fileName, defaultBlocksTemplate)
+}
+
+// renderBlocks renders the layout and parses it into Slack blocks.
+func renderBlocks(tmpl *template.Template, data map[string]interface{}) ([]slack.Block, string, error) {
+
+	rendered, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var blocks slack.Blocks
+	if err := json.Unmarshal([]byte(rendered), &blocks); err != nil {
+		return nil, "", fmt.Errorf("slack blocks template did not render valid block kit json: %w", err)
+	}
+
+	return blocks.BlockSet, rendered, nil
+}
+
+// toJSON renders a value as JSON so templates can safely embed strings in a
+// Block Kit layout.
+func toJSON(value interface{}) (string, error) {
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// servicesQuery is the GraphQL query sent to BigBrother, one page at a
+// time. The shape of the response matches DataSet.
+const servicesQuery = `query($first: Int!, $after: String) {
+  services(first: $first, after: $after) {
+    pageInfo { hasNextPage endCursor }
+    nodes {
+      serviceId
+      repositoryUrls
+      issueTrackerUrl
+      slackGeneralChannel { channelId channelName }
+      tier
+      language
+      team {
+        teamId
+        lead { email slackDisplayName }
+        teamMembers { user { email slackDisplayName } }
+      }
+    }
+  }
+}`
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// fetchServices returns the full list of services, either from the local
+// catalog file when one is given or from the catalog.provider API. API
+// results are cached for catalog.cacheTTL.
+func fetchServices(catalogFile string) ([]catalog.Service, error) {
+
+	if catalogFile != "" {
+		return catalog.ReadFile(catalogFile)
+	}
+
+	cacheFile, ttl := catalogCacheFile(), viper.GetDuration("catalog.cacheTTL")
+	if ttl > 0 && cacheFile != "" && !refreshCatalog {
+		if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < ttl {
+			slog.Debug("Using cached catalog", "file", cacheFile, "age", time.Since(info.ModTime()).Round(time.Second))
+			return catalog.ReadFile(cacheFile)
+		}
+	}
+
+	services, err := queryCatalog()
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 && cacheFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err == nil {
+			err = catalog.WriteFile(services, cacheFile)
+		}
+		if err != nil {
+			slog.Warn("Unable to cache the catalog", "file", cacheFile, "error", err)
+		}
+	}
+
+	return services, nil
+}
+
+// queryCatalog fetches the services from the configured catalog.provider,
+// BigBrother unless set otherwise.
+func queryCatalog() ([]catalog.Service, error) {
+
+	switch provider := strings.ToLower(firstNonEmpty(viper.GetString("catalog.provider"), "bigbrother")); provider {
+	case "bigbrother":
+		return queryBigBrother()
+	case "backstage":
+		return queryBackstage()
+	case "opslevel":
+		return queryOpsLevel()
+	default:
+		return nil, fmt.Errorf("unknown catalog.provider %q, expected bigbrother, backstage or opslevel", provider)
+	}
+}
+
+// catalogCacheFile returns catalog.cacheFile, defaulting to
+// imp/catalog-<hash>.json in the user's cache directory. The hash is of the
+// provider and its endpoint, so profiles and providers don't share a cache.
+func catalogCacheFile() string {
+
+	if file := viper.GetString("catalog.cacheFile"); file != "" {
+		return file
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	provider := strings.ToLower(firstNonEmpty(viper.GetString("catalog.provider"), "bigbrother"))
+	sum := sha256.Sum256([]byte(provider + "\n" + viper.GetString(provider+".url")))
+
+	return filepath.Join(dir, "imp", fmt.Sprintf("catalog-%x.json", sum[:6]))
+}
+
+func queryBigBrother() ([]catalog.Service, error) {
+
+	url := viper.GetString("bigbrother.url")
+	if url == "" {
+		return nil, fmt.Errorf("bigbrother.url is not configured; set it or use -catalog-file")
+	}
+
+	client := &http.Client{Transport: newMetricsTransport("bigbrother", nil)}
+
+	//Follow the cursor until the last page so large catalogs are not truncated
+	services := []catalog.Service{}
+	after := ""
+	for page := 1; ; page++ {
+		nodes, err := queryServicesPage(client, url, after)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, nodes.Services...)
+
+		if nodes.PageInfo == nil || !nodes.PageInfo.HasNextPage {
+			break
+		}
+		if nodes.PageInfo.EndCursor == "" || nodes.PageInfo.EndCursor == after {
+			return nil, fmt.Errorf("bigbrother returned page %d without a new cursor", page)
+		}
+
+		after = nodes.PageInfo.EndCursor
+		slog.Debug("Fetched catalog page", "page", page, "services", len(services))
+	}
+
+	return services, nil
+}
+
+// queryServicesPage fetches the page of services following the after cursor,
+// or the first page when after is empty.
+func queryServicesPage(client *http.Client, url string, after string) (catalog.Node, error) {
+
+	variables := map[string]interface{}{
+		"first": viper.GetInt("bigbrother.pageSize"),
+	}
+	if after != "" {
+		variables["after"] = after
+	}
+
+	body, err := json.Marshal(graphQLRequest{Query: servicesQuery, Variables: variables})
+	if err != nil {
+		return catalog.Node{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return catalog.Node{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := viper.GetString("bigbrother.token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return catalog.Node{}, fmt.Errorf("bigbrother request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	byteValue, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return catalog.Node{}, fmt.Errorf("unable to read bigbrother response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return catalog.Node{}, fmt.Errorf("bigbrother returned %s: %s", resp.Status, string(byteValue))
+	}
+
+	var result struct {
+		catalog.DataSet
+		Errors []graphQLError `json:"errors"`
+	}
+	if err := json.Unmarshal(byteValue, &result); err != nil {
+		return catalog.Node{}, fmt.Errorf("unable to parse bigbrother response: %w", err)
+	}
+
+	if len(result.Errors) > 0 {
+		return catalog.Node{}, fmt.Errorf("bigbrother query failed: %s", result.Errors[0].Message)
+	}
+
+	return result.Data.NodeList, nil
+}
+
+var catalogSyncOut string
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Work with the service catalog",
+}
+
+var catalogSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Download the service catalog to a local file for use with --catalog-file",
+	RunE:  runCatalogSync,
+}
+
+var catalogValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Report catalog entries with missing or malformed data",
+	RunE:  runCatalogValidate,
+}
+
+func init() {
+
+	catalogSyncCmd.Flags().StringVarP(&catalogSyncOut, "out", "o", "services.json", "file to write the catalog to")
+
+	catalogCmd.AddCommand(catalogSyncCmd)
+	catalogCmd.AddCommand(catalogValidateCmd)
+	rootCmd.AddCommand(catalogCmd)
+}
+
+func runCatalogSync(cmd *cobra.Command, args []string) error {
+
+	services, err := queryCatalog()
+	if err != nil {
+		return err
+	}
+
+	if err := catalog.WriteFile(services, catalogSyncOut); err != nil {
+		return err
+	}
+
+	slog.Info("Wrote service catalog", "services", len(services), "file", catalogSyncOut)
+
+	return nil
+}
+
+func runCatalogValidate(cmd *cobra.Command, args []string) error {
+
+	services, err := fetchServices(catalogFile)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, service := range services {
+		for _, problem := range catalog.Problems(service) {
+			fmt.Printf("%s: %s\n", firstNonEmpty(service.ServiceId, "(no service id)"), problem)
+			problems++
+		}
+	}
+
+	fmt.Printf("%d services checked, %d problems found\n", len(services), problems)
+
+	if problems > 0 {
+		return fmt.Errorf("%d catalog problems found", problems)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// slackChannelNames resolves channel names to IDs for catalog entries that
+// only carry a channel name. It is set by commands that post to Slack; other
+// commands show the name instead.
+var slackChannelNames *channelNames
+
+// channelNames lists the workspace's channels once, on first use, and looks
+// names up in that list.
+type channelNames struct {
+	api *slack.Client
+
+	once sync.Once
+	ids  map[string]string
+	err  error
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func newChannelNames(api *slack.Client) *channelNames {
+	return &channelNames{
+		api:    api,
+		warned: make(map[string]bool),
+	}
+}
+
+// Resolve returns the ID of the channel with the given name, with or without
+// the leading #.
+func (c *channelNames) Resolve(name string) (string, error) {
+
+	c.once.Do(func() {
+		c.ids, c.err = c.list()
+	})
+	if c.err != nil {
+		return "", c.err
+	}
+
+	id, ok := c.ids[normalizeChannelName(name)]
+	if !ok {
+		return "", fmt.Errorf("no channel named %s", name)
+	}
+
+	return id, nil
+}
+
+// warnOnce logs a failed resolution the first time it happens for a name.
+func (c *channelNames) warnOnce(name string, err error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.warned[name] {
+		return
+	}
+	c.warned[name] = true
+
+	slog.Warn("Unable to resolve Slack channel, using the default channel", "channel", name, "error", err)
+}
+
+// list pages through conversations.list and returns the channel IDs by name.
+func (c *channelNames) list() (map[string]string, error) {
+
+	types := viper.GetStringSlice("slack.channelTypes")
+	if len(types) == 0 {
+		types = []string{"public_channel", "private_channel"}
+	}
+
+	ids := map[string]string{}
+	cursor := ""
+	for {
+		channels, next, err := c.api.GetConversations(&slack.GetConversationsParameters{
+			Cursor:          cursor,
+			ExcludeArchived: true,
+			Limit:           1000,
+			Types:           types,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list slack channels: %w", err)
+		}
+
+		for _, channel := range channels {
+			ids[normalizeChannelName(channel.Name)] = channel.ID
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	slog.Debug("Listed Slack channels", "channels", len(ids))
+
+	return ids, nil
+}
+
+func normalizeChannelName(name string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"imp/pkg/run"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// checkpointEntry is one completed row, written as a line of JSON. An entry
+// without a repository records the epic the run created.
+type checkpointEntry struct {
+	RunID      string `json:"runId"`
+	Epic       string `json:"epic,omitempty"`
+	Repository string `json:"repository"`
+	Service    string `json:"service,omitempty"`
+	JiraKey    string `json:"jiraKey,omitempty"`
+	Channel    string `json:"channel,omitempty"`
+	Status     string `json:"status"`
+}
+
+// checkpointRun is an interrupted run read back from its checkpoint.
+type checkpointRun struct {
+	ID   string
+	Epic string
+	Done map[string]run.Result
+}
+
+// checkpoint records rows as they complete so an interrupted run can be
+// resumed with --resume. Failed rows are recorded too but are retried on
+// resume.
+type checkpoint struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// checkpointFile is the --checkpoint of imp create. Each campaign has its own
+// by default, so campaigns can run side by side in one directory.
+func checkpointFile(cmd *cobra.Command) string {
+
+	if campaignName != "" && !cmd.Flags().Changed("checkpoint") {
+		return campaignFile(createFlags.checkpointFile, campaignName)
+	}
+
+	return createFlags.checkpointFile
+}
+
+// openCheckpoint opens the checkpoint file for appending when resuming and
+// truncates it for a fresh run.
+func openCheckpoint(path string, resume bool) (*checkpoint, error) {
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open checkpoint %s: %w", path, err)
+	}
+
+	return &checkpoint{f: f}, nil
+}
+
+func (c *checkpoint) Record(runID string, result run.Result) error {
+
+	return c.write(checkpointEntry{
+		RunID:      runID,
+		Repository: result.Repository,
+		Service:    result.Service,
+		JiraKey:    result.JiraKey,
+		Channel:    result.Channel,
+		Status:     result.Status,
+	})
+}
+
+// RecordEpic records the epic created by a run, so resuming it links the
+// remaining tickets to the same epic instead of creating another.
+func (c *checkpoint) RecordEpic(runID string, epic string) error {
+
+	return c.write(checkpointEntry{RunID: runID, Epic: epic})
+}
+
+func (c *checkpoint) write(entry checkpointEntry) error {
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return c.f.Sync()
+}
+
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// readCheckpoint returns the run ID, the epic it created and the completed
+// rows of the run in the checkpoint file, keyed by repository. Rows whose
+// last recorded status is failed are left out so they are retried.
+func readCheckpoint(path string) (checkpointRun, error) {
+
+	state := checkpointRun{Done: make(map[string]run.Result)}
+	done := state.Done
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, fmt.Errorf("no checkpoint to resume from at %s", path)
+	}
+	if err != nil {
+		return state, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			//A partially written last line from a crash is expected
+			continue
+		}
+
+		state.ID = entry.RunID
+		if entry.Repository == "" {
+			state.Epic = firstNonEmpty(entry.Epic, state.Epic)
+			continue
+		}
+		if entry.Status == run.StatusFailed {
+			delete(done, entry.Repository)
+			continue
+		}
+
+		done[entry.Repository] = run.Result{
+			Repository: entry.Repository,
+			Service:    entry.Service,
+			JiraKey:    entry.JiraKey,
+			Channel:    entry.Channel,
+			Status:     entry.Status,
+		}
+	}
+
+	return state, scanner.Err()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log/slog"
+	"strings"
+)
+
+var closeFlags struct {
+	runID      string
+	resolution string
+	transition string
+	comment    string
+	dryRun     bool
+	yes        bool
+}
+
+var closeCmd = &cobra.Command{
+	Use:   "close",
+	Args:  cobra.NoArgs,
+	Short: "Resolve every ticket created by a run",
+	RunE:  runClose,
+}
+
+func init() {
+
+	flags := closeCmd.Flags()
+	flags.StringVar(&closeFlags.runID, "run", "", "ID of the run whose tickets are closed")
+	flags.StringVar(&closeFlags.resolution, "resolution", "Done", "resolution set on the tickets, when the transition asks for one")
+	flags.StringVar(&closeFlags.transition, "transition", "", "transition or status used, defaults to jira.closeTransition or the first one into a done status")
+	flags.StringVar(&closeFlags.comment, "comment", "", "comment added to each ticket before it is closed")
+	flags.BoolVar(&closeFlags.dryRun, "dry-run", false, "list the tickets without changing anything")
+	flags.BoolVarP(&closeFlags.yes, "yes", "y", false, "close without asking for confirmation")
+
+	closeCmd.MarkFlagRequired("run")
+
+	rootCmd.AddCommand(closeCmd)
+}
+
+func runClose(cmd *cobra.Command, args []string) error {
+
+	if trackerKind() != "jira" {
+		return fmt.Errorf("close is only supported by the jira tracker")
+	}
+
+	tr, err := newTracker()
+	if err != nil {
+		return err
+	}
+	jiraClient := tr.(*jiraTracker).client
+
+	l, err := openRunLedger()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	entries, err := l.Run(closeFlags.runID)
+	if err != nil {
+		return err
+	}
+
+	if closeFlags.dryRun {
+		for _, entry := range entries {
+			fmt.Printf("%s\t%s\n", entry.JiraKey, entry.Repository)
+		}
+		fmt.Printf("%d tickets would be closed as %s\n", len(entries), closeFlags.resolution)
+		return nil
+	}
+
+	if !closeFlags.yes {
+		ok, err := confirm(fmt.Sprintf("Close the %d tickets of run %s as %s?", len(entries), closeFlags.runID, closeFlags.resolution))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	limit := newRateLimiter(viper.GetFloat64("jira.requestsPerSecond"))
+	defer limit.Stop()
+
+	transition := firstNonEmpty(closeFlags.transition, viper.GetString("jira.closeTransition"))
+
+	//Ctrl-C from here on stops after the ticket in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	closed, skipped, failed := 0, 0, 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		limit.Wait()
+		issue, _, err := jiraClient.Issue.Get(entry.JiraKey, &jira.GetQueryOptions{Fields: "status"})
+		if err != nil {
+			slog.Error("Unable to get ticket", "ticket", entry.JiraKey, "error", err)
+			failed++
+			continue
+		}
+		if statusCategory(*issue) == "done" {
+			slog.Info("Ticket already done", "ticket", entry.JiraKey)
+			skipped++
+			continue
+		}
+
+		if closeFlags.comment != "" {
+			limit.Wait()
+			if err := tr.Comment(entry.JiraKey, closeFlags.comment); err != nil {
+				slog.Error("Unable to comment on ticket", "ticket", entry.JiraKey, "error", err)
+				failed++
+				continue
+			}
+		}
+
+		limit.Wait()
+		if err := closeIssue(jiraClient, entry.JiraKey, transition, closeFlags.resolution); err != nil {
+			slog.Error("Unable to close ticket", "ticket", entry.JiraKey, "repository", entry.Repository, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Closed ticket", "ticket", entry.JiraKey, "repository", entry.Repository, "resolution", closeFlags.resolution)
+		closed++
+	}
+
+	fmt.Printf("%d tickets closed, %d already done, %d failed\n", closed, skipped, failed)
+
+	if ctx.Err() != nil {
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted with %d of %d tickets not attempted", len(entries)-closed-skipped-failed, len(entries)))
+	}
+
+	if failed > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d tickets could not be closed", failed))
+	}
+
+	return nil
+}
+
+// closeIssue moves a ticket through the named transition, or the first one
+// into a done status when name is empty, setting the resolution when the
+// transition has a resolution field.
+func closeIssue(jiraClient *jira.Client, key string, name string, resolution string) error {
+
+	transitions, _, err := jiraClient.Issue.GetTransitions(key)
+	if err != nil {
+		return fmt.Errorf("unable to list transitions of %s: %w", key, err)
+	}
+
+	available := []string{}
+	for _, transition := range transitions {
+		matches := strings.EqualFold(transition.Name, name) || strings.EqualFold(transition.To.Name, name)
+		if name == "" {
+			matches = transition.To.StatusCategory.Key == jira.StatusCategoryComplete
+		}
+		if !matches {
+			available = append(available, transition.Name)
+			continue
+		}
+
+		//jira.Resolution would also send an empty id, so the payload is built by hand
+		payload := map[string]interface{}{
+			"transition": map[string]string{"id": transition.ID},
+		}
+		if _, ok := transition.Fields["resolution"]; ok && resolution != "" {
+			payload["fields"] = map[string]interface{}{
+				"resolution": map[string]string{"name": resolution},
+			}
+		}
+
+		if _, err := jiraClient.Issue.DoTransitionWithPayload(key, payload); err != nil {
+			return fmt.Errorf("unable to transition %s through %s: %w", key, transition.Name, err)
+		}
+		return nil
+	}
+
+	if name == "" {
+		return fmt.Errorf("%s has no transition into a done status, available: %s", key, strings.Join(available, ", "))
+	}
+
+	return fmt.Errorf("%s has no transition %q, available: %s", key, name, strings.Join(available, ", "))
+}
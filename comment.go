@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+)
+
+var commentFlags struct {
+	runID           string
+	messageTemplate string
+	repoFile        string
+	dryRun          bool
+	yes             bool
+}
+
+var commentCmd = &cobra.Command{
+	Use:   "comment",
+	Args:  cobra.NoArgs,
+	Short: "Add a comment to every ticket created by a run",
+	RunE:  runComment,
+}
+
+func init() {
+
+	flags := commentCmd.Flags()
+	flags.StringVar(&commentFlags.runID, "run", "", "ID of the run whose tickets are commented on")
+	flags.StringVar(&commentFlags.messageTemplate, "message-template", "", "comment template, with the same variables as the ticket templates")
+	flags.StringVarP(&commentFlags.repoFile, "file", "f", "", "repository file of the run, to make its columns available to the template")
+	addInputFlags(flags)
+	flags.BoolVar(&commentFlags.dryRun, "dry-run", false, "print the comments without posting them")
+	flags.BoolVarP(&commentFlags.yes, "yes", "y", false, "comment without asking for confirmation")
+
+	commentCmd.MarkFlagRequired("run")
+	commentCmd.MarkFlagRequired("message-template")
+
+	rootCmd.AddCommand(commentCmd)
+}
+
+func runComment(cmd *cobra.Command, args []string) error {
+
+	tmpl, err := loadTemplate("messageTemplate", commentFlags.messageTemplate, "")
+	if err != nil {
+		return configError(err)
+	}
+
+	tr, err := newTracker()
+	if err != nil {
+		return err
+	}
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		return err
+	}
+
+	//The input file is optional, it only adds the row's columns
+	rows := map[string]run.Row{}
+	if commentFlags.repoFile != "" || inputFlags.githubOrg != "" || inputFlags.all {
+		repositoryList, err := readRepositoryFile(commentFlags.repoFile)
+		if err != nil {
+			return err
+		}
+		for _, row := range repositoryList {
+			rows[catalog.NormalizeRepoURL(row.Repository)] = row
+		}
+	}
+
+	l, err := openRunLedger()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	entries, err := l.Run(commentFlags.runID)
+	if err != nil {
+		return err
+	}
+
+	if !commentFlags.dryRun && !commentFlags.yes {
+		ok, err := confirm(fmt.Sprintf("Comment on the %d tickets of run %s?", len(entries), commentFlags.runID))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	limit := newRateLimiter(viper.GetFloat64(trackerKind() + ".requestsPerSecond"))
+	defer limit.Stop()
+
+	//Ctrl-C from here on stops after the ticket in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	attempted, failed := 0, 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		attempted++
+
+		row, ok := rows[catalog.NormalizeRepoURL(entry.Repository)]
+		if !ok {
+			row = run.Row{Repository: entry.Repository}
+		}
+
+		service, ok := repoLookup.Find(entry.Repository)
+		if !ok {
+			service = catalog.Service{ServiceId: entry.Service}
+		}
+
+		data := templateData(row, service)
+		data["jira_ticket"] = entry.JiraKey
+		data["jira_url"] = issueURL(entry.JiraKey)
+
+		body, err := renderTemplate(tmpl, data)
+		if err != nil {
+			return err
+		}
+
+		if commentFlags.dryRun {
+			fmt.Printf("----- %s -----\n%s\n\n", entry.JiraKey, body)
+			continue
+		}
+
+		limit.Wait()
+		if err := tr.Comment(entry.JiraKey, body); err != nil {
+			slog.Error("Unable to comment on ticket", "ticket", entry.JiraKey, "repository", entry.Repository, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Commented on ticket", "ticket", entry.JiraKey, "repository", entry.Repository)
+	}
+
+	if commentFlags.dryRun {
+		return nil
+	}
+
+	fmt.Printf("%d of %d tickets commented on\n", attempted-failed, len(entries))
+
+	if ctx.Err() != nil {
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted with %d of %d tickets not attempted", len(entries)-attempted, len(entries)))
+	}
+
+	if failed > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d tickets could not be commented on", failed))
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// printPreview prints the repository, service, project and channel of every
+// row that will be processed.
+func printPreview(rows []run.Row, repoLookup catalog.Lookup) {
+
+	writePreview(os.Stdout, rows, repoLookup)
+}
+
+// writePreview writes the preview printed by printPreview.
+func writePreview(out io.Writer, rows []run.Row, repoLookup catalog.Lookup) {
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tSERVICE\tPROJECT\tCHANNEL")
+
+	unmatched := 0
+	for _, row := range rows {
+		service, ok := repoLookup.Find(row.Repository)
+		if !ok {
+			unmatched++
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", row.Repository, service.ServiceId, projectKeyFor(service), slackChannelFor(service))
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "%d tickets to create", len(rows)-unmatched)
+	if unmatched > 0 {
+		fmt.Fprintf(out, ", %d repositories without a service will be skipped", unmatched)
+	}
+	fmt.Fprintln(out)
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no. The
+// terminal is used rather than stdin because stdin may hold the repository
+// list.
+func confirm(question string) (bool, error) {
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false, fmt.Errorf("no terminal to confirm on, use --yes to skip the confirmation")
+	}
+	defer tty.Close()
+
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
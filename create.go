@@ -0,0 +1,1030 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/notify"
+	"imp/pkg/run"
+	"imp/pkg/tracker"
+	"log/slog"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notifyError marks a row whose ticket exists but whose notification could
+// not be sent. Such rows are retried once the rest of the run is done.
+type notifyError struct {
+	err error
+}
+
+func (e *notifyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *notifyError) Unwrap() error {
+	return e.err
+}
+
+// creator holds everything needed to process a row, shared by all workers.
+type creator struct {
+	api          *slack.Client
+	tracker      tracker.Tracker
+	notifiers    *notify.FanOut
+	repoLookup   catalog.Lookup
+	summaryTmpl  *template.Template
+	jiraTmpl     *template.Template
+	slackTmpl    *template.Template
+	blocksTmpl   *template.Template
+	dryRun       bool
+	labels       []string
+	epic         string
+	sprint       string
+	fixVersion   string
+	subtasks     bool
+	concurrency  int
+	trackerLimit *rateLimiter
+	slackLimit   *rateLimiter
+	ledger       *ledger
+	users        *jiraUsers
+	slackUsers   *slackUsers
+	slackGroups  *slackUsergroups
+	runID        string
+	skipLedger   bool
+	upsert       bool
+	parents      *parentIssues
+	startedAt    time.Time
+	checkpoint   *checkpoint
+	done         map[string]run.Result
+
+	//The rows of the run, those selected by the filter when there is one
+	rows []run.Row
+
+	//Rows left out by --exclude, reported with the results of the run
+	excluded []run.Result
+
+	//Tickets recorded for imp apply instead of printed, on dry runs of imp plan
+	plan *planRecorder
+}
+
+// createOptions are the settings of a run that vary between runs, from the
+// flags of imp create or the request to imp serve.
+type createOptions struct {
+	summaryTemplate   string
+	jiraTemplateFile  string
+	slackTemplateFile string
+	blocksTemplate    string
+	dryRun            bool
+	concurrency       int
+	ignoreLedger      bool
+	labels            []string
+	epic              string
+	createEpic        string
+	mode              string
+	sprint            string
+	fixVersion        string
+	subtasks          bool
+	filters           []string
+	offset            int
+	limit             int
+	sample            int
+	exclude           []string
+	excludeFile       string
+
+	//The rows are the repositories of catalog services rather than a file
+	catalogRows bool
+}
+
+var createFlags struct {
+	createOptions
+	repoFile       string
+	unmatchedFile  string
+	reportFile     string
+	checkpointFile string
+	resume         bool
+	yes            bool
+	writeBack      bool
+	interactive    bool
+}
+
+var createCmd = &cobra.Command{
+	Use:   "create [file|-]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Create a Jira ticket and Slack notification for every repository in the file",
+	RunE:  runCreate,
+}
+
+func init() {
+
+	flags := createCmd.Flags()
+
+	//List of repositories to create tickets for
+	flags.StringVarP(&createFlags.repoFile, "file", "f", "", "list of repositories, - for stdin")
+	addInputFlags(flags)
+
+	//templates for the jira ticket summary and description, defaulting to jira.summaryTemplate and jira.descriptionTemplate
+	flags.StringVar(&createFlags.summaryTemplate, "summary-temp", "", "jira ticket summary template")
+	flags.StringVar(&createFlags.jiraTemplateFile, "jtemp", "", "jira ticket description template")
+
+	//template for slack message
+	flags.StringVar(&createFlags.slackTemplateFile, "stemp", "", "slack message template, defaults to slack.messageTemplate or a built-in message")
+
+	//Block Kit layout for the slack message, defaults to slack.blocksTemplate or the built-in layout
+	flags.StringVar(&createFlags.blocksTemplate, "blocks-temp", "", "slack block kit layout template")
+
+	//Preview tickets and messages without creating or sending anything
+	flags.BoolVar(&createFlags.dryRun, "dry-run", false, "print the jira tickets and slack messages without creating them")
+
+	//Optional CSV file listing repositories that could not be matched to a service
+	flags.StringVar(&createFlags.unmatchedFile, "unmatched-out", "", "write unmatched repositories to this csv file")
+
+	//Number of repositories processed in parallel
+	flags.IntVarP(&createFlags.concurrency, "concurrency", "c", 1, "number of repositories to process in parallel")
+
+	//Create tickets even for repositories the ledger says were already processed
+	flags.BoolVar(&createFlags.ignoreLedger, "ignore-ledger", false, "do not skip repositories already recorded in the ledger")
+
+	//Machine-readable report of the run, json when the file ends in .json and csv otherwise
+	flags.StringVar(&createFlags.reportFile, "report-out", "", "write a csv or json report of the run to this file")
+
+	//Labels added to every ticket on top of jira.labels
+	flags.StringSliceVar(&createFlags.labels, "labels", nil, "comma separated labels added to every ticket")
+
+	//Epic every ticket is linked to, either an existing one or one created for this run
+	flags.StringVar(&createFlags.epic, "epic", "", "key of an existing epic to link every ticket to, defaults to jira.epic")
+	flags.StringVar(&createFlags.createEpic, "create-epic", "", "create an epic with this summary in jira.projectKey and link every ticket to it")
+
+	//Progress of the run, used to pick up where an interrupted run stopped
+	flags.StringVar(&createFlags.checkpointFile, "checkpoint", "imp.checkpoint", "file recording the progress of the run")
+	flags.BoolVar(&createFlags.resume, "resume", false, "resume the run recorded in the checkpoint file, skipping completed rows")
+
+	//Sprint every new ticket is added to
+	flags.StringVar(&createFlags.sprint, "sprint", "", "add every ticket to this sprint id, or to the active sprint of its project's board with active")
+
+	//Release bucket for reporting, created in each project when missing
+	flags.StringVar(&createFlags.fixVersion, "fix-version", "", "fix version set on every ticket and created when missing, defaults to jira.fixVersion")
+
+	//One parent ticket per service with a subtask per repository
+	flags.BoolVar(&createFlags.subtasks, "subtasks", false, "create one parent ticket per service and a subtask per repository, defaults to jira.subtasks")
+
+	//Update tickets that already exist instead of skipping them
+	flags.StringVar(&createFlags.mode, "mode", "create", "create: handle existing tickets as jira.duplicates says, upsert: update them and add a comment")
+
+	//Process a wave of the file, e.g. one team, without editing it
+	flags.StringArrayVar(&createFlags.filters, "filter", nil, "key=value selecting repositories by the team, tier, service, channel or language of their service, repeatable")
+
+	//Leave out repositories listed in the file, e.g. archived or already migrated
+	flags.StringSliceVar(&createFlags.exclude, "exclude", nil, "repositories or service IDs to skip even if listed in the file")
+	flags.StringVar(&createFlags.excludeFile, "exclude-file", "", "file listing repositories or service IDs to skip, one per line")
+
+	//Pilot a campaign on part of the file first
+	flags.IntVar(&createFlags.offset, "offset", 0, "skip this many repositories of the file, after --filter")
+	flags.IntVar(&createFlags.limit, "limit", 0, "process at most this many repositories, after --offset")
+	flags.IntVar(&createFlags.sample, "sample", 0, "process this many repositories spread evenly over the file, after --filter")
+
+	//Record the ticket keys in the Google Sheet the repositories came from
+	flags.BoolVar(&createFlags.writeBack, "write-back", false, "write each ticket key into the column next to the repository column of a google sheet")
+
+	//Untick stale rows on the terminal before going ahead
+	flags.BoolVar(&createFlags.interactive, "interactive", false, "choose the repositories to process from a list on the terminal")
+
+	//Skip the confirmation prompt, for automation
+	flags.BoolVarP(&createFlags.yes, "yes", "y", false, "create tickets without asking for confirmation")
+
+	rootCmd.AddCommand(createCmd)
+}
+
+func runCreate(cmd *cobra.Command, args []string) error {
+
+	//Fetch the list of repositories from the file
+	repoFile, err := repositoryFileArg(createFlags.repoFile, args)
+	if err != nil {
+		return err
+	}
+
+	repositoryList, err := readRepositoryFile(repoFile)
+	if err != nil {
+		return err
+	}
+
+	sheet, fromSheet := parseGoogleSheet(repoFile)
+	if createFlags.writeBack && !fromSheet {
+		return configError(fmt.Errorf("--write-back needs the repositories to come from a google sheet"))
+	}
+
+	if _, err := runReportFormat(createFlags.reportFile); err != nil {
+		return configError(err)
+	}
+
+	c, err := newCreator(createFlags.createOptions, repositoryList)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	//Only --exclude, --filter and --offset leave none of the rows
+	if len(c.rows) == 0 && len(repositoryList) > 0 {
+		return withExitCode(exitNoMatches, fmt.Errorf("none of the %d repositories were selected by --exclude, --filter and --offset", len(repositoryList)))
+	}
+
+	//Rows left out on the terminal are reported like --exclude
+	if createFlags.interactive {
+		kept, dropped, err := pickRows(c.rows, c.repoLookup)
+		if err != nil {
+			return err
+		}
+		for _, row := range dropped {
+			c.excluded = append(c.excluded, excludedResult(row, c.repoLookup))
+		}
+		if len(kept) == 0 {
+			return withExitCode(exitNoMatches, fmt.Errorf("no repositories selected"))
+		}
+		c.rows = kept
+		slog.Info("Selected repositories", "selected", len(kept), "excluded", len(dropped))
+	}
+
+	//Show what is about to be created and ask before writing anything
+	if !c.dryRun && !createFlags.yes {
+		printPreview(c.rows, c.repoLookup)
+
+		ok, err := confirm("Create these tickets?")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	//Pick up the run ID, epic and completed rows of an interrupted run. The
+	//same --filter and slice select the same rows again
+	opts := createFlags.createOptions
+	var resumed checkpointRun
+	if createFlags.resume {
+		resumed, err = readCheckpoint(checkpointFile(cmd))
+		if err != nil {
+			return err
+		}
+		if resumed.Epic != "" {
+			opts.epic, opts.createEpic = resumed.Epic, ""
+		}
+	}
+
+	if err := c.prepare(cmd.Context(), opts); err != nil {
+		return err
+	}
+
+	if createFlags.resume {
+		c.runID, c.done = resumed.ID, resumed.Done
+		slog.Info("Resuming run", "run", c.runID, "completed", len(c.done), "epic", resumed.Epic)
+	}
+
+	if !c.dryRun {
+		c.checkpoint, err = openCheckpoint(checkpointFile(cmd), createFlags.resume)
+		if err != nil {
+			return err
+		}
+		defer c.checkpoint.Close()
+
+		if opts.createEpic != "" {
+			if err := c.checkpoint.RecordEpic(c.runID, c.epic); err != nil {
+				return err
+			}
+		}
+	}
+
+	//Ctrl-C from here on stops the run after the rows in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	results := c.run(ctx, c.rows)
+
+	printRunSummary(results)
+
+	//Repositories that have no matching service in the catalog
+	unmatched := []string{}
+	for _, result := range results {
+		if result.Status == run.StatusUnmatched {
+			unmatched = append(unmatched, result.Repository)
+		}
+	}
+
+	reportUnmatched(unmatched, c.repoLookup, createFlags.unmatchedFile)
+
+	if createFlags.reportFile != "" {
+		if err := writeRunReport(results, createFlags.reportFile); err != nil {
+			return err
+		}
+	}
+
+	if createFlags.writeBack && !c.dryRun {
+		if err := writeSheetKeys(sheet, results); err != nil {
+			slog.Error("Unable to write back ticket keys", "error", err)
+		}
+	}
+
+	format, _ := runReportFormat(createFlags.reportFile)
+	c.share(results, format)
+
+	failures := printFailures(results)
+
+	if ctx.Err() != nil {
+		interrupted := 0
+		for _, result := range results {
+			if result.Status == run.StatusInterrupted {
+				interrupted++
+			}
+		}
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted with %d of %d repositories not processed, run again with --resume to continue", interrupted, len(results)))
+	}
+
+	//Every row has been attempted; fail the command only now if any row failed
+	if failures > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d repositories failed", failures, len(results)))
+	}
+
+	if len(results) > 0 && len(unmatched) == len(results) {
+		return withExitCode(exitNoMatches, fmt.Errorf("none of the %d repositories matched a service in the catalog", len(results)))
+	}
+
+	return nil
+}
+
+// newCreator sets up the clients, templates and ledger a run needs, selects
+// the rows matching the run's filters and slice and checks their target
+// projects.
+// Close releases them.
+func newCreator(opts createOptions, rows []run.Row) (*creator, error) {
+
+	//Create Slack api client
+	api := newSlackClient()
+	if notifierEnabled("slack") && !slackWebhookMode() {
+		slackChannelNames = newChannelNames(api)
+	}
+
+	//Create the Jira, GitHub or GitLab client
+	tr, err := newTracker()
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subtasks := opts.subtasks || viper.GetBool("jira.subtasks")
+
+	//Services have several repositories by design when taken from the catalog
+	rows = dedupeRows(rows, repoLookup, !subtasks && !opts.catalogRows && !inputFlags.all)
+
+	exclusions, err := loadExclusions(opts.exclude, opts.excludeFile)
+	if err != nil {
+		return nil, configError(err)
+	}
+	rows, excluded := excludeRows(rows, repoLookup, exclusions)
+
+	if len(opts.filters) > 0 {
+		filter, err := parseServiceFilter(opts.filters)
+		if err != nil {
+			return nil, configError(err)
+		}
+		rows = selectRows(rows, repoLookup, filter)
+	}
+
+	rows, err = sliceRows(rows, opts.offset, opts.limit, opts.sample)
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	//Get jira summary and description templates
+	summaryFallback := defaultSummaryTemplate
+	if subtasks {
+		summaryFallback = defaultSubtaskSummaryTemplate
+	}
+
+	summaryTmpl, err := loadTemplate("summaryTemplate", firstNonEmpty(opts.summaryTemplate, viper.GetString("jira.summaryTemplate")), summaryFallback)
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	descriptionFile := firstNonEmpty(opts.jiraTemplateFile, viper.GetString("jira.descriptionTemplate"))
+	if descriptionFile == "" {
+		return nil, configError(fmt.Errorf("no jira description template: use --jtemp or set jira.descriptionTemplate"))
+	}
+
+	jiraTmpl, err := loadTemplate("jiraTemplate", descriptionFile, "")
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	//Get slack message template
+	slackTmpl, err := loadTemplate("slackTemplate", firstNonEmpty(opts.slackTemplateFile, viper.GetString("slack.messageTemplate")), defaultSlackTemplate)
+	if err != nil {
+		return nil, configError(err)
+	}
+
+	if err := validateCustomFields(); err != nil {
+		return nil, configError(err)
+	}
+
+	//Get the Block Kit layout unless plain text messages are configured
+	var blocksTmpl *template.Template
+	if useBlocks(viper.GetString("slack.format")) && notifierEnabled("slack") {
+		blocksTmpl, err = loadBlocksTemplate(firstNonEmpty(opts.blocksTemplate, viper.GetString("slack.blocksTemplate")))
+		if err != nil {
+			return nil, configError(err)
+		}
+	}
+
+	c := &creator{
+		api:          api,
+		tracker:      tr,
+		repoLookup:   repoLookup,
+		summaryTmpl:  summaryTmpl,
+		jiraTmpl:     jiraTmpl,
+		slackTmpl:    slackTmpl,
+		blocksTmpl:   blocksTmpl,
+		dryRun:       opts.dryRun,
+		labels:       issueLabels(opts.labels),
+		concurrency:  opts.concurrency,
+		subtasks:     subtasks,
+		trackerLimit: newRateLimiter(viper.GetFloat64(trackerKind() + ".requestsPerSecond")),
+		slackLimit:   newRateLimiter(viper.GetFloat64("slack.requestsPerSecond")),
+		slackUsers:   newSlackUsers(api),
+		slackGroups:  newSlackUsergroups(api),
+		rows:         rows,
+		excluded:     excluded,
+	}
+
+	c.notifiers, err = newNotifiers(api, c.slackLimit, c.slackUsers)
+	if err != nil {
+		c.Close()
+		return nil, configError(err)
+	}
+
+	//Group notifications to channels shared by several services in a thread
+	if viper.GetBool("slack.threadPerChannel") {
+		threads := newSlackThreads(rows, repoLookup)
+		for _, n := range c.notifiers.Notifiers() {
+			if slackN, ok := n.(*slackNotifier); ok {
+				slackN.threads = threads
+			}
+		}
+	}
+
+	//Assignees and epics are Jira features
+	if jt, isJira := tr.(*jiraTracker); isJira {
+		c.users = newJiraUsers(jt.client)
+	}
+
+	//Check the target projects before going ahead, so a bad config fails
+	//once up front instead of on every row. Dry runs preview offline too
+	if jt, isJira := tr.(*jiraTracker); isJira && viper.GetBool("jira.preflight") {
+		preflight := preflightOptions{labels: c.labels, subtasks: subtasks, createEpic: opts.createEpic != ""}
+		if err := preflightCreate(jt, rows, repoLookup, preflight); err != nil {
+			if !opts.dryRun {
+				c.Close()
+				return nil, configError(err)
+			}
+			slog.Warn("Preflight failed, going ahead with the dry run", "error", err)
+		}
+	}
+
+	c.ledger, err = openRunLedger()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close stops the rate limiters and closes the ledger.
+func (c *creator) Close() {
+
+	c.trackerLimit.Stop()
+	c.slackLimit.Stop()
+	if c.ledger != nil {
+		c.ledger.Close()
+	}
+}
+
+// prepare waits for the approval of the run, then finds or creates the
+// campaign epic and the other run-wide settings and assigns the run ID.
+func (c *creator) prepare(ctx context.Context, opts createOptions) error {
+
+	if err := c.approve(ctx); err != nil {
+		return err
+	}
+
+	jt, isJira := c.tracker.(*jiraTracker)
+
+	c.epic = firstNonEmpty(opts.epic, viper.GetString("jira.epic"))
+	if (c.epic != "" || opts.createEpic != "") && !isJira {
+		return fmt.Errorf("epics are only supported by the jira tracker")
+	}
+	if opts.sprint != "" && !isJira {
+		return fmt.Errorf("sprints are only supported by the jira tracker")
+	}
+	if opts.fixVersion != "" && !isJira {
+		return fmt.Errorf("fix versions are only supported by the jira tracker")
+	}
+	c.sprint = opts.sprint
+	c.fixVersion = firstNonEmpty(opts.fixVersion, viper.GetString("jira.fixVersion"))
+
+	if c.subtasks {
+		if !isJira {
+			return fmt.Errorf("subtasks are only supported by the jira tracker")
+		}
+		parents, err := newParentIssues()
+		if err != nil {
+			return configError(err)
+		}
+		c.parents = parents
+	}
+	if opts.createEpic != "" {
+		if c.epic != "" {
+			return fmt.Errorf("--epic and --create-epic cannot be used together")
+		}
+
+		if c.dryRun {
+			c.epic = fmt.Sprintf("(new epic %q)", opts.createEpic)
+		} else {
+			epic, err := createEpic(jt.client, viper.GetString("jira.projectKey"), opts.createEpic, c.labels)
+			if err != nil {
+				return err
+			}
+			c.epic = epic
+			slog.Info("Created epic", "epic", c.epic)
+		}
+	}
+
+	c.runID = newRunID()
+	c.startedAt = time.Now()
+	c.skipLedger = opts.ignoreLedger
+
+	switch opts.mode {
+	case "", "create":
+	case "upsert":
+		c.upsert = true
+	default:
+		return fmt.Errorf("unknown --mode %q, expected create or upsert", opts.mode)
+	}
+
+	return nil
+}
+
+// run processes the rows, then retries the notifications that failed.
+func (c *creator) run(ctx context.Context, rows []run.Row) []run.Result {
+
+	slog.Info("Starting run", "run", c.runID)
+
+	//Rows completed by an interrupted attempt are not processed again. Dry
+	//runs print to the terminal, so they get no progress bar
+	pending := 0
+	for _, row := range rows {
+		if _, ok := c.done[row.Repository]; !ok {
+			pending++
+		}
+	}
+	progress := newProgress(pending, !c.dryRun && viper.GetBool("progress.bar"))
+
+	record := func(result run.Result) {
+		c.record(result)
+		progress.Add(result)
+	}
+
+	runner := &run.Runner{Processor: c, Concurrency: c.concurrency, Done: c.done, OnResult: record}
+	results := runner.Run(ctx, rows)
+	progress.Finish()
+	c.retryNotifications(ctx, rows, results)
+
+	return append(results, c.excluded...)
+}
+
+// share posts the run summary and uploads the report in the given format to
+// the Slack channels configured for them.
+func (c *creator) share(results []run.Result, format string) {
+
+	if c.dryRun {
+		return
+	}
+
+	//Post a digest of the run for stakeholders
+	if channel := viper.GetString("slack.summaryChannel"); channel != "" {
+		postRunSummary(c.api, channel, c.runID, results)
+	}
+
+	//Share the report with program managers on Slack
+	if channel := viper.GetString("slack.reportChannel"); channel != "" {
+		if err := uploadRunReport(c.api, channel, c.runID, results, format); err != nil {
+			slog.Error("Unable to upload run report", "error", err)
+		}
+	}
+}
+
+// record counts a processed row and writes it to the checkpoint.
+func (c *creator) record(result run.Result) {
+
+	rowsProcessed.WithLabelValues(result.Status).Inc()
+
+	if c.checkpoint != nil {
+		if err := c.checkpoint.Record(c.runID, result); err != nil {
+			slog.Error("Unable to write checkpoint", "error", err)
+		}
+	}
+}
+
+// retryNotifications gives rows whose ticket was created but whose
+// notification failed one more attempt, after retry.notifyDelay. The ledger
+// already holds their ticket, so only the notification is sent again. An
+// interrupted run doesn't retry.
+func (c *creator) retryNotifications(ctx context.Context, rows []run.Row, results []run.Result) {
+
+	if c.dryRun || c.skipLedger || ctx.Err() != nil {
+		return
+	}
+
+	retry := []int{}
+	for i, result := range results {
+		var notifyErr *notifyError
+		if result.Status == run.StatusFailed && errors.As(result.Err, &notifyErr) {
+			retry = append(retry, i)
+		}
+	}
+
+	if len(retry) == 0 {
+		return
+	}
+
+	delay := viper.GetDuration("retry.notifyDelay")
+	slog.Info("Retrying failed notifications", "rows", len(retry), "delay", delay)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+
+	for _, i := range retry {
+		if ctx.Err() != nil {
+			return
+		}
+		results[i] = c.Process(rows[i])
+
+		if c.checkpoint != nil {
+			if err := c.checkpoint.Record(c.runID, results[i]); err != nil {
+				slog.Error("Unable to write checkpoint", "error", err)
+			}
+		}
+	}
+}
+
+// Process finds the service for a repository, creates its ticket and
+// notifies the team.
+func (c *creator) Process(row run.Row) run.Result {
+
+	itm := row.Repository
+	result := run.Result{Repository: itm}
+
+	service, ok := c.repoLookup.Find(itm)
+	if !ok {
+		catalogLookups.WithLabelValues("unmatched").Inc()
+		slog.Warn("No service found for repository", "repository", itm)
+		result.Status = run.StatusUnmatched
+		return result
+	}
+	catalogLookups.WithLabelValues("matched").Inc()
+
+	result.Service = service.ServiceId
+	result.Channel = slackChannelFor(service)
+
+	//Skip repositories a previous run already created a ticket for. When the
+	//team was never notified, or some notifiers failed, the ticket is reused
+	//and only the notifications are sent. In upsert mode the recorded ticket
+	//is updated instead.
+	var recorded *LedgerEntry
+	existing := ""
+	if !c.skipLedger {
+		entry, err := c.ledger.Get(itm)
+		if err != nil {
+			return failed(result, err)
+		}
+		notified := entry != nil && entry.SlackTs != "" && len(entry.PendingNotifiers) == 0
+		if notified && c.upsert {
+			existing = entry.JiraKey
+		} else if notified {
+			slog.Info("Skipping repository already processed", "repository", itm, "run", entry.RunID, "ticket", entry.JiraKey)
+			result.JiraKey = entry.JiraKey
+			result.Status = run.StatusSkipped
+			return result
+		} else {
+			recorded = entry
+		}
+	}
+
+	data := templateData(row, service)
+
+	summary, err := renderTemplate(c.summaryTmpl, data)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	description, err := renderTemplate(c.jiraTmpl, data)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	fields, err := customFields(data)
+	if err != nil {
+		return failed(result, err)
+	}
+	if err := setColumnFields(fields, row); err != nil {
+		return failed(result, err)
+	}
+
+	project, err := c.tracker.Project(service, itm)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	//Create Jira Issue
+	issue := tracker.Issue{
+		Name:        strings.TrimSpace(summary),
+		Type:        "Task",
+		ProjectKey:  project,
+		Description: description,
+		Repository:  itm,
+		Labels:      c.labels,
+		Components:  componentsFor(service),
+		Epic:        firstNonEmpty(rowField(row, "epic"), c.epic),
+		Sprint:      c.sprint,
+		FixVersion:  c.fixVersion,
+
+		CustomFields: fields,
+	}
+
+	if err := planningFields(&issue, row, c.startedAt); err != nil {
+		return failed(result, err)
+	}
+
+	//Group the service's repositories as subtasks of one parent ticket, which
+	//carries the epic and sprint
+	if c.parents != nil {
+		parent, err := c.parentFor(service, issue, data)
+		if err != nil {
+			return failed(result, err)
+		}
+		issue.Parent = parent
+		issue.Type = firstNonEmpty(viper.GetString("jira.subtaskType"), "Sub-task")
+		issue.Epic = ""
+		issue.Sprint = ""
+		data["jira_parent"] = parent
+	}
+
+	//Assign the ticket to someone on the owning team when configured
+	if email := teamAssigneeEmail(service); email != "" && c.users != nil {
+		c.trackerLimit.Wait()
+		assignee, err := c.users.Resolve(email)
+		if err != nil {
+			slog.Warn("Unable to resolve Jira user, leaving ticket unassigned", "email", email, "repository", itm, "error", err)
+		} else {
+			issue.Assignee = assignee
+		}
+	}
+
+	//Report the ticket as someone other than the token owner when configured
+	if viper.GetString("jira.reporter") != "" && c.users != nil {
+		c.trackerLimit.Wait()
+		reporter, err := c.users.reporterFor(service)
+		if err != nil {
+			slog.Warn("Unable to resolve reporter, leaving the default", "reporter", viper.GetString("jira.reporter"), "repository", itm, "error", err)
+		} else {
+			issue.Reporter = reporter
+		}
+	}
+
+	//Let the whole team follow the ticket in Jira
+	if viper.GetBool("jira.addTeamAsWatchers") && c.users != nil {
+		for _, email := range teamEmails(service.Team) {
+			c.trackerLimit.Wait()
+			watcher, err := c.users.Resolve(email)
+			if err != nil {
+				slog.Warn("Unable to resolve Jira user, not adding as watcher", "email", email, "repository", itm, "error", err)
+				continue
+			}
+			issue.Watchers = append(issue.Watchers, watcher)
+		}
+	}
+
+	//Look for a ticket created by a previous run before creating a new one
+	action := duplicateAction()
+	if c.upsert {
+		action = "update"
+	}
+
+	if action != "create" && recorded == nil && existing == "" {
+		c.trackerLimit.Wait()
+		existing, err = c.tracker.FindExisting(issue, itm)
+		if err != nil {
+			return failed(result, err)
+		}
+	}
+
+	if existing != "" {
+		result.JiraKey = existing
+
+		if c.plan != nil {
+			result.Status = run.StatusSkipped
+			if action == "update" {
+				c.plan.Add(plannedTicket{Action: "update", Row: row, Service: service, Issue: issue, Key: existing, Comment: c.upsert})
+				result.Status = run.StatusPlanned
+			}
+			return result
+		}
+
+		if c.dryRun {
+			fmt.Printf("----- %s -----\nExisting ticket %s, would %s\n\n", itm, existing, action)
+			result.Status = run.StatusDryRun
+			return result
+		}
+
+		if action == "update" {
+			c.trackerLimit.Wait()
+			if err := c.tracker.UpdateDescription(existing, issue.Description); err != nil {
+				return failed(result, err)
+			}
+			if c.upsert {
+				c.trackerLimit.Wait()
+				if err := c.tracker.Comment(existing, fmt.Sprintf("Description updated by imp run %s.", c.runID)); err != nil {
+					return failed(result, err)
+				}
+			}
+			slog.Info("Updated existing ticket", "ticket", existing, "repository", itm)
+			result.Status = run.StatusUpdated
+		} else {
+			slog.Info("Skipping repository with existing ticket", "repository", itm, "ticket", existing)
+			result.Status = run.StatusSkipped
+		}
+		return result
+	}
+
+	if recorded != nil {
+		slog.Info("Reusing ticket, notification was not sent", "ticket", recorded.JiraKey, "repository", itm, "notifiers", recorded.PendingNotifiers)
+		data["jira_ticket"] = recorded.JiraKey
+		data["jira_url"] = issueURL(recorded.JiraKey)
+		result.JiraKey = recorded.JiraKey
+	} else if c.plan != nil {
+		data["jira_ticket"] = planKeyPlaceholder
+		data["jira_url"] = planURLPlaceholder
+	} else if c.dryRun {
+		data["jira_ticket"] = "DRY-RUN"
+	} else {
+		c.trackerLimit.Wait()
+		key, err := c.tracker.CreateIssue(issue)
+		if err != nil {
+			return failed(result, err)
+		}
+		slog.Info("Created ticket", "ticket", key, "repository", itm)
+		ticketsCreated.Inc()
+
+		data["jira_ticket"] = key
+		data["jira_url"] = issueURL(key)
+		result.JiraKey = key
+
+		//Record the ticket straight away so a crash before the Slack post
+		//does not lead to a second ticket on the next run
+		entry := LedgerEntry{
+			RunID:        c.runID,
+			Repository:   itm,
+			Service:      service.ServiceId,
+			JiraKey:      key,
+			SlackChannel: result.Channel,
+			CreatedAt:    time.Now(),
+		}
+		if err := c.ledger.Record(entry); err != nil {
+			return failed(result, err)
+		}
+	}
+
+	//Mention the owning usergroup and team members so the notification is not missed
+	if notifierEnabled("slack") && (!c.dryRun || c.plan != nil) {
+		mentions := []string{}
+		if group := c.slackGroups.Mention(service.Team, c.slackLimit.Wait); group != "" {
+			data["usergroup"] = group
+			mentions = append(mentions, group)
+		}
+		if viper.GetBool("slack.mentionTeam") {
+			if members := c.slackUsers.Mentions(service.Team, c.slackLimit.Wait); members != "" {
+				mentions = append(mentions, members)
+			}
+		}
+		data["mentions"] = strings.Join(mentions, " ")
+	}
+
+	slackMsg, err := renderTemplate(c.slackTmpl, data)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	if mentions, _ := data["mentions"].(string); mentions != "" && !templateUses(c.slackTmpl, "mentions") {
+		slackMsg = mentions + "\n" + slackMsg
+	}
+
+	//Lay the message out as Block Kit, keeping the text as the fallback
+	var blocks []slack.Block
+	renderedBlocks := ""
+	if c.blocksTmpl != nil {
+		data["message"] = slackMsg
+		blocks, renderedBlocks, err = renderBlocks(c.blocksTmpl, data)
+		if err != nil {
+			return failed(result, err)
+		}
+	}
+
+	if c.plan != nil {
+		item := plannedTicket{Action: "create", Row: row, Service: service, Issue: issue, Channel: result.Channel, Message: slackMsg, Blocks: renderedBlocks}
+		item.Mentions, _ = data["mentions"].(string)
+		item.Usergroup, _ = data["usergroup"].(string)
+		if recorded != nil {
+			item.Action = "notify"
+			item.Key = recorded.JiraKey
+		}
+		c.plan.Add(item)
+		result.Status = run.StatusPlanned
+		return result
+	}
+
+	if c.dryRun {
+		printDryRun(itm, issue, result.Channel, slackMsg, renderedBlocks)
+		result.Status = run.StatusDryRun
+		return result
+	}
+
+	//Notify on the service's own Slack channel and any other configured notifiers
+	n := notify.Notification{
+		RunID:      c.runID,
+		Service:    service,
+		Repository: itm,
+		Channel:    result.Channel,
+		Text:       slackMsg,
+		Blocks:     blocks,
+		Data:       data,
+	}
+
+	if err := c.deliver(n, recorded); err != nil {
+		return failed(result, err)
+	}
+
+	result.Status = run.StatusCreated
+	return result
+}
+
+// deliver sends the notification of a repository's ticket, only to the
+// notifiers that failed last time when the ticket was recorded by an earlier
+// attempt, and records in the ledger which notifiers still have to be sent
+// to.
+func (c *creator) deliver(n notify.Notification, recorded *LedgerEntry) error {
+
+	//Every notifier is tried; only the ones that fail are sent to again
+	notifiers := c.notifiers
+	if recorded != nil && len(recorded.PendingNotifiers) > 0 {
+		notifiers = notifiers.Only(recorded.PendingNotifiers)
+	}
+	id, notifyErr := notifiers.Notify(n)
+
+	pending := []string{}
+	var fanOutErr *notify.FanOutError
+	if errors.As(notifyErr, &fanOutErr) {
+		pending = fanOutErr.Names
+	}
+
+	entry, err := c.ledger.Get(n.Repository)
+	if err == nil && entry != nil {
+		entry.SlackTs = firstNonEmpty(entry.SlackTs, id)
+		entry.PendingNotifiers = pending
+		err = c.ledger.Record(*entry)
+	}
+	if err != nil {
+		return err
+	}
+
+	if notifyErr != nil {
+		return &notifyError{err: notifyErr}
+	}
+
+	return nil
+}
+
+func failed(result run.Result, err error) run.Result {
+
+	slog.Error("Failed to process repository", "repository", result.Repository, "error", err)
+	result.Status = run.StatusFailed
+	result.Err = err
+	return result
+}
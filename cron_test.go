@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"*/30 8-18 * * 1,3,5", true},
+		{"0 9 * * MON-FRI", true},
+		{"0 0 1 jan-mar sun", true},
+		{"@weekly", true},
+		{"0 0 * * 7", true},
+		{"* * * *", false},
+		{"60 * * * *", false},
+		{"*/0 * * * *", false},
+		{"5-1 * * * *", false},
+		{"0 0 * foo *", false},
+		{"0 0 0 * *", false},
+		{"@fortnightly", false},
+	}
+
+	for _, test := range tests {
+		_, err := parseCron(test.expr)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("parseCron(%q) error = %v, want valid %v", test.expr, err, test.valid)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	//2026-10-16 is a Friday
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2026-10-16 10:07", "2026-10-16 10:15"},
+		{"*/15 * * * *", "2026-10-16 10:15", "2026-10-16 10:30"},
+		{"0 9 * * MON-FRI", "2026-10-16 09:00", "2026-10-19 09:00"},
+		{"@daily", "2026-10-16 23:59", "2026-10-17 00:00"},
+		{"0 0 * * 7", "2026-10-16 12:00", "2026-10-18 00:00"},
+		{"30 6 1 * *", "2026-12-15 00:00", "2027-01-01 06:30"},
+		//A restricted day of month or day of week is enough
+		{"0 0 1,15 * FRI", "2026-10-16 00:00", "2026-10-23 00:00"},
+		{"0 12 29 2 *", "2026-03-01 00:00", "2028-02-29 12:00"},
+	}
+
+	for _, test := range tests {
+		schedule, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", test.expr, err)
+		}
+		if got := schedule.Next(at(test.from)); !got.Equal(at(test.want)) {
+			t.Errorf("%q after %s = %s, want %s", test.expr, test.from, got.Format("2006-01-02 15:04"), test.want)
+		}
+	}
+}
+
+func TestCronNextImpossible(t *testing.T) {
+
+	schedule, err := parseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := schedule.Next(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("30 February matched %s", got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// dedupeRows collapses rows repeating a repository listed earlier, however
+// its URL is written, into the first of them, so a sloppy spreadsheet doesn't
+// get the same ticket created twice. Each collapsed repository is logged with
+// the rows it was listed on, counting from the first repository. With
+// warnServices, so is every service several repositories map to, which gets a
+// ticket per repository when they aren't subtasks of one per service.
+func dedupeRows(rows []run.Row, lookup catalog.Lookup, warnServices bool) []run.Row {
+
+	first := make(map[string]int)
+	collapsed := make(map[int][]string)
+	deduped := []run.Row{}
+	for i, row := range rows {
+		key := catalog.NormalizeRepoURL(row.Repository)
+		if key == "" {
+			deduped = append(deduped, row)
+			continue
+		}
+		if kept, ok := first[key]; ok {
+			collapsed[kept] = append(collapsed[kept], strconv.Itoa(i+1))
+			if !slices.Equal(rows[kept].Columns, row.Columns) {
+				slog.Warn("Duplicate repository has different columns, using the first row", "repository", row.Repository, "row", i+1, "first", kept+1)
+			}
+			continue
+		}
+		first[key] = i
+		deduped = append(deduped, row)
+	}
+
+	for i, row := range rows {
+		if duplicates, ok := collapsed[i]; ok {
+			slog.Warn("Collapsed duplicate repository", "repository", row.Repository, "row", i+1, "duplicates", strings.Join(duplicates, ","))
+		}
+	}
+
+	//Services in order of their first repository
+	services := []string{}
+	repositories := make(map[string][]string)
+	for _, row := range deduped {
+		service, ok := lookup.Find(row.Repository)
+		if !ok {
+			continue
+		}
+		if _, seen := repositories[service.ServiceId]; !seen {
+			services = append(services, service.ServiceId)
+		}
+		repositories[service.ServiceId] = append(repositories[service.ServiceId], row.Repository)
+	}
+	if warnServices {
+		for _, service := range services {
+			if len(repositories[service]) > 1 {
+				slog.Warn("Several repositories map to one service and each gets a ticket", "service", service, "repositories", strings.Join(repositories[service], ","))
+			}
+		}
+	}
+
+	if len(deduped) < len(rows) {
+		slog.Info("Collapsed duplicate repositories", "rows", len(rows), "repositories", len(deduped))
+	}
+
+	return deduped
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"reflect"
+	"testing"
+)
+
+func TestDedupeRows(t *testing.T) {
+
+	row := func(repository string, columns ...string) run.Row {
+		return run.Row{Repository: repository, Columns: columns}
+	}
+
+	tests := []struct {
+		name string
+		rows []run.Row
+		want []run.Row
+	}{
+		{
+			name: "no duplicates",
+			rows: []run.Row{row("https://github.com/org/a"), row("https://github.com/org/b")},
+			want: []run.Row{row("https://github.com/org/a"), row("https://github.com/org/b")},
+		},
+		{
+			name: "a and a.git",
+			rows: []run.Row{row("https://github.com/org/a"), row("https://github.com/org/a.git")},
+			want: []run.Row{row("https://github.com/org/a")},
+		},
+		{
+			name: "ssh, trailing slash and host case",
+			rows: []run.Row{row("git@github.com:org/a.git"), row("https://github.com/org/b"), row("https://GitHub.com/org/a/")},
+			want: []run.Row{row("git@github.com:org/a.git"), row("https://github.com/org/b")},
+		},
+		{
+			name: "first row wins",
+			rows: []run.Row{row("https://github.com/org/a", "High"), row("https://github.com/org/a", "Low")},
+			want: []run.Row{row("https://github.com/org/a", "High")},
+		},
+		{
+			name: "empty repositories are kept",
+			rows: []run.Row{row(""), row("")},
+			want: []run.Row{row(""), row("")},
+		},
+	}
+
+	lookup := catalog.NewLookup([]catalog.Service{
+		{ServiceId: "svc-a", RepositoryUrls: []string{"https://github.com/org/a", "https://github.com/org/b"}},
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := dedupeRows(test.rows, lookup, true); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("dedupeRows() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
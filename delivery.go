@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// deliverySchedule holds back Slack notifications sent outside working hours
+// and schedules them with chat.scheduleMessage for the start of the team's
+// next working day, so a nightly batch doesn't post in the middle of the
+// night. The team's timezone is taken from its lead's or members' Slack
+// profiles, falling back to slack.timezone.
+type deliverySchedule struct {
+	api          *slack.Client
+	start        time.Duration
+	end          time.Duration
+	skipWeekends bool
+	fallback     *time.Location
+
+	mu    sync.Mutex
+	zones map[string]*time.Location
+}
+
+// newDeliverySchedule returns the schedule configured by slack.deliverAt, or
+// nil when notifications are posted straight away.
+func newDeliverySchedule(api *slack.Client) (*deliverySchedule, error) {
+
+	deliverAt := viper.GetString("slack.deliverAt")
+	if deliverAt == "" {
+		return nil, nil
+	}
+
+	start, err := parseTimeOfDay("slack.deliverAt", deliverAt)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTimeOfDay("slack.deliverUntil", viper.GetString("slack.deliverUntil"))
+	if err != nil {
+		return nil, err
+	}
+	if end <= start {
+		return nil, fmt.Errorf("slack.deliverUntil must be later than slack.deliverAt")
+	}
+
+	fallback := time.Local
+	if name := viper.GetString("slack.timezone"); name != "" {
+		fallback, err = time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slack.timezone: %w", err)
+		}
+	}
+
+	return &deliverySchedule{
+		api:          api,
+		start:        start,
+		end:          end,
+		skipWeekends: viper.GetBool("slack.skipWeekends"),
+		fallback:     fallback,
+		zones:        make(map[string]*time.Location),
+	}, nil
+}
+
+// parseTimeOfDay parses an HH:MM time into the offset from midnight.
+func parseTimeOfDay(key string, value string) (time.Duration, error) {
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q, expected HH:MM", key, value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// postAt returns when a notification to the team should be delivered, or
+// false when it is within working hours and can be posted now.
+func (d *deliverySchedule) postAt(team catalog.Team, now time.Time, wait func()) (time.Time, bool) {
+
+	local := now.In(d.location(team, wait))
+
+	for day := 0; day < 7; day++ {
+		date := time.Date(local.Year(), local.Month(), local.Day()+day, 0, 0, 0, 0, local.Location())
+		if d.skipWeekends && (date.Weekday() == time.Saturday || date.Weekday() == time.Sunday) {
+			continue
+		}
+
+		open, closing := atTimeOfDay(date, d.start), atTimeOfDay(date, d.end)
+		if local.Before(open) {
+			return open, true
+		}
+		if local.Before(closing) {
+			return time.Time{}, false
+		}
+	}
+
+	//Only reachable with every day skipped, which the config can't express
+	return time.Time{}, false
+}
+
+// atTimeOfDay returns the wall clock time offset from midnight on date, so
+// daylight saving changes don't shift it.
+func atTimeOfDay(date time.Time, offset time.Duration) time.Time {
+
+	return time.Date(date.Year(), date.Month(), date.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, date.Location())
+}
+
+// location returns the team's timezone, looked up once per team.
+func (d *deliverySchedule) location(team catalog.Team, wait func()) *time.Location {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if loc, ok := d.zones[team.TeamId]; ok {
+		return loc
+	}
+
+	loc := d.fallback
+	for _, email := range teamEmails(team) {
+		wait()
+		user, err := d.api.GetUserByEmail(email)
+		if err != nil || user.TZ == "" {
+			continue
+		}
+		zone, err := time.LoadLocation(user.TZ)
+		if err != nil {
+			continue
+		}
+		loc = zone
+		break
+	}
+	slog.Debug("Resolved team timezone", "team", team.TeamId, "timezone", loc.String())
+
+	d.zones[team.TeamId] = loc
+
+	return loc
+}
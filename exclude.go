@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// exclusions are the repositories and services a run leaves out, by
+// repository path, such as org/name, and by service ID.
+type exclusions map[string]bool
+
+// loadExclusions reads the entries of --exclude and --exclude-file. The file
+// has one repository or service ID per line, in its first column, and may
+// have # comments.
+func loadExclusions(entries []string, fileName string) (exclusions, error) {
+
+	if fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8BOM)))
+		r.Comment = '#'
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude file %s: %w", fileName, err)
+		}
+		for _, record := range records {
+			entries = append(entries, record[0])
+		}
+	}
+
+	excluded := make(exclusions)
+	for _, entry := range entries {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			excluded[entry] = true
+			excluded[repoPath(entry)] = true
+		}
+	}
+
+	return excluded, nil
+}
+
+// Match reports whether a repository is excluded, itself or through the
+// service it belongs to.
+func (e exclusions) Match(repository string, lookup catalog.Lookup) bool {
+
+	if e[repoPath(repository)] {
+		return true
+	}
+
+	service, ok := lookup.Find(repository)
+
+	return ok && e[service.ServiceId]
+}
+
+// excludeRows drops the excluded rows, returning the rest and a result for
+// each excluded one so the report shows why it was left out.
+func excludeRows(rows []run.Row, lookup catalog.Lookup, e exclusions) ([]run.Row, []run.Result) {
+
+	if len(e) == 0 {
+		return rows, nil
+	}
+
+	selected := []run.Row{}
+	excluded := []run.Result{}
+	for _, row := range rows {
+		if !e.Match(row.Repository, lookup) {
+			selected = append(selected, row)
+			continue
+		}
+		excluded = append(excluded, excludedResult(row, lookup))
+	}
+
+	slog.Info("Excluded repositories", "excluded", len(excluded), "remaining", len(selected))
+
+	return selected, excluded
+}
+
+// excludedResult reports a row left out of the run.
+func excludedResult(row run.Row, lookup catalog.Lookup) run.Result {
+
+	service, _ := lookup.Find(row.Repository)
+
+	return run.Result{Repository: row.Repository, Service: service.ServiceId, Status: run.StatusExcluded}
+}
+
+// repoPath returns the path of a repository without its host, so that
+// https://github.com/org/x, github.com/org/x and org/x are the same entry.
+func repoPath(repository string) string {
+
+	repo := strings.TrimPrefix(catalog.NormalizeRepoURL(repository), "https://")
+	if host, path, ok := strings.Cut(repo, "/"); ok && strings.Contains(host, ".") {
+		repo = path
+	}
+
+	return strings.ToLower(repo)
+}
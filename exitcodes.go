@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+)
+
+// Exit codes, so pipelines wrapping imp can tell outcomes apart.
+const (
+	exitOK        = 0
+	exitFailure   = 1 // any other error
+	exitPartial   = 2 // some rows or tickets failed
+	exitConfig    = 3 // invalid config, flags or templates
+	exitCatalog   = 4 // the service catalog could not be fetched
+	exitNoMatches = 5 // no repository matched a service in the catalog, or the filter
+
+	exitInterrupted = 130 // stopped by Ctrl-C or SIGTERM, as shells report SIGINT
+)
+
+// exitError carries the exit code for an error returned by a command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// withExitCode tags err with an exit code. A nil error stays nil, and an
+// error that already has a code keeps it.
+func withExitCode(code int, err error) error {
+
+	var tagged *exitError
+	if err == nil || errors.As(err, &tagged) {
+		return err
+	}
+
+	return &exitError{code: code, err: err}
+}
+
+// configError tags err as a configuration error.
+func configError(err error) error {
+	return withExitCode(exitConfig, err)
+}
+
+// exitCode returns the exit code for the error returned by a command.
+func exitCode(err error) int {
+
+	if err == nil {
+		return exitOK
+	}
+
+	var tagged *exitError
+	if errors.As(err, &tagged) {
+		return tagged.code
+	}
+
+	return exitFailure
+}
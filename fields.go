@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"imp/pkg/tracker"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateLayout is the format of due dates in the config, the repository file
+// and Jira.
+const dateLayout = "2006-01-02"
+
+// relativeDatePattern matches due dates relative to the run, like +30d or +6w.
+var relativeDatePattern = regexp.MustCompile(`^\+(\d+)([dw])$`)
+
+// customFields returns the jira.customFields from the config with every string
+// in them, including those nested in objects and lists, rendered as a template
+// against the row data. Other values are passed to Jira as-is, so select
+// fields can be given as {value: "..."} and numeric fields as numbers.
+func customFields(data map[string]interface{}) (map[string]interface{}, error) {
+
+	fields := make(map[string]interface{})
+
+	for id, value := range configMap("jira.customFields") {
+		rendered, err := renderValue(id, value, data)
+		if err != nil {
+			return nil, fmt.Errorf("custom field %s: %w", id, err)
+		}
+		fields[id] = rendered
+	}
+
+	return fields, nil
+}
+
+// validateCustomFields checks that every template in jira.customFields parses
+// and that jira.columnFields is well formed.
+func validateCustomFields() error {
+
+	if _, err := customFields(nil); err != nil {
+		return err
+	}
+
+	_, err := columnFields()
+	return err
+}
+
+// columnField is a Jira field set from a column of the repository file by
+// jira.columnFields. Type is text, number or option.
+type columnField struct {
+	Field string
+	Type  string
+}
+
+// columnFields returns jira.columnFields, which maps column names to field
+// IDs, either directly as in wave: customfield_10040 or with the type of the
+// field as in wave: {field: customfield_10040, type: option}.
+func columnFields() (map[string]columnField, error) {
+
+	fields := make(map[string]columnField)
+
+	for column, value := range configMap("jira.columnFields") {
+		field := columnField{Type: "text"}
+		switch v := value.(type) {
+		case string:
+			field.Field = v
+		case map[string]interface{}:
+			field.Field = fmt.Sprint(v["field"])
+			if t, ok := v["type"]; ok {
+				field.Type = strings.ToLower(fmt.Sprint(t))
+			}
+		default:
+			return nil, fmt.Errorf("column field %s: expected a field ID or {field, type}", column)
+		}
+
+		if field.Field == "" || field.Field == "<nil>" {
+			return nil, fmt.Errorf("column field %s: no field ID", column)
+		}
+		switch field.Type {
+		case "text", "number", "option":
+		default:
+			return nil, fmt.Errorf("column field %s: invalid type %q, expected text, number or option", column, field.Type)
+		}
+
+		fields[column] = field
+	}
+
+	return fields, nil
+}
+
+// setColumnFields copies the row's columns named in jira.columnFields onto
+// their fields, over any value from jira.customFields. Rows with the column
+// empty leave the field alone.
+func setColumnFields(fields map[string]interface{}, row run.Row) error {
+
+	mapping, err := columnFields()
+	if err != nil {
+		return err
+	}
+
+	for column, field := range mapping {
+		value := rowField(row, column)
+		if value == "" {
+			continue
+		}
+
+		switch field.Type {
+		case "number":
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("column %s: %q is not a number", column, value)
+			}
+			fields[field.Field] = number
+		case "option":
+			fields[field.Field] = map[string]interface{}{"value": value}
+		default:
+			fields[field.Field] = value
+		}
+	}
+
+	return nil
+}
+
+// planningFields sets the priority, due date and story points of an issue from
+// jira.priority, jira.dueDate and jira.storyPoints, overridden per row by
+// priority, dueDate and storyPoints columns in the repository file.
+func planningFields(issue *tracker.Issue, row run.Row, now time.Time) error {
+
+	issue.Priority = firstNonEmpty(rowField(row, "priority"), viper.GetString("jira.priority"))
+
+	if due := firstNonEmpty(rowField(row, "dueDate", "due_date", "due"), viper.GetString("jira.dueDate")); due != "" {
+		date, err := parseDueDate(due, now)
+		if err != nil {
+			return err
+		}
+		issue.DueDate = date
+	}
+
+	if points := firstNonEmpty(rowField(row, "storyPoints", "story_points", "points"), viper.GetString("jira.storyPoints")); points != "" {
+		value, err := strconv.ParseFloat(points, 64)
+		if err != nil {
+			return fmt.Errorf("invalid story points %q", points)
+		}
+		issue.StoryPoints = value
+	}
+
+	return nil
+}
+
+// parseDueDate accepts a date as YYYY-MM-DD or relative to now as +Nd or
+// +Nw, and returns it as YYYY-MM-DD.
+func parseDueDate(value string, now time.Time) (string, error) {
+
+	value = strings.TrimSpace(value)
+
+	if match := relativeDatePattern.FindStringSubmatch(value); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			n *= 7
+		}
+		return now.AddDate(0, 0, n).Format(dateLayout), nil
+	}
+
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		return "", fmt.Errorf("invalid due date %q, expected YYYY-MM-DD or +Nd/+Nw", value)
+	}
+
+	return value, nil
+}
+
+// rowField returns the first non-empty column of the row with one of the
+// given header names, ignoring case.
+func rowField(row run.Row, names ...string) string {
+
+	for _, name := range names {
+		for header, value := range row.Fields {
+			if strings.EqualFold(header, name) && strings.TrimSpace(value) != "" {
+				return strings.TrimSpace(value)
+			}
+		}
+	}
+
+	return ""
+}
+
+func renderValue(name string, value interface{}, data map[string]interface{}) (interface{}, error) {
+
+	switch v := value.(type) {
+	case string:
+		tmpl, err := template.New(name).Funcs(templateFuncs).Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return v, nil
+		}
+		return renderTemplate(tmpl, data)
+
+	case map[string]interface{}:
+		rendered := make(map[string]interface{})
+		for key, itm := range v {
+			r, err := renderValue(name, itm, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+
+	case []interface{}:
+		rendered := []interface{}{}
+		for _, itm := range v {
+			r, err := renderValue(name, itm, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered = append(rendered, r)
+		}
+		return rendered, nil
+	}
+
+	return value, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCustomFieldsKeepKeyCase(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+jira:
+  customFields:
+    customfield_10010: {accountId: "{{.owner}}"}
+    customfield_10020: {value: Platform, child: {value: "{{.service}}"}}
+    fixVersions: [{name: "2026.1"}]
+  columnFields:
+    Wave: {field: customfield_10040, type: option}
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	rawConfig = readRawConfig(path)
+	defer func() { rawConfig = nil }()
+
+	got, err := customFields(map[string]interface{}{"owner": "5b10a2844c20165700ede21g", "service": "svc-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"customfield_10010": map[string]interface{}{"accountId": "5b10a2844c20165700ede21g"},
+		"customfield_10020": map[string]interface{}{"value": "Platform", "child": map[string]interface{}{"value": "svc-a"}},
+		"fixVersions":       []interface{}{map[string]interface{}{"name": "2026.1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("customFields() = %#v, want %#v", got, want)
+	}
+
+	columns, err := columnFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (columnField{Field: "customfield_10040", Type: "option"}); columns["Wave"] != want {
+		t.Errorf("columnFields() = %v, want Wave: %v", columns, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"path"
+	"strings"
+)
+
+// serviceFilter selects catalog services by key=value selectors, e.g.
+// team=platform, tier=1 or service=payments-*. Values are case insensitive
+// glob patterns. A service matches when it matches every key, and any of the
+// values given for a key.
+type serviceFilter map[string][]string
+
+// serviceFilterKeys are the keys a filter accepts.
+var serviceFilterKeys = []string{"team", "tier", "service", "channel", "language"}
+
+// parseServiceFilter parses key=value selectors.
+func parseServiceFilter(selectors []string) (serviceFilter, error) {
+
+	filter := make(serviceFilter)
+
+	for _, selector := range selectors {
+		key, value, ok := strings.Cut(selector, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected key=value", selector)
+		}
+
+		known := false
+		for _, k := range serviceFilterKeys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown filter key %q, expected one of %s", key, strings.Join(serviceFilterKeys, ", "))
+		}
+
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %w", value, err)
+		}
+
+		filter[key] = append(filter[key], strings.ToLower(value))
+	}
+
+	return filter, nil
+}
+
+// Match reports whether a service is selected by the filter. An empty filter
+// selects every service.
+func (f serviceFilter) Match(service catalog.Service) bool {
+
+	for key, patterns := range f {
+		value := ""
+		switch key {
+		case "team":
+			value = service.Team.TeamId
+		case "tier":
+			//tier=1 matches catalogs that name the tier tier_1 or Tier 1
+			value = strings.TrimLeft(strings.TrimPrefix(strings.ToLower(service.Tier), "tier"), "_- ")
+		case "service":
+			value = service.ServiceId
+		case "channel":
+			value = firstNonEmpty(service.SlackGeneralChannel.ChannelName, service.SlackGeneralChannel.ChannelId)
+		case "language":
+			value = service.Language
+		}
+
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, strings.ToLower(value)); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selectRows returns the rows whose service the filter selects, in order.
+// Repositories without a service in the catalog are left out too, since no
+// filter can match them.
+func selectRows(rows []run.Row, lookup catalog.Lookup, filter serviceFilter) []run.Row {
+
+	selected := []run.Row{}
+	for _, row := range rows {
+		if service, ok := lookup.Find(row.Repository); ok && filter.Match(service) {
+			selected = append(selected, row)
+		}
+	}
+
+	slog.Info("Filtered repositories", "selected", len(selected), "excluded", len(rows)-len(selected))
+
+	return selected
+}
+
+// sliceRows returns the part of the rows a staged rollout processes: limit
+// rows from offset, or sample rows spread evenly over the list. Both pick the
+// same rows every time, so a resumed run works on the same slice. Zero
+// values select every row.
+func sliceRows(rows []run.Row, offset int, limit int, sample int) ([]run.Row, error) {
+
+	if offset < 0 || limit < 0 || sample < 0 {
+		return nil, fmt.Errorf("--offset, --limit and --sample cannot be negative")
+	}
+	if sample > 0 && (offset > 0 || limit > 0) {
+		return nil, fmt.Errorf("--sample cannot be used with --offset or --limit")
+	}
+
+	total := len(rows)
+
+	if sample > 0 && sample < total {
+		//Every total/sample-th row, so the pilot covers the whole list
+		//rather than the services that happen to be listed first
+		sampled := make([]run.Row, sample)
+		for i := range sampled {
+			sampled[i] = rows[i*total/sample]
+		}
+		rows = sampled
+	}
+
+	if offset > 0 {
+		rows = rows[min(offset, len(rows)):]
+	}
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+
+	if len(rows) < total {
+		slog.Info("Processing part of the repositories", "selected", len(rows), "total", total)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"imp/pkg/run"
+	"reflect"
+	"testing"
+)
+
+func TestSliceRows(t *testing.T) {
+
+	rows := []run.Row{}
+	for i := 0; i < 10; i++ {
+		rows = append(rows, run.Row{Repository: fmt.Sprintf("r%d", i)})
+	}
+
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		sample int
+		want   []string
+		err    bool
+	}{
+		{name: "everything", want: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9"}},
+		{name: "limit", limit: 3, want: []string{"r0", "r1", "r2"}},
+		{name: "offset and limit", offset: 3, limit: 2, want: []string{"r3", "r4"}},
+		{name: "offset past the end", offset: 20, want: []string{}},
+		{name: "limit past the end", offset: 8, limit: 5, want: []string{"r8", "r9"}},
+		{name: "sample", sample: 3, want: []string{"r0", "r3", "r6"}},
+		{name: "sample of more than the rows", sample: 20, want: []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9"}},
+		{name: "negative", offset: -1, err: true},
+		{name: "sample with limit", sample: 2, limit: 1, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			sliced, err := sliceRows(rows, test.offset, test.limit, test.sample)
+			if test.err {
+				if err == nil {
+					t.Errorf("sliceRows() = %v, want an error", sliced)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, row := range sliced {
+				got = append(got, row.Repository)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sliceRows() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/tracker"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+
+	tracker.Register("github", func() (tracker.Tracker, error) {
+		return newGithubTracker(), nil
+	})
+}
+
+// githubTracker files tickets as GitHub issues in the repository itself.
+type githubTracker struct {
+	client  *http.Client
+	apiURL  string
+	token   string
+	webHost string
+}
+
+// githubIssue is the part of the GitHub issue resource imp uses.
+type githubIssue struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+// newGithubTracker creates a client for github.baseurl, api.github.com by
+// default or the /api/v3 URL of a GitHub Enterprise Server.
+func newGithubTracker() *githubTracker {
+
+	return &githubTracker{
+		client:  &http.Client{Transport: newRetryTransport(newMetricsTransport("github", nil))},
+		apiURL:  githubAPIURL(),
+		token:   viper.GetString("github.token"),
+		webHost: githubWebHost(),
+	}
+}
+
+// githubAPIURL returns the REST API root without a trailing slash.
+func githubAPIURL() string {
+
+	return strings.TrimRight(firstNonEmpty(viper.GetString("github.baseurl"), "https://api.github.com"), "/")
+}
+
+// githubWebHost returns the host repositories are browsed on, github.com for
+// the public API and the API host for GitHub Enterprise Server.
+func githubWebHost() string {
+
+	api, err := url.Parse(githubAPIURL())
+	if err != nil || api.Host == "api.github.com" {
+		return "github.com"
+	}
+
+	return api.Host
+}
+
+// githubIssueURL returns the browse URL of an issue key like org/repo#12.
+func githubIssueURL(key string) string {
+
+	repo, number, ok := strings.Cut(key, "#")
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("https://%s/%s/issues/%s", githubWebHost(), repo, number)
+}
+
+// githubRepoFromURL returns the owner/repo of a repository URL on the
+// configured GitHub host, accepting https and git@host:owner/repo forms.
+func githubRepoFromURL(repository string, host string) (string, error) {
+
+	var repoHost, path string
+	if rest, ok := strings.CutPrefix(repository, "git@"); ok {
+		repoHost, path, _ = strings.Cut(rest, ":")
+	} else {
+		parsed, err := url.Parse(repository)
+		if err != nil {
+			return "", fmt.Errorf("invalid repository url %q: %w", repository, err)
+		}
+		repoHost, path = parsed.Host, parsed.Path
+	}
+
+	if !strings.EqualFold(repoHost, host) {
+		return "", fmt.Errorf("repository %s is not on %s", repository, host)
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".git"), "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("repository url %q has no owner/repo", repository)
+	}
+
+	return parts[0] + "/" + parts[1], nil
+}
+
+func (t *githubTracker) Project(service catalog.Service, repository string) (string, error) {
+
+	return githubRepoFromURL(repository, t.webHost)
+}
+
+func (t *githubTracker) CreateIssue(issue tracker.Issue) (string, error) {
+
+	body := map[string]interface{}{
+		"title": issue.Name,
+		"body":  issue.Description,
+	}
+	if len(issue.Labels) > 0 {
+		body["labels"] = issue.Labels
+	}
+
+	var created githubIssue
+	if err := t.do(http.MethodPost, "/repos/"+issue.ProjectKey+"/issues", body, &created); err != nil {
+		return "", fmt.Errorf("unable to create issue in %s: %w", issue.ProjectKey, err)
+	}
+
+	return fmt.Sprintf("%s#%d", issue.ProjectKey, created.Number), nil
+}
+
+func (t *githubTracker) FindExisting(issue tracker.Issue, repository string) (string, error) {
+
+	query := fmt.Sprintf(`repo:%s is:issue is:open in:title "%s"`, issue.ProjectKey, strings.ReplaceAll(issue.Name, `"`, ""))
+	for _, label := range issue.Labels {
+		query += fmt.Sprintf(` label:"%s"`, label)
+	}
+
+	var found struct {
+		Items []githubIssue `json:"items"`
+	}
+	if err := t.do(http.MethodGet, "/search/issues?per_page=50&q="+url.QueryEscape(query), nil, &found); err != nil {
+		return "", fmt.Errorf("github search failed: %w", err)
+	}
+
+	//Search matches words, so confirm the title here
+	for _, itm := range found.Items {
+		if itm.Title == issue.Name {
+			return fmt.Sprintf("%s#%d", issue.ProjectKey, itm.Number), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (t *githubTracker) UpdateDescription(key string, description string) error {
+
+	repo, number, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid github issue %q", key)
+	}
+
+	body := map[string]interface{}{
+		"body": description,
+	}
+	if err := t.do(http.MethodPatch, "/repos/"+repo+"/issues/"+number, body, nil); err != nil {
+		return fmt.Errorf("unable to update %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (t *githubTracker) Comment(key string, body string) error {
+
+	repo, number, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid github issue %q", key)
+	}
+
+	comment := map[string]interface{}{
+		"body": body,
+	}
+	if err := t.do(http.MethodPost, "/repos/"+repo+"/issues/"+number+"/comments", comment, nil); err != nil {
+		return fmt.Errorf("unable to comment on %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Transition opens or closes an issue, GitHub issues having no other states.
+// Cancelled closes it as not planned.
+func (t *githubTracker) Transition(key string, name string) error {
+
+	repo, number, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid github issue %q", key)
+	}
+
+	var body map[string]interface{}
+	switch strings.ToLower(name) {
+	case "open", "opened", "reopen", "reopened":
+		body = map[string]interface{}{"state": "open"}
+	case "close", "closed", "done", "completed":
+		body = map[string]interface{}{"state": "closed", "state_reason": "completed"}
+	case "cancel", "cancelled", "canceled", "not planned", "not_planned":
+		body = map[string]interface{}{"state": "closed", "state_reason": "not_planned"}
+	default:
+		return fmt.Errorf("%s has no transition %q, available: open, closed, cancelled", key, name)
+	}
+
+	if err := t.do(http.MethodPatch, "/repos/"+repo+"/issues/"+number, body, nil); err != nil {
+		return fmt.Errorf("unable to transition %s to %s: %w", key, name, err)
+	}
+
+	return nil
+}
+
+// do sends a request to the GitHub API and decodes the response into out.
+func (t *githubTracker) do(method string, path string, body interface{}, out interface{}) error {
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, t.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	byteValue, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("github returned %s: %s", resp.Status, string(byteValue))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(byteValue, out)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"imp/pkg/run"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// githubRepoPageSize is the number of repositories fetched per request, the
+// most GitHub allows.
+const githubRepoPageSize = 100
+
+// githubRepository is the part of the GitHub repository resource imp uses.
+type githubRepository struct {
+	Name          string   `json:"name"`
+	HTMLURL       string   `json:"html_url"`
+	Language      string   `json:"language"`
+	Topics        []string `json:"topics"`
+	DefaultBranch string   `json:"default_branch"`
+	Archived      bool     `json:"archived"`
+}
+
+// readGithubOrg lists the repositories of --from-github-org that have every
+// --topic and one of the --language, leaving out archived repositories,
+// which can't take issues. Each row has the repository's name, language,
+// topics and defaultBranch as columns for templates.
+func readGithubOrg(org string, topics []string, languages []string) ([]run.Row, error) {
+
+	gh := newGithubTracker()
+
+	rows := []run.Row{}
+	archived := 0
+	for page := 1; ; page++ {
+		repos := []githubRepository{}
+		path := fmt.Sprintf("/orgs/%s/repos?type=all&per_page=%d&page=%d", url.PathEscape(org), githubRepoPageSize, page)
+		if err := gh.do(http.MethodGet, path, nil, &repos); err != nil {
+			return nil, fmt.Errorf("unable to list the repositories of %s: %w", org, err)
+		}
+
+		for _, repo := range repos {
+			if repo.Archived {
+				archived++
+				continue
+			}
+			if !hasTopics(repo.Topics, topics) || !hasLanguage(repo.Language, languages) {
+				continue
+			}
+
+			row := run.Row{
+				Repository: repo.HTMLURL,
+				Columns:    []string{repo.Name, repo.Language, strings.Join(repo.Topics, ","), repo.DefaultBranch},
+				Fields:     map[string]string{},
+			}
+			for i, name := range []string{"name", "language", "topics", "defaultBranch"} {
+				row.Fields[name] = row.Columns[i]
+			}
+			rows = append(rows, row)
+		}
+
+		if len(repos) < githubRepoPageSize {
+			break
+		}
+	}
+
+	slog.Info("Listed GitHub repositories", "org", org, "matched", len(rows), "archived", archived)
+
+	return rows, nil
+}
+
+// hasTopics reports whether a repository has every wanted topic.
+func hasTopics(topics []string, wanted []string) bool {
+
+	for _, w := range wanted {
+		found := false
+		for _, topic := range topics {
+			found = found || strings.EqualFold(topic, w)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasLanguage reports whether a repository's primary language is one of the
+// wanted ones, or whether any is wanted.
+func hasLanguage(language string, wanted []string) bool {
+
+	for _, w := range wanted {
+		if strings.EqualFold(language, w) {
+			return true
+		}
+	}
+
+	return len(wanted) == 0
+}
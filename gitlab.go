@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/tracker"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+
+	tracker.Register("gitlab", func() (tracker.Tracker, error) {
+		return newGitlabTracker(), nil
+	})
+}
+
+// gitlabTracker files tickets as GitLab issues in the repository's project.
+type gitlabTracker struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// gitlabIssue is the part of the GitLab issue resource imp uses.
+type gitlabIssue struct {
+	IID   int    `json:"iid"`
+	Title string `json:"title"`
+}
+
+// newGitlabTracker creates a client for gitlab.baseurl, gitlab.com by default
+// or a self-hosted instance.
+func newGitlabTracker() *gitlabTracker {
+
+	return &gitlabTracker{
+		client:  &http.Client{Transport: newRetryTransport(newMetricsTransport("gitlab", nil))},
+		baseURL: gitlabBaseURL(),
+		token:   viper.GetString("gitlab.token"),
+	}
+}
+
+// gitlabBaseURL returns the instance URL without a trailing slash.
+func gitlabBaseURL() string {
+
+	return strings.TrimRight(firstNonEmpty(viper.GetString("gitlab.baseurl"), "https://gitlab.com"), "/")
+}
+
+// gitlabIssueURL returns the browse URL of an issue key like group/project#12.
+func gitlabIssueURL(key string) string {
+
+	project, iid, ok := strings.Cut(key, "#")
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s/-/issues/%s", gitlabBaseURL(), project, iid)
+}
+
+// gitlabProjectFromURL returns the full project path, including any
+// subgroups, of a repository URL on the configured GitLab instance.
+func gitlabProjectFromURL(repository string) (string, error) {
+
+	base, err := url.Parse(gitlabBaseURL())
+	if err != nil {
+		return "", fmt.Errorf("invalid gitlab.baseurl: %w", err)
+	}
+
+	var repoHost, path string
+	if rest, ok := strings.CutPrefix(repository, "git@"); ok {
+		repoHost, path, _ = strings.Cut(rest, ":")
+	} else {
+		parsed, err := url.Parse(repository)
+		if err != nil {
+			return "", fmt.Errorf("invalid repository url %q: %w", repository, err)
+		}
+		repoHost, path = parsed.Host, parsed.Path
+	}
+
+	if !strings.EqualFold(repoHost, base.Host) {
+		return "", fmt.Errorf("repository %s is not on %s", repository, base.Host)
+	}
+
+	//Instances served under a path prefix, e.g. https://example.com/gitlab
+	path = strings.TrimPrefix(strings.Trim(path, "/"), strings.Trim(base.Path, "/"))
+
+	//Links into the repository such as /-/tree/main are not part of the path
+	path, _, _ = strings.Cut(path, "/-/")
+
+	project := strings.Trim(strings.TrimSuffix(path, ".git"), "/")
+	if !strings.Contains(project, "/") {
+		return "", fmt.Errorf("repository url %q has no group/project", repository)
+	}
+
+	return project, nil
+}
+
+func (t *gitlabTracker) Project(service catalog.Service, repository string) (string, error) {
+
+	return gitlabProjectFromURL(repository)
+}
+
+func (t *gitlabTracker) CreateIssue(issue tracker.Issue) (string, error) {
+
+	body := map[string]interface{}{
+		"title":       issue.Name,
+		"description": issue.Description,
+	}
+	if len(issue.Labels) > 0 {
+		body["labels"] = strings.Join(issue.Labels, ",")
+	}
+
+	var created gitlabIssue
+	if err := t.do(http.MethodPost, t.projectPath(issue.ProjectKey)+"/issues", body, &created); err != nil {
+		return "", fmt.Errorf("unable to create issue in %s: %w", issue.ProjectKey, err)
+	}
+
+	return fmt.Sprintf("%s#%d", issue.ProjectKey, created.IID), nil
+}
+
+func (t *gitlabTracker) FindExisting(issue tracker.Issue, repository string) (string, error) {
+
+	query := url.Values{}
+	query.Set("state", "opened")
+	query.Set("search", issue.Name)
+	query.Set("in", "title")
+	query.Set("per_page", "50")
+	if len(issue.Labels) > 0 {
+		query.Set("labels", strings.Join(issue.Labels, ","))
+	}
+
+	var found []gitlabIssue
+	if err := t.do(http.MethodGet, t.projectPath(issue.ProjectKey)+"/issues?"+query.Encode(), nil, &found); err != nil {
+		return "", fmt.Errorf("gitlab search failed: %w", err)
+	}
+
+	//Search matches words, so confirm the title here
+	for _, itm := range found {
+		if itm.Title == issue.Name {
+			return fmt.Sprintf("%s#%d", issue.ProjectKey, itm.IID), nil
+		}
+	}
+
+	return "", nil
+}
+
+func (t *gitlabTracker) UpdateDescription(key string, description string) error {
+
+	project, iid, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid gitlab issue %q", key)
+	}
+
+	body := map[string]interface{}{
+		"description": description,
+	}
+	if err := t.do(http.MethodPut, t.projectPath(project)+"/issues/"+iid, body, nil); err != nil {
+		return fmt.Errorf("unable to update %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (t *gitlabTracker) Comment(key string, body string) error {
+
+	project, iid, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid gitlab issue %q", key)
+	}
+
+	note := map[string]interface{}{
+		"body": body,
+	}
+	if err := t.do(http.MethodPost, t.projectPath(project)+"/issues/"+iid+"/notes", note, nil); err != nil {
+		return fmt.Errorf("unable to comment on %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Transition reopens or closes an issue, GitLab issues having no other
+// states.
+func (t *gitlabTracker) Transition(key string, name string) error {
+
+	project, iid, ok := strings.Cut(key, "#")
+	if !ok {
+		return fmt.Errorf("invalid gitlab issue %q", key)
+	}
+
+	event := ""
+	switch strings.ToLower(name) {
+	case "open", "opened", "reopen", "reopened":
+		event = "reopen"
+	case "close", "closed", "done", "cancel", "cancelled", "canceled":
+		event = "close"
+	default:
+		return fmt.Errorf("%s has no transition %q, available: opened, closed", key, name)
+	}
+
+	body := map[string]interface{}{
+		"state_event": event,
+	}
+	if err := t.do(http.MethodPut, t.projectPath(project)+"/issues/"+iid, body, nil); err != nil {
+		return fmt.Errorf("unable to transition %s to %s: %w", key, name, err)
+	}
+
+	return nil
+}
+
+// projectPath returns the API path of a project, addressed by its encoded
+// full path.
+func (t *gitlabTracker) projectPath(project string) string {
+
+	return "/projects/" + url.PathEscape(project)
+}
+
+// do sends a request to the GitLab API and decodes the response into out.
+func (t *gitlabTracker) do(method string, path string, body interface{}, out interface{}) error {
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, t.baseURL+"/api/v4"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if t.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", t.token)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	byteValue, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("gitlab returned %s: %s", resp.Status, string(byteValue))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(byteValue, out)
+}
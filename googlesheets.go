@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// googleSheetPrefix refers to a Google Sheet by ID, as in gsheet:<id>.
+const googleSheetPrefix = "gsheet:"
+
+// Scopes of the service account token, read only unless keys are written
+// back.
+const (
+	sheetsReadScope  = "https://www.googleapis.com/auth/spreadsheets.readonly"
+	sheetsWriteScope = "https://www.googleapis.com/auth/spreadsheets"
+)
+
+// googleSheetURL matches the URL of a sheet in the browser, with the tab in
+// its gid parameter.
+var googleSheetURL = regexp.MustCompile(`^https://docs\.google\.com/spreadsheets/d/([A-Za-z0-9_-]+)(?:[^#?]*)?(?:[?#].*?gid=([0-9]+))?`)
+
+// googleSheetRef identifies a spreadsheet and the tab the repositories are
+// in, by gid when taken from a URL.
+type googleSheetRef struct {
+	ID  string
+	GID string
+}
+
+// googleServiceAccount is the part of a service account key file imp uses.
+type googleServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// googleSheets calls the Sheets API as a service account.
+type googleSheets struct {
+	client   *http.Client
+	endpoint string
+	token    string
+}
+
+// parseGoogleSheet reports whether a repository file argument is a Google
+// Sheet, given by URL or as gsheet:<id>.
+func parseGoogleSheet(fileName string) (googleSheetRef, bool) {
+
+	if id, ok := strings.CutPrefix(fileName, googleSheetPrefix); ok && id != "" {
+		return googleSheetRef{ID: id}, true
+	}
+
+	if m := googleSheetURL.FindStringSubmatch(fileName); m != nil {
+		return googleSheetRef{ID: m[1], GID: m[2]}, true
+	}
+
+	return googleSheetRef{}, false
+}
+
+// readGoogleSheet returns the cells of the sheet's repository tab as text.
+func readGoogleSheet(ref googleSheetRef) ([][]string, error) {
+
+	sheets, err := newGoogleSheets(sheetsReadScope)
+	if err != nil {
+		return nil, err
+	}
+
+	title, err := sheets.title(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return sheets.values(ref.ID, title)
+}
+
+// writeSheetKeys writes the ticket key of every processed repository into
+// the column to the right of the repository column. The tab is read again
+// first, so rows moved while the run went on still get the right key.
+func writeSheetKeys(ref googleSheetRef, results []run.Result) error {
+
+	sheets, err := newGoogleSheets(sheetsWriteScope)
+	if err != nil {
+		return err
+	}
+
+	title, err := sheets.title(ref)
+	if err != nil {
+		return err
+	}
+
+	records, err := sheets.values(ref.ID, title)
+	if err != nil {
+		return err
+	}
+
+	//Cleaning trims the cells in place, the rows keep their numbers
+	_, repoIndex, err := repositoryColumn(cleanRecords(records))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]string)
+	for _, result := range results {
+		if result.JiraKey != "" {
+			keys[result.Repository] = result.JiraKey
+		}
+	}
+
+	data := []map[string]interface{}{}
+	for i, record := range records {
+		if repoIndex >= len(record) {
+			continue
+		}
+		if key, ok := keys[record[repoIndex]]; ok {
+			cell := fmt.Sprintf("%s!%s%d", quoteSheetTitle(title), columnLetters(repoIndex+1), i+1)
+			data = append(data, map[string]interface{}{"range": cell, "values": [][]string{{key}}})
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	body := map[string]interface{}{"valueInputOption": "RAW", "data": data}
+	if err := sheets.call(http.MethodPost, "/v4/spreadsheets/"+url.PathEscape(ref.ID)+"/values:batchUpdate", body, nil); err != nil {
+		return fmt.Errorf("unable to write ticket keys to the sheet: %w", err)
+	}
+	slog.Info("Wrote ticket keys to the sheet", "sheet", title, "rows", len(data))
+
+	return nil
+}
+
+// newGoogleSheets authenticates with the service account key in
+// google.credentialsFile or GOOGLE_APPLICATION_CREDENTIALS.
+func newGoogleSheets(scope string) (*googleSheets, error) {
+
+	fileName := firstNonEmpty(viper.GetString("google.credentialsFile"), os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if fileName == "" {
+		return nil, fmt.Errorf("google sheets need a service account key: set google.credentialsFile or GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var account googleServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("invalid service account key %s: %w", fileName, err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("invalid service account key %s: no client_email or private_key", fileName)
+	}
+
+	s := &googleSheets{
+		client:   &http.Client{Transport: newRetryTransport(newMetricsTransport("google", nil))},
+		endpoint: strings.TrimSuffix(firstNonEmpty(viper.GetString("google.sheetsURL"), "https://sheets.googleapis.com"), "/"),
+	}
+
+	s.token, err = googleAccessToken(s.client, account, scope, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// googleAccessToken exchanges a JWT signed with the service account's key
+// for an access token.
+func googleAccessToken(client *http.Client, account googleServiceAccount, scope string, now time.Time) (string, error) {
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid service account private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not an rsa key")
+	}
+
+	tokenURI := firstNonEmpty(account.TokenURI, "https://oauth2.googleapis.com/token")
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	resp, err := client.PostForm(tokenURI, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("google token exchange returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// title returns the title of the tab holding the repositories: the one
+// named by --sheet, by name or zero-based index, the one in the URL, or the
+// first.
+func (s *googleSheets) title(ref googleSheetRef) (string, error) {
+
+	var spreadsheet struct {
+		Sheets []struct {
+			Properties struct {
+				SheetID int    `json:"sheetId"`
+				Title   string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := s.call(http.MethodGet, "/v4/spreadsheets/"+url.PathEscape(ref.ID)+"?fields=sheets.properties", nil, &spreadsheet); err != nil {
+		return "", fmt.Errorf("unable to read spreadsheet %s: %w", ref.ID, err)
+	}
+
+	titles := []string{}
+	for i, sheet := range spreadsheet.Sheets {
+		p := sheet.Properties
+		titles = append(titles, p.Title)
+
+		switch {
+		case inputFlags.sheet != "":
+			if strings.EqualFold(p.Title, inputFlags.sheet) || inputFlags.sheet == strconv.Itoa(i) {
+				return p.Title, nil
+			}
+		case ref.GID != "":
+			if strconv.Itoa(p.SheetID) == ref.GID {
+				return p.Title, nil
+			}
+		default:
+			return p.Title, nil
+		}
+	}
+
+	return "", fmt.Errorf("sheet %q not found in spreadsheet %s, it has %s", firstNonEmpty(inputFlags.sheet, "gid="+ref.GID), ref.ID, strings.Join(titles, ", "))
+}
+
+// values returns the cells of a tab as displayed.
+func (s *googleSheets) values(id string, title string) ([][]string, error) {
+
+	var out struct {
+		Values [][]string `json:"values"`
+	}
+	path := "/v4/spreadsheets/" + url.PathEscape(id) + "/values/" + url.PathEscape(quoteSheetTitle(title))
+	if err := s.call(http.MethodGet, path, nil, &out); err != nil {
+		return nil, fmt.Errorf("unable to read sheet %s: %w", title, err)
+	}
+
+	return out.Values, nil
+}
+
+// call sends a request to the Sheets API and decodes the response into out
+// when it is given.
+func (s *googleSheets) call(method string, path string, input interface{}, out interface{}) error {
+
+	var body io.Reader
+	if input != nil {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, s.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("google sheets returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// quoteSheetTitle quotes a tab title for use in A1 notation.
+func quoteSheetTitle(title string) string {
+
+	return "'" + strings.ReplaceAll(title, "'", "''") + "'"
+}
+
+// columnLetters returns the A1 letters of a zero-based column.
+func columnLetters(column int) string {
+
+	letters := ""
+	for column++; column > 0; column = (column - 1) / 26 {
+		letters = string(rune('A'+(column-1)%26)) + letters
+	}
+
+	return letters
+}
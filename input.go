@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/spf13/pflag"
+	"imp/pkg/run"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// inputFlags are shared by every command that reads a repository file.
+var inputFlags struct {
+	repoColumn string
+	sheet      string
+	githubOrg  string
+	all        bool
+	topics     []string
+	languages  []string
+}
+
+func addInputFlags(flags *pflag.FlagSet) {
+
+	//Column holding the repository, by header name or zero-based index
+	flags.StringVar(&inputFlags.repoColumn, "repo-column", "", "repository column, by header name or zero-based index (default first column)")
+
+	//Sheet of an Excel workbook holding the repositories
+	flags.StringVar(&inputFlags.sheet, "sheet", "", "sheet of an xlsx file, by name or zero-based index (default first sheet)")
+
+	//Every repository of the catalog instead of a file, narrowed by --filter
+	flags.BoolVar(&inputFlags.all, "all", false, "use every repository of the catalog services, or of those matching --filter, instead of a file")
+
+	//Repositories listed from GitHub instead of a file
+	flags.StringVar(&inputFlags.githubOrg, "from-github-org", "", "use the repositories of this github organization instead of a file")
+	flags.StringSliceVar(&inputFlags.topics, "topic", nil, "with --from-github-org, only repositories with all these topics")
+	flags.StringSliceVar(&inputFlags.languages, "language", nil, "with --from-github-org, only repositories in one of these languages")
+}
+
+// repositoryFileArg returns the repository file given either with --file or
+// as the command's only argument. "-" reads from stdin. With
+// --from-github-org or --all there is no file and the name is empty.
+func repositoryFileArg(flagValue string, args []string) (string, error) {
+
+	if inputFlags.all && inputFlags.githubOrg != "" {
+		return "", fmt.Errorf("give either --all or --from-github-org, not both")
+	}
+
+	if inputFlags.githubOrg != "" || inputFlags.all {
+		if flagValue != "" || len(args) > 0 {
+			return "", fmt.Errorf("give either a repository file or --from-github-org or --all, not both")
+		}
+		return "", nil
+	}
+
+	if len(args) > 0 {
+		if flagValue != "" && flagValue != args[0] {
+			return "", fmt.Errorf("repository file given both as --file and as an argument")
+		}
+		return args[0], nil
+	}
+
+	if flagValue == "" {
+		return "", fmt.Errorf("no repositories specified: use --file, --from-github-org, --all or pass the file (or - for stdin) as an argument")
+	}
+
+	return flagValue, nil
+}
+
+// readRepositoryFile reads the repository file, stdin when fileName is "-",
+// a Google Sheet when fileName is its URL, or the repositories of
+// --from-github-org or of the catalog with --all when there is no file. Files ending in .json, .yaml or
+// .yml are read as a list of objects. Otherwise a header row is detected when
+// none of the first row's cells look like a repository, and is required to
+// select the repository column by name.
+func readRepositoryFile(fileName string) ([]run.Row, error) {
+
+	if fileName == "" && inputFlags.githubOrg != "" {
+		return readGithubOrg(inputFlags.githubOrg, inputFlags.topics, inputFlags.languages)
+	}
+
+	if fileName == "" && inputFlags.all {
+		return readCatalogRepositories()
+	}
+
+	if ref, ok := parseGoogleSheet(fileName); ok {
+		records, err := readGoogleSheet(ref)
+		if err != nil {
+			return nil, err
+		}
+		return repositoryRows(records)
+	}
+
+	if isStructuredFile(fileName) {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		return readStructuredRepositories(fileName, data)
+	}
+
+	var in io.Reader = os.Stdin
+	if fileName != "-" {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	return readRepositories(in)
+}
+
+// readCatalogRepositories returns a row for every repository of every
+// catalog service, in catalog order. Templates get the service's language.
+func readCatalogRepositories() ([]run.Row, error) {
+
+	services, err := fetchServices(catalogFile)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []run.Row{}
+	for _, service := range services {
+		if len(service.RepositoryUrls) == 0 {
+			slog.Debug("Catalog service has no repositories", "service", service.ServiceId)
+		}
+		for _, repository := range service.RepositoryUrls {
+			rows = append(rows, run.Row{
+				Repository: repository,
+				Columns:    []string{service.Language},
+				Fields:     map[string]string{"language": service.Language},
+			})
+		}
+	}
+
+	slog.Info("Listed catalog repositories", "services", len(services), "repositories", len(rows))
+
+	return rows, nil
+}
+
+// utf8BOM starts text files saved by Excel as "CSV UTF-8".
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// readRepositories reads repository rows in the format of the repository
+// file, a CSV file or an Excel workbook.
+func readRepositories(in io.Reader) ([]run.Row, error) {
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	var records [][]string
+	if bytes.HasPrefix(data, xlsxSignature) {
+		records, err = readXLSX(data, inputFlags.sheet)
+	} else {
+		r := csv.NewReader(bytes.NewReader(data))
+		r.Comma = ','
+		r.Comment = '#'
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		records, err = r.ReadAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repositoryRows(records)
+}
+
+// repositoryRows turns the records of a repository file into rows. Cells are
+// trimmed, and empty rows, rows without a repository and # comments are left
+// out, so a stray line in a spreadsheet export doesn't become a ticket.
+func repositoryRows(records [][]string) ([]run.Row, error) {
+
+	records = cleanRecords(records)
+
+	header, repoIndex, err := repositoryColumn(records)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		records = records[1:]
+	}
+
+	repositories := []run.Row{}
+
+	for _, itm := range records {
+		if repoIndex >= len(itm) || itm[repoIndex] == "" {
+			continue
+		}
+
+		row := run.Row{
+			Repository: itm[repoIndex],
+			Columns:    []string{},
+			Fields:     make(map[string]string),
+		}
+
+		for i, value := range itm {
+			if i == repoIndex {
+				continue
+			}
+			row.Columns = append(row.Columns, value)
+			if i < len(header) && header[i] != "" {
+				row.Fields[header[i]] = value
+			}
+		}
+
+		repositories = append(repositories, row)
+	}
+
+	return repositories, nil
+}
+
+// cleanRecords trims every cell and drops empty and commented out records.
+func cleanRecords(records [][]string) [][]string {
+
+	cleaned := [][]string{}
+	for _, record := range records {
+		blank := true
+		for i, cell := range record {
+			record[i] = strings.TrimSpace(cell)
+			blank = blank && record[i] == ""
+		}
+		if blank || strings.HasPrefix(record[0], "#") {
+			continue
+		}
+		cleaned = append(cleaned, record)
+	}
+
+	return cleaned
+}
+
+// repositoryColumn returns the header row of the records, nil when they have
+// none, and the index of the repository column.
+func repositoryColumn(records [][]string) ([]string, int, error) {
+
+	var header []string
+	if len(records) > 0 && isHeaderRow(records[0]) {
+		header = records[0]
+	}
+
+	repoIndex, err := repoColumnIndex(inputFlags.repoColumn, header)
+
+	return header, repoIndex, err
+}
+
+// isHeaderRow reports whether a row looks like column names rather than data:
+// no cell contains something resembling a repository URL or path.
+func isHeaderRow(row []string) bool {
+
+	for _, cell := range row {
+		if looksLikeRepository(cell) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func looksLikeRepository(value string) bool {
+	return strings.Contains(value, "/") || strings.HasPrefix(value, "git@")
+}
+
+// repoColumnIndex resolves --repo-column against the header.
+func repoColumnIndex(column string, header []string) (int, error) {
+
+	if column == "" {
+		return 0, nil
+	}
+
+	if index, err := strconv.Atoi(column); err == nil {
+		if index < 0 {
+			return 0, fmt.Errorf("invalid repository column %d", index)
+		}
+		return index, nil
+	}
+
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, nil
+		}
+	}
+
+	if header == nil {
+		return 0, fmt.Errorf("repository column %q given by name but the file has no header row", column)
+	}
+
+	return 0, fmt.Errorf("repository column %q not found in header %v", column, header)
+}
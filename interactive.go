@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// pickerHelp is the first line of the --interactive selector.
+const pickerHelp = "Select the repositories to process: space toggles, a selects all, n none, enter continues, q cancels"
+
+// picker is the state of the --interactive row selector.
+type picker struct {
+	rows     []run.Row
+	lines    []string
+	selected []bool
+	cursor   int
+	top      int
+	page     int
+}
+
+// pickRows lets the operator tick the rows to process on the terminal, with
+// each row's service and team, when the list is known to be partly stale. It
+// returns the rows kept and those left out. The terminal is put in raw mode
+// with stty, as stdin may hold the repository list.
+func pickRows(rows []run.Row, lookup catalog.Lookup) ([]run.Row, []run.Row, error) {
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no terminal for --interactive")
+	}
+	defer tty.Close()
+
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the terminal settings: %w", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, nil, fmt.Errorf("unable to set up the terminal: %w", err)
+	}
+	defer stty(tty, state)
+
+	//Draw on the alternate screen so the log lines are back afterwards
+	fmt.Fprint(tty, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(tty, "\033[?25h\033[?1049l")
+
+	p := newPicker(rows, lookup)
+	buf := make([]byte, 16)
+	for {
+		height, width := terminalSize(tty)
+		fmt.Fprint(tty, p.render(height, width))
+
+		n, err := tty.Read(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch string(buf[:n]) {
+		case "\033[A", "k":
+			p.move(-1)
+		case "\033[B", "j":
+			p.move(1)
+		case "\033[5~":
+			p.move(-p.page)
+		case "\033[6~":
+			p.move(p.page)
+		case " ", "x":
+			p.selected[p.cursor] = !p.selected[p.cursor]
+		case "a", "n":
+			for i := range p.selected {
+				p.selected[i] = buf[0] == 'a'
+			}
+		case "\r", "\n":
+			kept, dropped := p.split()
+			return kept, dropped, nil
+		case "q", "\003", "\033":
+			return nil, nil, fmt.Errorf("aborted")
+		}
+	}
+}
+
+// newPicker lays out a line per row with its service and team, every row
+// selected.
+func newPicker(rows []run.Row, lookup catalog.Lookup) *picker {
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		service, ok := lookup.Find(row.Repository)
+		if !ok {
+			fmt.Fprintf(w, "%s\t(no service)\t\n", row.Repository)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row.Repository, service.ServiceId, service.Team.TeamId)
+	}
+	w.Flush()
+
+	p := &picker{
+		rows:     rows,
+		lines:    strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"),
+		selected: make([]bool, len(rows)),
+		page:     1,
+	}
+	for i := range p.selected {
+		p.selected[i] = true
+	}
+
+	return p
+}
+
+// move moves the cursor by delta rows, staying on the list.
+func (p *picker) move(delta int) {
+
+	p.cursor = max(0, min(len(p.rows)-1, p.cursor+delta))
+}
+
+// render draws the selector for a terminal of the given size, scrolled so
+// the cursor is in view.
+func (p *picker) render(height int, width int) string {
+
+	//Help, count and a blank line above the rows
+	p.page = max(1, height-3)
+	if p.cursor < p.top {
+		p.top = p.cursor
+	}
+	if p.cursor >= p.top+p.page {
+		p.top = p.cursor - p.page + 1
+	}
+
+	count := 0
+	for _, selected := range p.selected {
+		if selected {
+			count++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H\033[2J")
+	b.WriteString(truncate(pickerHelp, width) + "\r\n")
+	b.WriteString(fmt.Sprintf("%d of %d selected\r\n\r\n", count, len(p.rows)))
+
+	for i := p.top; i < len(p.rows) && i < p.top+p.page; i++ {
+		line := "  [ ] "
+		if p.selected[i] {
+			line = "  [x] "
+		}
+		if i == p.cursor {
+			line = ">" + line[1:]
+		}
+		line = truncate(line+p.lines[i], width)
+		if i == p.cursor {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		b.WriteString(line + "\r\n")
+	}
+
+	return b.String()
+}
+
+// split returns the selected rows and the others, in input order.
+func (p *picker) split() ([]run.Row, []run.Row) {
+
+	kept := []run.Row{}
+	dropped := []run.Row{}
+	for i, row := range p.rows {
+		if p.selected[i] {
+			kept = append(kept, row)
+		} else {
+			dropped = append(dropped, row)
+		}
+	}
+
+	return kept, dropped
+}
+
+// stty runs stty on the terminal and returns its output.
+func stty(tty *os.File, args ...string) (string, error) {
+
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the rows and columns of the terminal, 24 by 80 when
+// stty can't tell.
+func terminalSize(tty *os.File) (int, int) {
+
+	out, err := stty(tty, "size")
+	if err != nil {
+		return 24, 80
+	}
+
+	size := strings.Fields(out)
+	if len(size) != 2 {
+		return 24, 80
+	}
+	height, err1 := strconv.Atoi(size[0])
+	width, err2 := strconv.Atoi(size[1])
+	if err1 != nil || err2 != nil || height <= 0 || width <= 0 {
+		return 24, 80
+	}
+
+	return height, width
+}
+
+// truncate cuts a line to the width of the terminal.
+func truncate(line string, width int) string {
+
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+
+	return string([]rune(line)[:width])
+}
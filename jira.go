@@ -0,0 +1,595 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/tracker"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newJiraClient creates a Jira client authenticated with jira.user and
+// jira.token, or with jira.token alone as a personal access token when
+// jira.auth is pat.
+func newJiraClient() (*jira.Client, error) {
+
+	transport := newRetryTransport(newMetricsTransport("jira", nil))
+
+	switch auth := strings.ToLower(viper.GetString("jira.auth")); auth {
+	case "", "basic":
+		tp := jira.BasicAuthTransport{
+			Username:  viper.GetString("jira.user"),
+			Password:  viper.GetString("jira.token"),
+			Transport: transport,
+		}
+		return jira.NewClient(tp.Client(), viper.GetString("jira.baseurl"))
+	case "pat":
+		tp := jira.PATAuthTransport{
+			Token:     viper.GetString("jira.token"),
+			Transport: transport,
+		}
+		return jira.NewClient(tp.Client(), viper.GetString("jira.baseurl"))
+	default:
+		return nil, fmt.Errorf("unknown jira.auth %q, expected basic or pat", auth)
+	}
+}
+
+func init() {
+
+	tracker.Register("jira", func() (tracker.Tracker, error) {
+		client, err := newJiraClient()
+		if err != nil {
+			return nil, err
+		}
+		return &jiraTracker{client: client}, nil
+	})
+}
+
+// jiraTracker files tickets in Jira.
+type jiraTracker struct {
+	client *jira.Client
+
+	//Projects, component names known to exist, fix versions known to
+	//exist and active sprints, by project key
+	mu         sync.Mutex
+	projects   map[string]*jira.Project
+	components map[string]map[string]bool
+	versions   map[string]map[string]bool
+	sprints    map[string]int
+}
+
+func (t *jiraTracker) Project(service catalog.Service, repository string) (string, error) {
+
+	return projectKeyFor(service), nil
+}
+
+func (t *jiraTracker) CreateIssue(issue tracker.Issue) (string, error) {
+
+	if viper.GetBool("jira.createComponents") && len(issue.Components) > 0 {
+		issue.Components = t.ensureComponents(issue.ProjectKey, issue.Components)
+	}
+
+	if issue.FixVersion != "" {
+		if err := t.ensureVersion(issue.ProjectKey, issue.FixVersion); err != nil {
+			return "", err
+		}
+	}
+
+	issue.Description = jiraText(issue.Description)
+	created, err := addIssue(t.client, issue)
+	if err != nil {
+		return "", err
+	}
+
+	//The ticket exists at this point, so a missing link is only worth a warning
+	if viper.GetBool("jira.remoteLink") && issue.Repository != "" {
+		if err := addRepositoryLink(t.client, created.Key, issue.Repository); err != nil {
+			slog.Warn("Unable to link ticket to repository", "ticket", created.Key, "repository", issue.Repository, "error", err)
+		}
+	}
+
+	//Move the ticket out of the project's initial status, e.g. Draft
+	if status := viper.GetString("jira.initialTransition"); status != "" {
+		if err := transitionIssue(t.client, created.Key, status); err != nil {
+			slog.Warn("Unable to transition ticket", "ticket", created.Key, "transition", status, "error", err)
+		}
+	}
+
+	for _, watcher := range issue.Watchers {
+		id := firstNonEmpty(watcher.AccountID, watcher.Name)
+		if _, err := t.client.Issue.AddWatcher(created.Key, id); err != nil {
+			slog.Warn("Unable to add watcher", "ticket", created.Key, "watcher", id, "error", err)
+		}
+	}
+
+	if issue.Sprint != "" {
+		if err := t.addToSprint(created.Key, issue.ProjectKey, issue.Sprint); err != nil {
+			slog.Warn("Unable to add ticket to sprint", "ticket", created.Key, "sprint", issue.Sprint, "error", err)
+		}
+	}
+
+	return created.Key, nil
+}
+
+func (t *jiraTracker) Transition(key string, name string) error {
+
+	return transitionIssue(t.client, key, name)
+}
+
+// transitionIssue moves a ticket through the transition with the given name,
+// or the one leading to the status with that name.
+func transitionIssue(jiraClient *jira.Client, key string, name string) error {
+
+	transitions, _, err := jiraClient.Issue.GetTransitions(key)
+	if err != nil {
+		return fmt.Errorf("unable to list transitions of %s: %w", key, err)
+	}
+
+	available := []string{}
+	for _, transition := range transitions {
+		if strings.EqualFold(transition.Name, name) || strings.EqualFold(transition.To.Name, name) {
+			if _, err := jiraClient.Issue.DoTransition(key, transition.ID); err != nil {
+				return fmt.Errorf("unable to transition %s to %s: %w", key, name, err)
+			}
+			return nil
+		}
+		available = append(available, transition.Name)
+	}
+
+	return fmt.Errorf("%s has no transition %q, available: %s", key, name, strings.Join(available, ", "))
+}
+
+// addRepositoryLink adds a remote link from the ticket to the repository so
+// it shows up under the ticket's links.
+func addRepositoryLink(jiraClient *jira.Client, key string, repository string) error {
+
+	link := &jira.RemoteLink{
+		GlobalID: repository,
+		Object: &jira.RemoteLinkObject{
+			URL:   repository,
+			Title: strings.TrimPrefix(catalog.NormalizeRepoURL(repository), "https://"),
+		},
+	}
+
+	_, _, err := jiraClient.Issue.AddRemoteLink(key, link)
+	return err
+}
+
+func (t *jiraTracker) FindExisting(issue tracker.Issue, repository string) (string, error) {
+
+	existing, err := findExistingIssue(t.client, issue, repository)
+	if err != nil || existing == nil {
+		return "", err
+	}
+
+	return existing.Key, nil
+}
+
+func (t *jiraTracker) UpdateDescription(key string, description string) error {
+
+	return updateIssueDescription(t.client, key, jiraText(description))
+}
+
+func (t *jiraTracker) Comment(key string, body string) error {
+
+	if jiraAPIVersion() == 3 {
+		if err := addCommentV3(t.client, key, body); err != nil {
+			return fmt.Errorf("unable to comment on %s: %w", key, err)
+		}
+		return nil
+	}
+
+	if _, _, err := t.client.Issue.AddComment(key, &jira.Comment{Body: jiraText(body)}); err != nil {
+		return fmt.Errorf("unable to comment on %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// ensureComponents creates the components missing from a project and returns
+// the names that exist afterwards. Components that cannot be created, usually
+// for lack of project admin rights, are left off the ticket with a warning.
+func (t *jiraTracker) ensureComponents(projectKey string, names []string) []string {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.components == nil {
+		t.components = make(map[string]map[string]bool)
+	}
+
+	known, ok := t.components[projectKey]
+	if !ok {
+		known = make(map[string]bool)
+		project, err := t.projectLocked(projectKey)
+		if err != nil {
+			slog.Warn("Unable to list components", "project", projectKey, "error", err)
+			return names
+		}
+		for _, component := range project.Components {
+			known[strings.ToLower(component.Name)] = true
+		}
+		t.components[projectKey] = known
+	}
+
+	existing := []string{}
+	for _, name := range names {
+		if !known[strings.ToLower(name)] {
+			_, _, err := t.client.Component.Create(&jira.CreateComponentOptions{Name: name, Project: projectKey})
+			if err != nil {
+				slog.Warn("Unable to create component, leaving it off the ticket", "project", projectKey, "component", name, "error", err)
+				continue
+			}
+			slog.Info("Created component", "project", projectKey, "component", name)
+			known[strings.ToLower(name)] = true
+		}
+		existing = append(existing, name)
+	}
+
+	return existing
+}
+
+// ensureVersion creates the fix version in the project unless it exists.
+func (t *jiraTracker) ensureVersion(projectKey string, name string) error {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.versions == nil {
+		t.versions = make(map[string]map[string]bool)
+	}
+
+	known, ok := t.versions[projectKey]
+	if !ok {
+		known = make(map[string]bool)
+		t.versions[projectKey] = known
+	}
+	if known[strings.ToLower(name)] {
+		return nil
+	}
+
+	project, err := t.projectLocked(projectKey)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range project.Versions {
+		known[strings.ToLower(version.Name)] = true
+	}
+	if known[strings.ToLower(name)] {
+		return nil
+	}
+
+	projectID, err := strconv.Atoi(project.ID)
+	if err != nil {
+		return fmt.Errorf("unexpected id %q for project %s", project.ID, projectKey)
+	}
+
+	if _, _, err := t.client.Version.Create(&jira.Version{Name: name, ProjectID: projectID}); err != nil {
+		return fmt.Errorf("unable to create fix version %s in %s: %w", name, projectKey, err)
+	}
+	slog.Info("Created fix version", "project", projectKey, "version", name)
+	known[strings.ToLower(name)] = true
+
+	return nil
+}
+
+// projectLocked returns the project, fetching it once. t.mu must be held.
+func (t *jiraTracker) projectLocked(projectKey string) (*jira.Project, error) {
+
+	if project, ok := t.projects[projectKey]; ok {
+		return project, nil
+	}
+
+	project, _, err := t.client.Project.Get(projectKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get project %s: %w", projectKey, err)
+	}
+
+	if t.projects == nil {
+		t.projects = make(map[string]*jira.Project)
+	}
+	t.projects[projectKey] = project
+
+	return project, nil
+}
+
+// componentsFor returns the components of a service's ticket: jira.components
+// plus the jira.componentMap entries for the service and for its team.
+func componentsFor(service catalog.Service) []string {
+
+	var components []string
+	seen := make(map[string]bool)
+
+	candidates := viper.GetStringSlice("jira.components")
+	for _, key := range []string{service.ServiceId, service.Team.TeamId} {
+		if key != "" {
+			candidates = append(candidates, viper.GetStringSlice("jira.componentMap."+strings.ToLower(key))...)
+		}
+	}
+
+	//Entries may also be given as comma separated strings
+	for _, candidate := range candidates {
+		for _, component := range strings.Split(candidate, ",") {
+			component = strings.TrimSpace(component)
+			if component == "" || seen[strings.ToLower(component)] {
+				continue
+			}
+			seen[strings.ToLower(component)] = true
+			components = append(components, component)
+		}
+	}
+
+	return components
+}
+
+func addIssue(jiraClient *jira.Client, issue tracker.Issue) (tracker.Issue, error) {
+
+	jiraIssue := jira.Issue{
+		Fields: &jira.IssueFields{
+			Summary: issue.Name,
+			Type: jira.IssueType{
+				Name: issue.Type,
+			},
+			Project: jira.Project{
+				Key: issue.ProjectKey,
+			},
+			Description: issue.Description,
+			Assignee:    issue.Assignee,
+			Reporter:    issue.Reporter,
+			Labels:      issue.Labels,
+		},
+	}
+
+	if issue.Priority != "" {
+		jiraIssue.Fields.Priority = &jira.Priority{Name: issue.Priority}
+	}
+
+	if issue.DueDate != "" {
+		due, err := time.Parse(dateLayout, issue.DueDate)
+		if err != nil {
+			return issue, err
+		}
+		jiraIssue.Fields.Duedate = jira.Date(due)
+	}
+
+	if issue.StoryPoints != 0 {
+		field := viper.GetString("jira.storyPointsField")
+		if field == "" {
+			return issue, fmt.Errorf("story points are set but jira.storyPointsField is not")
+		}
+		setCustomField(jiraIssue.Fields, field, issue.StoryPoints)
+	}
+
+	if issue.FixVersion != "" {
+		jiraIssue.Fields.FixVersions = []*jira.FixVersion{{Name: issue.FixVersion}}
+	}
+
+	for _, name := range issue.Components {
+		jiraIssue.Fields.Components = append(jiraIssue.Fields.Components, &jira.Component{Name: name})
+	}
+
+	for id, value := range issue.CustomFields {
+		setCustomField(jiraIssue.Fields, id, value)
+	}
+
+	//Link to the campaign epic, through the Epic Link field on Data Center
+	//or the parent field on Cloud. Subtasks are linked to their parent only.
+	if issue.Parent != "" {
+		jiraIssue.Fields.Parent = &jira.Parent{Key: issue.Parent}
+	} else if issue.Epic != "" {
+		if field := viper.GetString("jira.epicLinkField"); field != "" {
+			setCustomField(jiraIssue.Fields, field, issue.Epic)
+		} else {
+			jiraIssue.Fields.Parent = &jira.Parent{Key: issue.Epic}
+		}
+	}
+
+	var respIssue *jira.Issue
+	var err error
+	if jiraAPIVersion() == 3 {
+		respIssue, err = createIssueV3(jiraClient, &jiraIssue, issue.Description)
+	} else {
+		respIssue, _, err = jiraClient.Issue.Create(&jiraIssue)
+	}
+	if err != nil {
+		return issue, fmt.Errorf("unable to create issue: %w", err)
+	}
+
+	issue.Key = respIssue.Key
+
+	return issue, nil
+}
+
+// createEpic creates the epic that groups a run's tickets and returns its
+// key. Data Center requires an Epic Name, set through jira.epicNameField.
+func createEpic(jiraClient *jira.Client, projectKey string, name string, labels []string) (string, error) {
+
+	fields := &jira.IssueFields{
+		Summary: name,
+		Type: jira.IssueType{
+			Name: "Epic",
+		},
+		Project: jira.Project{
+			Key: projectKey,
+		},
+		Labels: labels,
+	}
+
+	if field := viper.GetString("jira.epicNameField"); field != "" {
+		setCustomField(fields, field, name)
+	}
+
+	respIssue, _, err := jiraClient.Issue.Create(&jira.Issue{Fields: fields})
+	if err != nil {
+		return "", fmt.Errorf("unable to create epic: %w", err)
+	}
+
+	return respIssue.Key, nil
+}
+
+// setCustomField sets a field that has no counterpart in jira.IssueFields.
+func setCustomField(fields *jira.IssueFields, id string, value interface{}) {
+
+	if fields.Unknowns == nil {
+		fields.Unknowns = map[string]interface{}{}
+	}
+
+	fields.Unknowns[id] = value
+}
+
+// findExistingIssue searches the project for an open ticket with the same
+// summary whose description mentions the repository. It returns nil when no
+// such ticket exists.
+func findExistingIssue(jiraClient *jira.Client, issue tracker.Issue, repository string) (*jira.Issue, error) {
+
+	jql := fmt.Sprintf(`project = "%s" AND summary ~ "%s" AND statusCategory != Done`,
+		escapeJQL(issue.ProjectKey), escapeJQL(issue.Name))
+
+	//Tickets created by imp carry the configured labels, which narrows the search
+	for _, label := range issue.Labels {
+		jql += fmt.Sprintf(` AND labels = "%s"`, escapeJQL(label))
+	}
+
+	found, _, err := jiraClient.Issue.Search(jql, &jira.SearchOptions{
+		Fields:     []string{"summary", "description"},
+		MaxResults: 50,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("jira search failed: %w", err)
+	}
+
+	//JQL text search is fuzzy, so confirm the match here
+	for _, itm := range found {
+		if itm.Fields == nil || itm.Fields.Summary != issue.Name {
+			continue
+		}
+		if strings.Contains(itm.Fields.Description, repository) {
+			return &itm, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// duplicateAction returns what to do with an existing ticket, as configured
+// by jira.duplicates: "skip" (the default), "update", or "create" to disable
+// the duplicate check entirely.
+func duplicateAction() string {
+
+	switch action := viper.GetString("jira.duplicates"); action {
+	case "update", "create":
+		return action
+	}
+
+	return "skip"
+}
+
+func updateIssueDescription(jiraClient *jira.Client, key string, description string) error {
+
+	if jiraAPIVersion() == 3 {
+		if err := updateDescriptionV3(jiraClient, key, description); err != nil {
+			return fmt.Errorf("unable to update %s: %w", key, err)
+		}
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"description": description,
+		},
+	}
+
+	_, err := jiraClient.Issue.UpdateIssue(key, data)
+	if err != nil {
+		return fmt.Errorf("unable to update %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// escapeJQL escapes a value for use inside a double quoted JQL string.
+func escapeJQL(value string) string {
+
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// jiraIssueURL returns the browse URL of a Jira ticket.
+func jiraIssueURL(key string) string {
+
+	return strings.TrimRight(viper.GetString("jira.baseurl"), "/") + "/browse/" + key
+}
+
+// issueLabels merges the jira.labels from the config with extra labels given
+// on the command line, dropping blanks and duplicates.
+func issueLabels(extra []string) []string {
+
+	var labels []string
+	seen := make(map[string]bool)
+
+	for _, label := range append(viper.GetStringSlice("jira.labels"), extra...) {
+		label = strings.TrimSpace(label)
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		labels = append(labels, label)
+	}
+
+	return labels
+}
+
+// trackerProjectPattern matches the project key in Jira URLs such as
+// /projects/ABC, /jira/software/projects/ABC/boards/1 or /browse/ABC-123.
+var trackerProjectPattern = regexp.MustCompile(`/(?:projects|browse)/([A-Za-z][A-Za-z0-9_]*)`)
+
+// projectKeyFor returns the Jira project a service's ticket is created in:
+// the jira.projects mapping for its team, then the project in its issue
+// tracker URL when that points at our Jira, and finally jira.projectKey.
+func projectKeyFor(service catalog.Service) string {
+
+	if key, ok := viper.GetStringMapString("jira.projects")[strings.ToLower(service.Team.TeamId)]; ok && key != "" {
+		return key
+	}
+
+	if key := projectKeyFromURL(service.IssueTrackerUrl); key != "" {
+		return key
+	}
+
+	return viper.GetString("jira.projectKey")
+}
+
+// projectKeyFromURL extracts the project key from an issue tracker URL on the
+// configured Jira host. Trackers elsewhere (GitHub issues, another Jira) are
+// ignored.
+func projectKeyFromURL(trackerUrl string) string {
+
+	if trackerUrl == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(trackerUrl)
+	if err != nil {
+		return ""
+	}
+
+	base, err := url.Parse(viper.GetString("jira.baseurl"))
+	if err != nil || !strings.EqualFold(parsed.Host, base.Host) {
+		return ""
+	}
+
+	match := trackerProjectPattern.FindStringSubmatch(parsed.Path)
+	if match == nil {
+		return ""
+	}
+
+	return strings.ToUpper(match[1])
+}
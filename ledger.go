@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"imp/pkg/catalog"
+	"time"
+)
+
+var (
+	// repositoriesBucket holds the latest entry for every repository.
+	repositoriesBucket = []byte("repositories")
+
+	// runsBucket holds one nested bucket per run ID with that run's entries.
+	runsBucket = []byte("runs")
+)
+
+// LedgerEntry records a ticket created by imp.
+type LedgerEntry struct {
+	RunID        string    `json:"runId"`
+	Repository   string    `json:"repository"`
+	Service      string    `json:"service"`
+	JiraKey      string    `json:"jiraKey"`
+	SlackChannel string    `json:"slackChannel"`
+	SlackTs      string    `json:"slackTs"`
+	CreatedAt    time.Time `json:"createdAt"`
+
+	//Notifiers that failed and are sent to again by the next run
+	PendingNotifiers []string `json:"pendingNotifiers,omitempty"`
+
+	//Set from the Slack buttons by imp listen
+	AcknowledgedBy string     `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+	SnoozedUntil   *time.Time `json:"snoozedUntil,omitempty"`
+}
+
+// ledger is the local record of every ticket created, used to make reruns
+// skip repositories that were already processed.
+type ledger struct {
+	db *bbolt.DB
+}
+
+func openLedger(path string) (*ledger, error) {
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ledger %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{repositoriesBucket, runsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return migrateLedgerKeys(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &ledger{db: db}, nil
+}
+
+func (l *ledger) Close() error {
+	return l.db.Close()
+}
+
+// ledgerKey is the key a repository's entries are stored under: its
+// normalized URL, so that the same repository written as an SSH or an HTTPS
+// URL, with or without .git, is only processed once.
+func ledgerKey(repository string) []byte {
+
+	return []byte(catalog.NormalizeRepoURL(repository))
+}
+
+// migrateLedgerKeys moves entries written by older versions, which were
+// keyed on the repository as it appeared in the input, to their normalized
+// key. When several entries share a normalized key the latest one is kept.
+func migrateLedgerKeys(tx *bbolt.Tx) error {
+
+	buckets := []*bbolt.Bucket{tx.Bucket(repositoriesBucket)}
+	err := tx.Bucket(runsBucket).ForEach(func(k, v []byte) error {
+		if v == nil {
+			buckets = append(buckets, tx.Bucket(runsBucket).Bucket(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		//Keys are collected first, as a bucket can't change while iterated
+		var stale [][]byte
+		err := bucket.ForEach(func(k, v []byte) error {
+			if string(ledgerKey(string(k))) != string(k) {
+				stale = append(stale, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range stale {
+			value := bucket.Get(k)
+			key := ledgerKey(string(k))
+			if current := bucket.Get(key); current != nil {
+				var old, latest LedgerEntry
+				if err := json.Unmarshal(value, &old); err != nil {
+					return err
+				}
+				if err := json.Unmarshal(current, &latest); err != nil {
+					return err
+				}
+				if !old.CreatedAt.After(latest.CreatedAt) {
+					value = current
+				}
+			}
+			//Copied, as the value is only valid until the bucket changes
+			value = append([]byte(nil), value...)
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+			if err := bucket.Put(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get returns the latest entry for a repository, or nil if it has never been
+// processed.
+func (l *ledger) Get(repository string) (*LedgerEntry, error) {
+
+	var entry *LedgerEntry
+
+	err := l.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(repositoriesBucket).Get(ledgerKey(repository))
+		if value == nil {
+			return nil
+		}
+		entry = &LedgerEntry{}
+		return json.Unmarshal(value, entry)
+	})
+
+	return entry, err
+}
+
+// Record stores an entry both as the repository's latest entry and under its
+// run.
+func (l *ledger) Record(entry LedgerEntry) error {
+
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return l.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(repositoriesBucket).Put(ledgerKey(entry.Repository), value); err != nil {
+			return err
+		}
+
+		run, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(entry.RunID))
+		if err != nil {
+			return err
+		}
+
+		return run.Put(ledgerKey(entry.Repository), value)
+	})
+}
+
+// Run returns every entry recorded for a run.
+func (l *ledger) Run(runID string) ([]LedgerEntry, error) {
+
+	entries := []LedgerEntry{}
+
+	err := l.db.View(func(tx *bbolt.Tx) error {
+		run := tx.Bucket(runsBucket).Bucket([]byte(runID))
+		if run == nil {
+			return fmt.Errorf("run %s not found in ledger", runID)
+		}
+
+		return run.ForEach(func(k, v []byte) error {
+			var entry LedgerEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// Remove deletes an entry from its run, and as the repository's latest entry
+// when it still is, so the repository is processed again on the next run.
+func (l *ledger) Remove(entry LedgerEntry) error {
+
+	return l.db.Update(func(tx *bbolt.Tx) error {
+		if run := tx.Bucket(runsBucket).Bucket([]byte(entry.RunID)); run != nil {
+			if err := run.Delete(ledgerKey(entry.Repository)); err != nil {
+				return err
+			}
+		}
+
+		repositories := tx.Bucket(repositoriesBucket)
+		value := repositories.Get(ledgerKey(entry.Repository))
+		if value == nil {
+			return nil
+		}
+
+		var latest LedgerEntry
+		if err := json.Unmarshal(value, &latest); err != nil {
+			return err
+		}
+		if latest.RunID != entry.RunID {
+			return nil
+		}
+
+		return repositories.Delete(ledgerKey(entry.Repository))
+	})
+}
+
+// Update changes the entry of a repository in a run, and the repository's
+// latest entry when it still belongs to that run, and returns the result.
+func (l *ledger) Update(runID string, repository string, change func(entry *LedgerEntry)) (*LedgerEntry, error) {
+
+	var entry LedgerEntry
+	key := ledgerKey(repository)
+
+	err := l.db.Update(func(tx *bbolt.Tx) error {
+		run := tx.Bucket(runsBucket).Bucket([]byte(runID))
+		if run == nil {
+			return fmt.Errorf("run %s not found in ledger", runID)
+		}
+		value := run.Get(key)
+		if value == nil {
+			return fmt.Errorf("%s is not part of run %s", repository, runID)
+		}
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+
+		change(&entry)
+
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := run.Put(key, value); err != nil {
+			return err
+		}
+
+		repositories := tx.Bucket(repositoriesBucket)
+		var latest LedgerEntry
+		if current := repositories.Get(key); current != nil {
+			if err := json.Unmarshal(current, &latest); err != nil {
+				return err
+			}
+		}
+		if latest.RunID != runID {
+			return nil
+		}
+
+		return repositories.Put(key, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// All returns the latest entry for every repository in the ledger.
+func (l *ledger) All() ([]LedgerEntry, error) {
+
+	entries := []LedgerEntry{}
+
+	err := l.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(repositoriesBucket).ForEach(func(k, v []byte) error {
+			var entry LedgerEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+
+	return entries, err
+}
+
+// newRunID returns an identifier for the current run based on the start time,
+// with a random suffix as runs started in the same second share a ledger,
+// e.g. a scheduled run and a manual one.
+func newRunID() string {
+
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%s-%x", time.Now().UTC().Format("20060102T150405Z"), suffix)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedgerNormalizesRepositories(t *testing.T) {
+
+	l, err := openLedger(filepath.Join(t.TempDir(), "ledger.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	entry := LedgerEntry{RunID: "run", Repository: "git@github.com:org/x.git", JiraKey: "MIG-1"}
+	if err := l.Record(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, repository := range []string{"git@github.com:org/x.git", "https://github.com/org/x", "https://GitHub.com/org/x.git/"} {
+		got, err := l.Get(repository)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.JiraKey != "MIG-1" {
+			t.Errorf("Get(%q) = %v, want MIG-1", repository, got)
+		}
+	}
+
+	updated, err := l.Update("run", "https://github.com/org/x", func(entry *LedgerEntry) {
+		entry.AcknowledgedBy = "U1"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, _ := l.Get(entry.Repository); latest == nil || latest.AcknowledgedBy != "U1" {
+		t.Errorf("Get() after Update() = %v, want it acknowledged", latest)
+	}
+
+	if err := l.Remove(*updated); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := l.Get("https://github.com/org/x"); got != nil {
+		t.Errorf("Get() after Remove() = %v, want nil", got)
+	}
+}
+
+func TestLedgerMigratesRawKeys(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "ledger.db")
+	l, err := openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Entries as older versions wrote them, keyed on the input
+	older := LedgerEntry{RunID: "old", Repository: "git@github.com:org/x.git", JiraKey: "MIG-1", CreatedAt: time.Unix(1, 0)}
+	newer := LedgerEntry{RunID: "new", Repository: "https://github.com/org/x/", JiraKey: "MIG-2", CreatedAt: time.Unix(2, 0)}
+	err = l.db.Update(func(tx *bbolt.Tx) error {
+		for _, entry := range []LedgerEntry{newer, older} {
+			value, _ := json.Marshal(entry)
+			if err := tx.Bucket(repositoriesBucket).Put([]byte(entry.Repository), value); err != nil {
+				return err
+			}
+			run, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(entry.RunID))
+			if err != nil {
+				return err
+			}
+			if err := run.Put([]byte(entry.Repository), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = openLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	all, err := l.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].JiraKey != "MIG-2" {
+		t.Errorf("All() = %v, want only the latest entry, MIG-2", all)
+	}
+
+	if _, err := l.Update("old", "https://github.com/org/x", func(entry *LedgerEntry) {}); err != nil {
+		t.Errorf("Update() of the older run: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/notify"
+	"imp/pkg/tracker"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Identifiers of the notification buttons handled by imp listen.
+const (
+	acknowledgeBlockID  = "imp_acknowledge"
+	acknowledgeActionID = "imp_acknowledge"
+	snoozeActionID      = "imp_snooze"
+)
+
+// acknowledgeValue identifies the ledger entry a button belongs to.
+type acknowledgeValue struct {
+	RunID      string `json:"run"`
+	Repository string `json:"repository"`
+}
+
+var listenCmd = &cobra.Command{
+	Use:   "listen",
+	Args:  cobra.NoArgs,
+	Short: "Record the buttons clicked on Slack notifications and answer the imp slash command",
+	RunE:  runListen,
+}
+
+func init() {
+
+	rootCmd.AddCommand(listenCmd)
+}
+
+// withAcknowledgeButtons returns the notification's blocks followed by the
+// Acknowledge and Snooze buttons. Plain text notifications get a section with
+// their text first.
+func withAcknowledgeButtons(n notify.Notification) []slack.Block {
+
+	value, err := json.Marshal(acknowledgeValue{RunID: n.RunID, Repository: n.Repository})
+	if err != nil {
+		return n.Blocks
+	}
+
+	blocks := append([]slack.Block{}, n.Blocks...)
+	if len(blocks) == 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, n.Text, false, false), nil, nil))
+	}
+
+	acknowledge := slack.NewButtonBlockElement(acknowledgeActionID, string(value), slack.NewTextBlockObject(slack.PlainTextType, "Acknowledge", false, false))
+	acknowledge.Style = slack.StylePrimary
+	snooze := slack.NewButtonBlockElement(snoozeActionID, string(value), slack.NewTextBlockObject(slack.PlainTextType, "Snooze", false, false))
+
+	return append(blocks, slack.NewActionBlock(acknowledgeBlockID, acknowledge, snooze))
+}
+
+// listener handles button clicks and slash commands coming in over Socket
+// Mode.
+type listener struct {
+	api     *slack.Client
+	tracker tracker.Tracker
+	snooze  time.Duration
+
+	//Slash command runs, one at a time, and their replies
+	replies   *http.Client
+	commandMu sync.Mutex
+	commands  sync.WaitGroup
+
+	//The ledger of the slash command run in progress, which button clicks
+	//use while the run holds it open
+	ledgerMu sync.Mutex
+	ledger   *ledger
+}
+
+func runListen(cmd *cobra.Command, args []string) error {
+
+	appToken := viper.GetString("slack.appToken")
+	if appToken == "" {
+		return fmt.Errorf("slack.appToken is required, socket mode needs an app-level token (xapp-...)")
+	}
+
+	api := newSlackClient(slack.OptionAppLevelToken(appToken))
+
+	l := &listener{
+		api:     api,
+		snooze:  viper.GetDuration("slack.snoozeDuration"),
+		replies: &http.Client{Transport: newRetryTransport(newMetricsTransport("slack", nil))},
+	}
+	if viper.GetBool("slack.acknowledgeComment") {
+		tr, err := newTracker()
+		if err != nil {
+			return err
+		}
+		l.tracker = tr
+	}
+
+	client := socketmode.New(api)
+
+	//Ctrl-C disconnects cleanly rather than killing a click in progress
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	go func() {
+		for evt := range client.Events {
+			switch evt.Type {
+			case socketmode.EventTypeConnecting:
+				slog.Info("Connecting to Slack")
+			case socketmode.EventTypeConnected:
+				slog.Info("Listening for Slack notification buttons and slash commands")
+			case socketmode.EventTypeConnectionError:
+				slog.Warn("Slack connection failed, retrying")
+			case socketmode.EventTypeInteractive:
+				callback, ok := evt.Data.(slack.InteractionCallback)
+				if !ok {
+					continue
+				}
+				client.Ack(*evt.Request)
+				if callback.Type == slack.InteractionTypeBlockActions {
+					l.handle(callback)
+				}
+			case socketmode.EventTypeSlashCommand:
+				command, ok := evt.Data.(slack.SlashCommand)
+				if !ok {
+					continue
+				}
+				client.Ack(*evt.Request, l.handleCommand(ctx, command))
+			}
+		}
+	}()
+
+	if err := client.RunContext(ctx); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	//Let slash command runs in flight finish their rows and reply
+	l.commands.Wait()
+	slog.Info("Stopped listening")
+
+	return nil
+}
+
+// handle records the button click in the ledger and updates the message.
+func (l *listener) handle(callback slack.InteractionCallback) {
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID == approveActionID || action.ActionID == rejectActionID {
+			if err := l.decide(callback, action); err != nil {
+				slog.Error("Unable to record approval", "action", action.ActionID, "user", callback.User.ID, "error", err)
+			}
+			continue
+		}
+		if action.ActionID != acknowledgeActionID && action.ActionID != snoozeActionID {
+			continue
+		}
+
+		var value acknowledgeValue
+		if err := json.Unmarshal([]byte(action.Value), &value); err != nil {
+			slog.Warn("Ignoring button with an unknown value", "action", action.ActionID, "value", action.Value)
+			continue
+		}
+
+		var err error
+		if action.ActionID == acknowledgeActionID {
+			err = l.acknowledge(callback, value)
+		} else {
+			err = l.snoozeUntil(callback, value)
+		}
+		if err != nil {
+			slog.Error("Unable to handle Slack button", "action", action.ActionID, "repository", value.Repository, "run", value.RunID, "error", err)
+			text := fmt.Sprintf("Sorry, imp could not record that: %s", err)
+			if _, err := l.api.PostEphemeral(callback.Channel.ID, callback.User.ID, slack.MsgOptionText(text, false)); err != nil {
+				slog.Warn("Unable to tell the user", "user", callback.User.ID, "error", err)
+			}
+		}
+	}
+}
+
+// acknowledge records who acknowledged the ticket, optionally comments on it,
+// and replaces the buttons with a note.
+func (l *listener) acknowledge(callback slack.InteractionCallback, value acknowledgeValue) error {
+
+	now := time.Now()
+	entry, err := l.updateLedgerEntry(value, func(entry *LedgerEntry) {
+		entry.AcknowledgedBy = callback.User.Name
+		entry.AcknowledgedAt = &now
+		entry.SnoozedUntil = nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Ticket acknowledged", "ticket", entry.JiraKey, "repository", entry.Repository, "user", callback.User.Name)
+
+	if l.tracker != nil {
+		comment := fmt.Sprintf("Acknowledged on Slack by %s.", firstNonEmpty(callback.User.Name, callback.User.ID))
+		if err := l.tracker.Comment(entry.JiraKey, comment); err != nil {
+			slog.Warn("Unable to comment on ticket", "ticket", entry.JiraKey, "error", err)
+		}
+	}
+
+	note := fmt.Sprintf(":white_check_mark: Acknowledged by <@%s> on %s", callback.User.ID, now.Format("2006-01-02"))
+
+	return l.replaceButtons(callback, note, false)
+}
+
+// snoozeUntil records the snooze and schedules a reminder in the message's
+// thread. The buttons stay so the team can still acknowledge the ticket.
+func (l *listener) snoozeUntil(callback slack.InteractionCallback, value acknowledgeValue) error {
+
+	until := time.Now().Add(l.snooze)
+	entry, err := l.updateLedgerEntry(value, func(entry *LedgerEntry) {
+		entry.SnoozedUntil = &until
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Ticket snoozed", "ticket", entry.JiraKey, "repository", entry.Repository, "user", callback.User.Name, "until", until)
+
+	reminder := fmt.Sprintf("<@%s> reminder: %s is still waiting to be acknowledged.", callback.User.ID, firstNonEmpty(issueURL(entry.JiraKey), entry.JiraKey))
+	_, _, err = l.api.ScheduleMessage(callback.Channel.ID, strconv.FormatInt(until.Unix(), 10),
+		slack.MsgOptionText(reminder, false),
+		slack.MsgOptionTS(callback.Message.Timestamp),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to schedule the reminder: %w", err)
+	}
+
+	note := fmt.Sprintf(":zzz: Snoozed by <@%s> until %s", callback.User.ID, until.Format("2006-01-02 15:04"))
+
+	return l.replaceButtons(callback, note, true)
+}
+
+// replaceButtons updates the notification with a note under it, keeping the
+// buttons only when keep is set. Earlier notes are replaced.
+func (l *listener) replaceButtons(callback slack.InteractionCallback, note string, keep bool) error {
+
+	blocks := []slack.Block{}
+	for _, block := range callback.Message.Blocks.BlockSet {
+		switch b := block.(type) {
+		case *slack.ContextBlock:
+			if b.BlockID == acknowledgeBlockID+"_note" {
+				continue
+			}
+		case *slack.ActionBlock:
+			if b.BlockID == acknowledgeBlockID && !keep {
+				continue
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	blocks = append(blocks, slack.NewContextBlock(acknowledgeBlockID+"_note", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+
+	_, _, _, err := l.api.UpdateMessage(callback.Channel.ID, callback.Message.Timestamp,
+		slack.MsgOptionText(callback.Message.Text, false),
+		slack.MsgOptionBlocks(blocks...),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to update the notification: %w", err)
+	}
+
+	return nil
+}
+
+// updateLedgerEntry changes the ledger entry a button belongs to. The ledger
+// is only opened for the update so imp create can run while imp listen is up,
+// unless a slash command run has it open, whose ledger is used instead.
+func (l *listener) updateLedgerEntry(value acknowledgeValue, change func(entry *LedgerEntry)) (*LedgerEntry, error) {
+
+	l.ledgerMu.Lock()
+	defer l.ledgerMu.Unlock()
+
+	if l.ledger != nil {
+		return l.ledger.Update(value.RunID, value.Repository, change)
+	}
+
+	runLedger, err := openRunLedger()
+	if err != nil {
+		return nil, err
+	}
+	defer runLedger.Close()
+
+	return runLedger.Update(value.RunID, value.Repository, change)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// stderr is where logs go. It keeps a status line, such as the progress bar,
+// at the bottom of the terminal below the log lines.
+var stderr = &statusWriter{out: os.Stderr}
+
+// setupLogging installs the default structured logger, writing to stderr in
+// the given format (text or json) at the given level.
+func setupLogging(level string, format string) error {
+
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "text", "":
+		handler = slog.NewTextHandler(stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+// statusWriter writes to out, clearing the status line before every write and
+// drawing it again after.
+type statusWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	status string
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.status == "" {
+		return w.out.Write(p)
+	}
+
+	fmt.Fprint(w.out, "\r\033[K")
+	n, err := w.out.Write(p)
+	fmt.Fprint(w.out, w.status)
+
+	return n, err
+}
+
+// SetStatus replaces the status line, or clears it when status is empty.
+func (w *statusWriter) SetStatus(status string) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fmt.Fprint(w.out, "\r\033[K"+status)
+	w.status = status
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
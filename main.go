@@ -1,282 +1,237 @@
 package main
 
 import (
-	"bytes"
 	"encoding/csv"
-	"encoding/json"
-	"flag"
 	"fmt"
-	"github.com/andygrunwald/go-jira"
 	"github.com/slack-go/slack"
 	"github.com/spf13/viper"
-	"io/ioutil"
-	"log"
+	"imp/pkg/catalog"
+	"imp/pkg/tracker"
+	"log/slog"
+	"net/http"
 	"os"
-	"text/template"
+	"sort"
+	"strings"
 )
 
-type Issue struct {
-	ID          string `json:"id"`
-	Key         string `json:"key"`
-	ProjectKey  string `json:"project_key"`
-	Name        string `json:"name"`
-	Type        string `json:"type"`
-	Description string `json:"description"`
-}
-
-type SlackGeneralChannel struct {
-	ChannelId   string `json:"channelId"`
-	ChannelName string `json:"channelName"`
-}
-
-type User struct {
-	Email            string `json:"email"`
-	SlackDisplayName string `json:"slackDisplayName"`
-}
-
-type TeamMember struct {
-	User User `json:"user"`
-}
-
-type Team struct {
-	TeamId      string       `json:"teamId"`
-	TeamMembers []TeamMember `json:"teamMembers"`
-}
+func main() {
 
-type Service struct {
-	ServiceId           string              `json:"serviceId"`
-	RepositoryUrls      []string            `json:"repositoryUrls"`
-	IssueTrackerUrl     string              `json:"issueTrackerUrl"`
-	SlackGeneralChannel SlackGeneralChannel `json:"slackGeneralChannel"`
-	Team                Team                `json:"team"`
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(exitCode(err))
+	}
 }
 
-type Node struct {
-	Services []Service `json:"nodes"`
-}
+// loadRepoLookup fetches the service catalog and indexes it by repository.
+func loadRepoLookup(catalogFile string) (catalog.Lookup, error) {
 
-type Data struct {
-	NodeList Node `json:"services"`
-}
+	//Get the full list of services from BigBrother
+	services, err := fetchServices(catalogFile)
+	if err != nil {
+		return nil, withExitCode(exitCatalog, err)
+	}
 
-type DataSet struct {
-	Data Data `json:"data"`
+	//Create a simple dictionary based on the repository
+	return catalog.NewLookup(services), nil
 }
 
-func main() {
+// reportUnmatched prints the repositories that could not be resolved against
+// the catalog, with the closest catalog repositories as suggestions, and,
+// when fileName is set, writes them to a CSV file.
+func reportUnmatched(unmatched []string, lookup catalog.Lookup, fileName string) {
 
-	// ----- Config ----!>
-	viper.SetConfigName("config") // name of config file (without extension)
-	viper.SetConfigType("yaml")   // REQUIRED if the config file does not have the extension in the name
-	viper.AddConfigPath(".")      // look for config in the working directory
-	err := viper.ReadInConfig()   // Find and read the config file
-	if err != nil {               // Handle errors reading the config file
-		panic(fmt.Errorf("fatal error config file: %w", err))
+	if len(unmatched) == 0 {
+		return
 	}
 
-	//List of repositories to create tickets for
-	repoFile := flag.String("file", "", "list of repositories")
-
-	//template for jira tickets
-	jiraTemplateFile := flag.String("jtemp", "", "jira ticket template")
-
-	//template for slack message
-	slackTemplateFile := flag.String("stemp", "", "slack message template")
+	suggestions := make([][]string, len(unmatched))
 
-	flag.Parse()
-
-	if *repoFile == "" {
-		println("Error: No repositories specified")
-		println("Usage: ./imp:")
-		flag.PrintDefaults()
-		os.Exit(1)
+	fmt.Printf("%d repositories could not be matched to a service:\n", len(unmatched))
+	for i, repo := range unmatched {
+		suggestions[i] = suggestRepositories(repo, lookup)
+		if len(suggestions[i]) > 0 {
+			fmt.Printf("  %s (did you mean %s?)\n", repo, strings.Join(suggestions[i], ", "))
+		} else {
+			fmt.Printf("  %s\n", repo)
+		}
 	}
 
-	if *jiraTemplateFile == "" {
-		println("Error: No jira template specified")
-		println("Usage: ./imp:")
-		flag.PrintDefaults()
-		os.Exit(1)
+	if fileName == "" {
+		return
 	}
 
-	if *slackTemplateFile == "" {
-		println("Error: No slack message specified")
-		println("Usage: ./imp:")
-		flag.PrintDefaults()
-		os.Exit(1)
+	f, err := os.Create(fileName)
+	if err != nil {
+		slog.Error("Unable to write unmatched report", "error", err)
+		return
 	}
+	defer f.Close()
 
-	//Create Slack api client
-	api := slack.New(viper.GetString("slack.token"))
-
-	//Create Jira client
-	tp := jira.BasicAuthTransport{
-		Username: viper.GetString("jira.user"),
-		Password: viper.GetString("jira.token"),
+	w := csv.NewWriter(f)
+	w.Write([]string{"repository", "suggestions"})
+	for i, repo := range unmatched {
+		w.Write([]string{repo, strings.Join(suggestions[i], " ")})
 	}
+	w.Flush()
 
-	jiraClient, err := jira.NewClient(tp.Client(), viper.GetString("jira.baseurl"))
-	if err != nil {
-		log.Printf(err.Error())
-		panic(err)
+	if err := w.Error(); err != nil {
+		slog.Error("Unable to write unmatched report", "error", err)
 	}
+}
 
-	//Get the full list of services from BigBrother
-	services := fetchServices()
-
-	//Create a simple dictionary based on the repository
-	repoLookup := createMap(services)
+// slackChannelFor returns the channel a service's notification is posted to.
+// The service's general channel is used unless slack.forceDefaultChannel is
+// set or the catalog entry has no channel, in which case slack.defaultChannel
+// is used instead. Entries with only a channel name are resolved to the
+// channel's ID, falling back to the default channel when that fails.
+func slackChannelFor(service catalog.Service) string {
 
-	//Fetch the list of repositories from the file (first column only)
-	repositoryList := readRepositoryFile(*repoFile)
+	channel := service.SlackGeneralChannel
+	if viper.GetBool("slack.forceDefaultChannel") || (channel.ChannelId == "" && channel.ChannelName == "") {
+		return viper.GetString("slack.defaultChannel")
+	}
 
-	//Get jira template
-	jiraTemplateContent := getTemplate(*jiraTemplateFile)
-	jiraTmpl, err := template.New("jiraTemplate").Parse(jiraTemplateContent)
+	if channel.ChannelId != "" {
+		return channel.ChannelId
+	}
 
-	//Get slack message template
-	slackTemplateContent := getTemplate(*slackTemplateFile)
-	slackTmpl, err := template.New("slackTemplate").Parse(slackTemplateContent)
+	//Commands that don't post to Slack show the name as is
+	if slackChannelNames == nil {
+		return "#" + strings.TrimPrefix(channel.ChannelName, "#")
+	}
 
-	//Loop and find the services associated to the repositories
-	for _, itm := range repositoryList {
-		service := repoLookup[itm]
+	id, err := slackChannelNames.Resolve(channel.ChannelName)
+	if err != nil {
+		slackChannelNames.warnOnce(channel.ChannelName, err)
+		return viper.GetString("slack.defaultChannel")
+	}
 
-		buf := bytes.NewBufferString("")
-		data := make(map[string]string)
-		data["repository"] = itm
-		data["service"] = service.ServiceId
-		data["team"] = service.Team.TeamId
+	return id
+}
 
-		err = jiraTmpl.Execute(buf, data)
+// printDryRun prints the ticket and message that would be created for a
+// repository. The preview is written in one call so that output from
+// parallel workers does not interleave.
+func printDryRun(repository string, issue tracker.Issue, channelId string, message string, blocks string) {
 
-		//Create Jira Issue
-		issue := Issue{
-			Name:        fmt.Sprintf("Migration: %s", service.ServiceId),
-			Type:        "Task",
-			ProjectKey:  viper.GetString("jira.projectKey"),
-			Description: buf.String(),
+	var b strings.Builder
+	fmt.Fprintf(&b, "----- %s -----\n", repository)
+	fmt.Fprintf(&b, "Jira project:  %s\n", issue.ProjectKey)
+	fmt.Fprintf(&b, "Jira type:     %s\n", issue.Type)
+	fmt.Fprintf(&b, "Jira summary:  %s\n", issue.Name)
+	if issue.Epic != "" {
+		fmt.Fprintf(&b, "Jira epic:     %s\n", issue.Epic)
+	}
+	if issue.Parent != "" {
+		fmt.Fprintf(&b, "Jira parent:   %s\n", issue.Parent)
+	}
+	if len(issue.Labels) > 0 {
+		fmt.Fprintf(&b, "Jira labels:   %s\n", strings.Join(issue.Labels, ", "))
+	}
+	if len(issue.Components) > 0 {
+		fmt.Fprintf(&b, "Jira components: %s\n", strings.Join(issue.Components, ", "))
+	}
+	ids := []string{}
+	for id := range issue.CustomFields {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(&b, "Jira field:    %s = %v\n", id, issue.CustomFields[id])
+	}
+	if issue.FixVersion != "" {
+		fmt.Fprintf(&b, "Jira version:  %s\n", issue.FixVersion)
+	}
+	if issue.Sprint != "" {
+		fmt.Fprintf(&b, "Jira sprint:   %s\n", issue.Sprint)
+	}
+	if issue.Priority != "" {
+		fmt.Fprintf(&b, "Jira priority: %s\n", issue.Priority)
+	}
+	if issue.DueDate != "" {
+		fmt.Fprintf(&b, "Jira due date: %s\n", issue.DueDate)
+	}
+	if issue.StoryPoints != 0 {
+		fmt.Fprintf(&b, "Jira points:   %g\n", issue.StoryPoints)
+	}
+	if issue.Assignee != nil {
+		fmt.Fprintf(&b, "Jira assignee: %s\n", firstNonEmpty(issue.Assignee.AccountID, issue.Assignee.Name))
+	}
+	if issue.Reporter != nil {
+		fmt.Fprintf(&b, "Jira reporter: %s\n", firstNonEmpty(issue.Reporter.AccountID, issue.Reporter.Name))
+	}
+	if len(issue.Watchers) > 0 {
+		watchers := []string{}
+		for _, watcher := range issue.Watchers {
+			watchers = append(watchers, firstNonEmpty(watcher.AccountID, watcher.Name))
 		}
-		jiraIssue := addIssue(jiraClient, issue)
-		log.Printf("Created ticket: %s", jiraIssue.Key)
+		fmt.Fprintf(&b, "Jira watchers: %s\n", strings.Join(watchers, ", "))
+	}
+	fmt.Fprintf(&b, "Jira description:\n%s\n", issue.Description)
+	fmt.Fprintf(&b, "Slack channel: %s\n", channelId)
+	fmt.Fprintf(&b, "Slack message:\n%s\n", message)
+	if blocks != "" {
+		fmt.Fprintf(&b, "Slack blocks:\n%s\n", blocks)
+	}
+	fmt.Fprintln(&b)
 
-		data["jira_ticket"] = jiraIssue.Key
+	fmt.Print(b.String())
+}
 
-		slackMsg := bytes.NewBufferString("")
-		err = slackTmpl.Execute(slackMsg, data)
+// newSlackClient creates a Slack client authenticated with slack.token.
+func newSlackClient(options ...slack.Option) *slack.Client {
 
-		//Notify on Slack (should use the actual service channel, not the default)
-		sendSlackNotification(api, viper.GetString("slack.defaultChannel"), slackMsg.String())
-	}
+	httpClient := &http.Client{Transport: newRetryTransport(newMetricsTransport("slack", nil))}
 
+	return slack.New(viper.GetString("slack.token"), append([]slack.Option{slack.OptionHTTPClient(httpClient)}, options...)...)
 }
 
-func sendSlackNotification(api *slack.Client, channelId string, message string) {
+// sendSlackNotification posts the message and returns its timestamp. When
+// blocks are given the message is only used as the notification fallback
+// text. Extra options, such as a thread to reply in, are passed on to Slack.
+func sendSlackNotification(api *slack.Client, channelId string, message string, blocks []slack.Block, extra ...slack.MsgOption) (string, error) {
 
 	params := slack.PostMessageParameters{
 		UnfurlLinks: false,
 		UnfurlMedia: false,
 	}
 
-	channelID, timestamp, err := api.PostMessage(
-		channelId,
+	options := []slack.MsgOption{
 		slack.MsgOptionText(message, false),
 		slack.MsgOptionPostMessageParameters(params),
-	)
-
-	if err != nil {
-		fmt.Printf("%s\n", err)
-		return
 	}
-	log.Printf("Message successfully sent to channel %s at %s\n", channelID, timestamp)
-}
-
-func readRepositoryFile(fileName string) []string {
-
-	f, _ := os.Open(fileName)
-	defer f.Close()
-
-	r := csv.NewReader(f)
-	r.Comma = ','
-
-	records, err := r.ReadAll()
-	if err != nil {
-		panic(err)
+	if len(blocks) > 0 {
+		options = append(options, slack.MsgOptionBlocks(blocks...))
 	}
+	options = append(options, extra...)
 
-	repositories := []string{}
+	channelID, timestamp, err := api.PostMessage(channelId, options...)
 
-	for _, itm := range records {
-		repositories = append(repositories, itm[0])
-	}
-
-	return repositories
-}
-
-func getTemplate(fileName string) string {
-
-	dat, err := os.ReadFile(fileName)
-	if err != nil {
-		panic(err)
-	}
-
-	return string(dat)
-}
-
-func fetchServices() []Service {
-
-	//Reading from a local file, this should be replaced with an actual API call to BigBrother
-	servicesJson, err := os.Open("services.json")
-	if err != nil {
-		fmt.Println(err)
+	//The bot has to be in a channel to post there; public ones it can join
+	if err != nil && err.Error() == "not_in_channel" && viper.GetBool("slack.autoJoin") {
+		if _, _, _, joinErr := api.JoinConversation(channelId); joinErr != nil {
+			slog.Warn("Unable to join Slack channel", "channel", channelId, "error", joinErr)
+		} else {
+			slog.Info("Joined Slack channel", "channel", channelId)
+			channelID, timestamp, err = api.PostMessage(channelId, options...)
+		}
 	}
-	defer servicesJson.Close()
 
-	byteValue, _ := ioutil.ReadAll(servicesJson)
-	var dataSet DataSet
-
-	err = json.Unmarshal(byteValue, &dataSet)
 	if err != nil {
-		fmt.Println(err)
+		slackFailures.Inc()
+		return "", fmt.Errorf("unable to post to slack channel %s: %w", channelId, err)
 	}
+	slog.Info("Sent Slack message", "channel", channelID, "ts", timestamp)
 
-	return dataSet.Data.NodeList.Services
+	return timestamp, nil
 }
 
-func createMap(services []Service) map[string]Service {
-	lookup := make(map[string]Service)
-
-	for _, itm := range services {
-		for _, repo := range itm.RepositoryUrls {
-			lookup[repo] = itm
-		}
-	}
-
-	return lookup
-}
+// getTemplate reads a template file.
+func getTemplate(fileName string) (string, error) {
 
-func addIssue(jiraClient *jira.Client, issue Issue) Issue {
-
-	jiraIssue := jira.Issue{
-		Fields: &jira.IssueFields{
-			Summary: issue.Name,
-			Type: jira.IssueType{
-				Name: issue.Type,
-			},
-			Project: jira.Project{
-				Key: issue.ProjectKey,
-			},
-			Description: issue.Description,
-		},
-	}
-
-	respIssue, _, err := jiraClient.Issue.Create(&jiraIssue)
+	dat, err := os.ReadFile(fileName)
 	if err != nil {
-		log.Printf(err.Error())
-		panic(err)
+		return "", fmt.Errorf("unable to read template: %w", err)
 	}
 
-	issue.Key = respIssue.Key
-
-	return issue
+	return string(dat), nil
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"regexp"
+	"strings"
+)
+
+// Inline Markdown syntax and its Jira wiki markup equivalent.
+var (
+	mdInlineCode = regexp.MustCompile("`([^`]+)`")
+	mdImage      = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)\)`)
+	mdLink       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold       = regexp.MustCompile(`(\*\*|__)(\S(?:.*?\S)?)(\*\*|__)`)
+	mdItalic     = regexp.MustCompile(`(^|[^\w*])[*_](\S(?:.*?\S)?)[*_]($|[^\w*])`)
+	mdStrike     = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mdHeading    = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdListItem   = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdRule       = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	mdTableSep   = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+)
+
+// jiraText returns text as it should be sent to Jira: unchanged when
+// jira.descriptionFormat is wiki, the default, or converted to wiki markup
+// when it is markdown. The v3 API builds ADF from the text instead.
+func jiraText(text string) string {
+
+	if jiraAPIVersion() == 3 {
+		return text
+	}
+
+	if strings.EqualFold(viper.GetString("jira.descriptionFormat"), "markdown") {
+		return markdownToJira(text)
+	}
+
+	return text
+}
+
+// validateDescriptionFormat checks jira.descriptionFormat.
+func validateDescriptionFormat() error {
+
+	switch format := strings.ToLower(viper.GetString("jira.descriptionFormat")); format {
+	case "", "wiki", "markdown":
+		return nil
+	default:
+		return fmt.Errorf("unknown jira.descriptionFormat %q, expected wiki or markdown", format)
+	}
+}
+
+// markdownToJira converts the Markdown commonly used in templates, headings,
+// emphasis, links, lists, code, quotes and tables, to Jira wiki markup, so
+// the same template reads well in Slack, GitHub and Jira.
+func markdownToJira(markdown string) string {
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+
+	inCode := false
+	tableHeader := false
+	for i, line := range lines {
+
+		//Fenced code blocks are copied verbatim
+		if fence := strings.TrimSpace(line); strings.HasPrefix(fence, "```") {
+			if inCode {
+				out = append(out, "{code}")
+			} else if lang := strings.TrimPrefix(fence, "```"); lang != "" {
+				out = append(out, "{code:"+lang+"}")
+			} else {
+				out = append(out, "{code}")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case mdHeading.MatchString(line):
+			match := mdHeading.FindStringSubmatch(line)
+			line = "h" + string(rune('0'+len(match[1]))) + ". " + convertInline(match[2])
+
+		case mdRule.MatchString(line):
+			line = "----"
+
+		case strings.HasPrefix(strings.TrimSpace(line), ">"):
+			line = "bq. " + convertInline(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ">")))
+
+		case strings.HasPrefix(strings.TrimSpace(line), "|"):
+			//The row before a separator row is the header
+			if i+1 < len(lines) && mdTableSep.MatchString(lines[i+1]) {
+				tableHeader = true
+			}
+			if mdTableSep.MatchString(line) {
+				continue
+			}
+			line = convertTableRow(line, tableHeader)
+			tableHeader = false
+
+		case mdListItem.MatchString(line):
+			match := mdListItem.FindStringSubmatch(line)
+			depth := len(strings.ReplaceAll(match[1], "\t", "  "))/2 + 1
+			marker := "*"
+			if match[2][0] >= '0' && match[2][0] <= '9' {
+				marker = "#"
+			}
+			line = strings.Repeat(marker, depth) + " " + convertInline(match[3])
+
+		default:
+			line = convertInline(line)
+		}
+
+		out = append(out, line)
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// convertTableRow turns | a | b | into |a|b|, or ||a||b|| for the header.
+func convertTableRow(line string, header bool) string {
+
+	cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+
+	sep := "|"
+	if header {
+		sep = "||"
+	}
+
+	converted := make([]string, len(cells))
+	for i, cell := range cells {
+		converted[i] = convertInline(strings.TrimSpace(cell))
+	}
+
+	return sep + strings.Join(converted, sep) + sep
+}
+
+// convertInline converts emphasis, code and links within a line. Inline code
+// is set aside first so its content is left alone.
+func convertInline(line string) string {
+
+	code := []string{}
+	line = mdInlineCode.ReplaceAllStringFunc(line, func(m string) string {
+		code = append(code, mdInlineCode.FindStringSubmatch(m)[1])
+		return "\x00" + string(rune(len(code)-1+'0')) + "\x00"
+	})
+
+	line = mdImage.ReplaceAllString(line, "!$1!")
+	line = mdLink.ReplaceAllString(line, "[$1|$2]")
+
+	//Bold is marked with \x01 until italics are done, since both use *
+	line = mdBold.ReplaceAllString(line, "\x01$2\x01")
+	line = mdItalic.ReplaceAllString(line, "${1}_${2}_$3")
+	line = strings.ReplaceAll(line, "\x01", "*")
+	line = mdStrike.ReplaceAllString(line, "-$1-")
+
+	for i, c := range code {
+		line = strings.Replace(line, "\x00"+string(rune(i+'0'))+"\x00", "{{"+c+"}}", 1)
+	}
+
+	return line
+}
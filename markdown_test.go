@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestMarkdownToJira(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"heading", "# Title", "h1. Title"},
+		{"deep heading", "### Steps ###", "h3. Steps"},
+		{"bold and italic", "**bold** and *italic* and _also_", "*bold* and _italic_ and _also_"},
+		{"strikethrough", "~~old~~ new", "-old- new"},
+		{"link", "see [the guide](https://example.com/guide)", "see [the guide|https://example.com/guide]"},
+		{"image", "![logo](https://example.com/logo.png)", "!https://example.com/logo.png!"},
+		{"inline code is left alone", "run `make *all*`", "run {{make *all*}}"},
+		{"lists", "- a\n  - b\n1. c", "* a\n** b\n# c"},
+		{"quote", "> note", "bq. note"},
+		{"rule", "---", "----"},
+		{"code block", "```go\nx := **1**\n```", "{code:go}\nx := **1**\n{code}"},
+		{"table", "| a | b |\n|---|---|\n| `1` | **2** |", "||a||b||\n|{{1}}|*2*|"},
+		{"plain text", "nothing to convert", "nothing to convert"},
+		{"windows line endings", "# A\r\nb", "h1. A\nb"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := markdownToJira(test.markdown); got != test.want {
+				t.Errorf("markdownToJira(%q) = %q, want %q", test.markdown, got, test.want)
+			}
+		})
+	}
+}
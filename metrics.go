@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	rowsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imp_rows_processed_total",
+		Help: "Repository rows processed, by outcome.",
+	}, []string{"status"})
+
+	ticketsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "imp_tickets_created_total",
+		Help: "Jira tickets created.",
+	})
+
+	slackFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "imp_slack_failures_total",
+		Help: "Slack notifications that could not be sent.",
+	})
+
+	catalogLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "imp_catalog_lookups_total",
+		Help: "Repository lookups against the service catalog, by result.",
+	}, []string{"result"})
+
+	apiLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "imp_api_request_duration_seconds",
+		Help:    "Latency of requests to external APIs, by API and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"api", "code"})
+)
+
+// serveMetrics exposes /metrics on addr in the background for as long as the
+// process runs.
+func serveMetrics(addr string) {
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
+
+// metricsTransport records the latency of every request made through it.
+type metricsTransport struct {
+	api  string
+	base http.RoundTripper
+}
+
+func newMetricsTransport(api string, base http.RoundTripper) *metricsTransport {
+
+	if base == nil {
+		base = httpTransport(api)
+	}
+
+	return &metricsTransport{api: api, base: base}
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiLatency.WithLabelValues(t.api, code).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/notify"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifierKinds returns the configured notifiers, slack unless set otherwise.
+// notifier may be a single name or a list to notify on several systems.
+func notifierKinds() []string {
+
+	kinds := []string{}
+	for _, kind := range viper.GetStringSlice("notifier") {
+		if kind = strings.ToLower(strings.TrimSpace(kind)); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	if len(kinds) == 0 {
+		return []string{"slack"}
+	}
+
+	return kinds
+}
+
+// notifierEnabled reports whether kind is one of the configured notifiers.
+func notifierEnabled(kind string) bool {
+
+	for _, k := range notifierKinds() {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newNotifiers creates the configured notifiers, each of which receives every
+// notification. Slack messages share the given client and rate limiter.
+func newNotifiers(api *slack.Client, slackLimit *rateLimiter, users *slackUsers) (*notify.FanOut, error) {
+
+	notifiers := &notify.FanOut{}
+	for _, kind := range notifierKinds() {
+		switch kind {
+		case "slack":
+			if slackWebhookMode() {
+				notifiers.Add(kind, newSlackWebhookNotifier(slackLimit))
+				break
+			}
+			mode := strings.ToLower(firstNonEmpty(viper.GetString("slack.notifyMode"), "channel"))
+			if mode != "channel" && mode != "dm" && mode != "mpdm" {
+				return nil, fmt.Errorf("unknown slack.notifyMode %q, expected channel, dm or mpdm", mode)
+			}
+			schedule, err := newDeliverySchedule(api)
+			if err != nil {
+				return nil, err
+			}
+			notifiers.Add(kind, &slackNotifier{
+				api:         api,
+				limit:       slackLimit,
+				channels:    newChannelPacer(viper.GetDuration("slack.channelInterval")),
+				users:       users,
+				mode:        mode,
+				acknowledge: viper.GetBool("slack.acknowledge"),
+				schedule:    schedule,
+			})
+		case "teams":
+			teams, err := newTeamsNotifier()
+			if err != nil {
+				return nil, err
+			}
+			notifiers.Add(kind, teams)
+		case "webhook":
+			webhook, err := newWebhookNotifier()
+			if err != nil {
+				return nil, err
+			}
+			notifiers.Add(kind, webhook)
+		default:
+			return nil, fmt.Errorf("unknown notifier %q, expected slack, teams or webhook", kind)
+		}
+	}
+
+	return notifiers, nil
+}
+
+// slackNotifier posts to the service's Slack channel, or with slack.notifyMode
+// dm or mpdm directly to the team members. Slack allows about one message per
+// second per channel, so posts are queued per channel on top of the overall
+// slack.requestsPerSecond limit.
+type slackNotifier struct {
+	api      *slack.Client
+	limit    *rateLimiter
+	channels *channelPacer
+	threads  *slackThreads
+	users    *slackUsers
+	mode     string
+
+	//Adds the Acknowledge and Snooze buttons handled by imp listen
+	acknowledge bool
+
+	//Holds notifications sent outside working hours until the next morning
+	schedule *deliverySchedule
+}
+
+// maxGroupDMUsers is the most people Slack allows in a group DM besides the
+// bot.
+const maxGroupDMUsers = 8
+
+func (s *slackNotifier) Notify(n notify.Notification) (string, error) {
+
+	if s.acknowledge {
+		n.Blocks = withAcknowledgeButtons(n)
+	}
+
+	//Outside working hours the message is scheduled instead of posted
+	delivery := []slack.MsgOption{}
+	scheduled := ""
+	if s.schedule != nil {
+		if postAt, ok := s.schedule.postAt(n.Service.Team, time.Now(), s.limit.Wait); ok {
+			scheduled = strconv.FormatInt(postAt.Unix(), 10)
+			delivery = append(delivery, slack.MsgOptionSchedule(scheduled))
+			slog.Info("Scheduling Slack message for working hours", "channel", n.Channel, "team", n.Service.Team.TeamId, "at", postAt)
+		}
+	}
+
+	var ts string
+	var err error
+	if s.mode == "dm" || s.mode == "mpdm" {
+		ts, err = s.notifyMembers(n, s.mode == "mpdm", delivery...)
+	} else {
+		ts, err = s.notifyChannel(n, delivery...)
+	}
+
+	//Scheduled messages have no timestamp until they are posted
+	if err == nil && scheduled != "" {
+		ts = "scheduled:" + scheduled
+	}
+
+	return ts, err
+}
+
+// notifyChannel posts the notification to its channel, in the channel's
+// thread when threads are enabled. Scheduled messages are not threaded.
+func (s *slackNotifier) notifyChannel(n notify.Notification, delivery ...slack.MsgOption) (string, error) {
+
+	ts := ""
+	err := s.channels.Do(n.Channel, func() error {
+		options := append([]slack.MsgOption{}, delivery...)
+		if s.threads != nil && len(delivery) == 0 {
+			parent, err := s.threads.parent(s.api, s.limit, n.Channel)
+			if err != nil {
+				return err
+			}
+			if parent != "" {
+				options = append(options, slack.MsgOptionTS(parent))
+			}
+		}
+
+		s.limit.Wait()
+
+		var err error
+		ts, err = sendSlackNotification(s.api, n.Channel, n.Text, n.Blocks, options...)
+		return err
+	})
+
+	return ts, err
+}
+
+// notifyMembers sends the notification as a direct message to every team
+// member found on Slack, or as a group DM to all of them when group is set.
+// Members who can't be reached are skipped with a warning; it only fails when
+// nobody could be notified.
+func (s *slackNotifier) notifyMembers(n notify.Notification, group bool, delivery ...slack.MsgOption) (string, error) {
+
+	ids := []string{}
+	for _, email := range teamEmails(n.Service.Team) {
+		s.limit.Wait()
+		id, err := s.users.Resolve(email)
+		if err != nil {
+			slog.Warn("Unable to resolve Slack user, not messaging them", "email", email, "error", err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	recipients := [][]string{}
+	for start := 0; start < len(ids); {
+		size := 1
+		if group {
+			size = maxGroupDMUsers
+		}
+		end := min(start+size, len(ids))
+		recipients = append(recipients, ids[start:end])
+		start = end
+	}
+
+	ts := ""
+	reached := false
+	var lastErr error
+	for _, users := range recipients {
+		s.limit.Wait()
+		conversation, _, _, err := s.api.OpenConversation(&slack.OpenConversationParameters{Users: users, ReturnIM: true})
+		if err != nil {
+			lastErr = fmt.Errorf("unable to open a conversation with %s: %w", strings.Join(users, ", "), err)
+			slog.Warn("Unable to message team members", "users", users, "error", err)
+			continue
+		}
+
+		s.limit.Wait()
+		id, err := sendSlackNotification(s.api, conversation.ID, n.Text, n.Blocks, delivery...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ts = firstNonEmpty(ts, id)
+		reached = true
+	}
+
+	if !reached {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no member of team %s was found on Slack", n.Service.Team.TeamId)
+		}
+		return "", lastErr
+	}
+
+	return ts, nil
+}
+
+// isSlackTs reports whether a notification ID recorded in the ledger is the
+// timestamp of a Slack message rather than the ID of another notifier.
+func isSlackTs(id string) bool {
+
+	return id != "" && !strings.Contains(id, ":")
+}
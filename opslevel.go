@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// opslevelQuery fetches one page of services with their repositories, tools
+// and owning team.
+const opslevelQuery = `query($after: String) {
+  account {
+    services(after: $after) {
+      pageInfo { hasNextPage endCursor }
+      nodes {
+        name
+        aliases
+        repos { edges { node { url } } }
+        tools { nodes { category url } }
+        tier { index }
+        language
+        owner {
+          alias
+          contacts { type address }
+          members { nodes { email } }
+        }
+      }
+    }
+  }
+}`
+
+// opslevelService is the part of the OpsLevel service type imp uses.
+type opslevelService struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Repos   struct {
+		Edges []struct {
+			Node struct {
+				URL string `json:"url"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"repos"`
+	Tools struct {
+		Nodes []struct {
+			Category string `json:"category"`
+			URL      string `json:"url"`
+		} `json:"nodes"`
+	} `json:"tools"`
+	Tier *struct {
+		Index int `json:"index"`
+	} `json:"tier"`
+	Language string `json:"language"`
+	Owner    *struct {
+		Alias    string `json:"alias"`
+		Contacts []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"contacts"`
+		Members struct {
+			Nodes []struct {
+				Email string `json:"email"`
+			} `json:"nodes"`
+		} `json:"members"`
+	} `json:"owner"`
+}
+
+// queryOpsLevel fetches every service from the OpsLevel GraphQL API at
+// opslevel.url, authenticated with opslevel.token.
+func queryOpsLevel() ([]catalog.Service, error) {
+
+	token := viper.GetString("opslevel.token")
+	if token == "" {
+		return nil, fmt.Errorf("opslevel.token is not configured; set it or use --catalog-file")
+	}
+
+	client := &http.Client{Transport: newMetricsTransport("opslevel", nil)}
+
+	services := []catalog.Service{}
+	after := ""
+	for {
+		variables := map[string]interface{}{}
+		if after != "" {
+			variables["after"] = after
+		}
+
+		body, err := json.Marshal(graphQLRequest{Query: opslevelQuery, Variables: variables})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, viper.GetString("opslevel.url"), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("opslevel request failed: %w", err)
+		}
+
+		byteValue, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read opslevel response: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("opslevel returned %s: %s", resp.Status, string(byteValue))
+		}
+
+		var result struct {
+			Data struct {
+				Account struct {
+					Services struct {
+						PageInfo catalog.PageInfo  `json:"pageInfo"`
+						Nodes    []opslevelService `json:"nodes"`
+					} `json:"services"`
+				} `json:"account"`
+			} `json:"data"`
+			Errors []graphQLError `json:"errors"`
+		}
+		if err := json.Unmarshal(byteValue, &result); err != nil {
+			return nil, fmt.Errorf("unable to parse opslevel response: %w", err)
+		}
+
+		if len(result.Errors) > 0 {
+			return nil, fmt.Errorf("opslevel query failed: %s", result.Errors[0].Message)
+		}
+
+		page := result.Data.Account.Services
+		for _, node := range page.Nodes {
+			services = append(services, opslevelToService(node))
+		}
+
+		if !page.PageInfo.HasNextPage {
+			return services, nil
+		}
+		if page.PageInfo.EndCursor == "" || page.PageInfo.EndCursor == after {
+			return nil, fmt.Errorf("opslevel returned a page without a new cursor")
+		}
+		after = page.PageInfo.EndCursor
+	}
+}
+
+// opslevelToService maps an OpsLevel service to a Service. The service is
+// identified by its first alias, the Slack channel is the owning team's slack
+// contact, the issue tracker is its issue_tracking tool, the tier is the
+// index of its OpsLevel tier and the language is its primary language.
+func opslevelToService(node opslevelService) catalog.Service {
+
+	service := catalog.Service{ServiceId: node.Name, Language: node.Language}
+	if len(node.Aliases) > 0 {
+		service.ServiceId = node.Aliases[0]
+	}
+	if node.Tier != nil {
+		service.Tier = strconv.Itoa(node.Tier.Index)
+	}
+
+	for _, edge := range node.Repos.Edges {
+		if edge.Node.URL != "" {
+			service.RepositoryUrls = append(service.RepositoryUrls, edge.Node.URL)
+		}
+	}
+
+	for _, tool := range node.Tools.Nodes {
+		if tool.Category == "issue_tracking" && tool.URL != "" {
+			service.IssueTrackerUrl = tool.URL
+			break
+		}
+	}
+
+	if node.Owner == nil {
+		return service
+	}
+
+	service.Team.TeamId = node.Owner.Alias
+	for _, member := range node.Owner.Members.Nodes {
+		if member.Email != "" {
+			service.Team.TeamMembers = append(service.Team.TeamMembers, catalog.TeamMember{User: catalog.User{Email: member.Email}})
+		}
+	}
+
+	//Slack accepts a channel name wherever it takes a channel ID
+	for _, contact := range node.Owner.Contacts {
+		if strings.EqualFold(contact.Type, "slack") && contact.Address != "" {
+			service.SlackGeneralChannel = catalog.SlackGeneralChannel{
+				ChannelId:   contact.Address,
+				ChannelName: strings.TrimPrefix(contact.Address, "#"),
+			}
+			break
+		}
+	}
+
+	return service
+}
@@ -0,0 +1,183 @@
+// Package catalog holds the services of the service catalog and looks
+// repositories up in it.
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SlackGeneralChannel is the channel a service's team is notified in.
+type SlackGeneralChannel struct {
+	ChannelId   string `json:"channelId"`
+	ChannelName string `json:"channelName"`
+}
+
+// User is a person in the catalog, identified by email.
+type User struct {
+	Email            string `json:"email"`
+	SlackDisplayName string `json:"slackDisplayName"`
+}
+
+// TeamMember is a member of a team.
+type TeamMember struct {
+	User User `json:"user"`
+}
+
+// Team owns services.
+type Team struct {
+	TeamId         string       `json:"teamId"`
+	Lead           User         `json:"lead"`
+	TeamMembers    []TeamMember `json:"teamMembers"`
+	SlackUsergroup string       `json:"slackUsergroup"`
+}
+
+// Service is a catalog entry: the repositories it is built from, where its
+// tickets are filed, the team that owns it, its tier, e.g. 1 for the most
+// critical services, and its main language.
+type Service struct {
+	ServiceId           string              `json:"serviceId"`
+	RepositoryUrls      []string            `json:"repositoryUrls"`
+	IssueTrackerUrl     string              `json:"issueTrackerUrl"`
+	SlackGeneralChannel SlackGeneralChannel `json:"slackGeneralChannel"`
+	Team                Team                `json:"team"`
+	Tier                string              `json:"tier,omitempty"`
+	Language            string              `json:"language,omitempty"`
+}
+
+// Node is one page of services.
+type Node struct {
+	Services []Service `json:"nodes"`
+	PageInfo *PageInfo `json:"pageInfo,omitempty"`
+}
+
+// PageInfo holds the cursor of the next page of services.
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// Data and DataSet wrap the services the way the BigBrother API and catalog
+// files do.
+type Data struct {
+	NodeList Node `json:"services"`
+}
+
+type DataSet struct {
+	Data Data `json:"data"`
+}
+
+// Lookup indexes services by their normalized repository URLs.
+type Lookup map[string]Service
+
+// NewLookup indexes services by every repository they list. A repository
+// listed by several services belongs to the last one.
+func NewLookup(services []Service) Lookup {
+
+	lookup := make(Lookup)
+
+	for _, itm := range services {
+		for _, repo := range itm.RepositoryUrls {
+			lookup[NormalizeRepoURL(repo)] = itm
+		}
+	}
+
+	return lookup
+}
+
+// Find returns the service a repository belongs to.
+func (l Lookup) Find(repository string) (Service, bool) {
+
+	service, ok := l[NormalizeRepoURL(repository)]
+	return service, ok
+}
+
+// NormalizeRepoURL reduces the different ways of writing a repository URL to
+// one form, so that git@github.com:org/x.git, ssh://git@github.com/org/x and
+// https://GitHub.com/org/x/ all become https://github.com/org/x.
+func NormalizeRepoURL(repository string) string {
+
+	repo := strings.TrimSpace(repository)
+
+	//scp-like syntax, user@host:path
+	if !strings.Contains(repo, "://") {
+		if at := strings.Index(repo, "@"); at >= 0 {
+			if host, path, ok := strings.Cut(repo[at+1:], ":"); ok {
+				repo = "https://" + host + "/" + path
+			}
+		}
+	}
+
+	parsed, err := url.Parse(repo)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimSuffix(strings.TrimRight(repo, "/"), ".git")
+	}
+
+	path := strings.TrimRight(parsed.Path, "/")
+	path = strings.TrimRight(strings.TrimSuffix(path, ".git"), "/")
+
+	return "https://" + strings.ToLower(parsed.Host) + path
+}
+
+// ReadFile reads a catalog file in the format of the BigBrother API response.
+func ReadFile(fileName string) ([]Service, error) {
+
+	byteValue, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read catalog file: %w", err)
+	}
+
+	var dataSet DataSet
+	if err := json.Unmarshal(byteValue, &dataSet); err != nil {
+		return nil, fmt.Errorf("unable to parse catalog file: %w", err)
+	}
+
+	return dataSet.Data.NodeList.Services, nil
+}
+
+// WriteFile writes services in the format read by ReadFile.
+func WriteFile(services []Service, fileName string) error {
+
+	var dataSet DataSet
+	dataSet.Data.NodeList.Services = services
+
+	byteValue, err := json.MarshalIndent(dataSet, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, byteValue, 0644)
+}
+
+// Problems lists the data-quality holes in a catalog entry that would make a
+// run fail or notify the wrong people.
+func Problems(service Service) []string {
+
+	problems := []string{}
+
+	if len(service.RepositoryUrls) == 0 {
+		problems = append(problems, "no repository urls")
+	}
+
+	if service.SlackGeneralChannel.ChannelId == "" && service.SlackGeneralChannel.ChannelName == "" {
+		problems = append(problems, "no slack channel")
+	}
+
+	if service.Team.TeamId == "" {
+		problems = append(problems, "no team")
+	} else if len(service.Team.TeamMembers) == 0 && service.Team.Lead.Email == "" {
+		problems = append(problems, fmt.Sprintf("team %s has no members", service.Team.TeamId))
+	}
+
+	if trackerUrl := service.IssueTrackerUrl; trackerUrl != "" {
+		parsed, err := url.Parse(trackerUrl)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("malformed issue tracker url %q", trackerUrl))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,53 @@
+package catalog
+
+import "testing"
+
+func TestNormalizeRepoURL(t *testing.T) {
+
+	tests := []struct {
+		repository string
+		want       string
+	}{
+		{"https://github.com/org/x", "https://github.com/org/x"},
+		{"https://GitHub.com/org/x/", "https://github.com/org/x"},
+		{" https://github.com/org/x.git ", "https://github.com/org/x"},
+		{"https://github.com/org/x.git/", "https://github.com/org/x"},
+		{"http://github.com/org/x", "https://github.com/org/x"},
+		{"git@github.com:org/x.git", "https://github.com/org/x"},
+		{"ssh://git@github.com/org/x", "https://github.com/org/x"},
+		{"https://gitlab.example.com/group/sub/x", "https://gitlab.example.com/group/sub/x"},
+		{"https://github.com/org/X", "https://github.com/org/X"},
+		{"org/x.git", "org/x"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeRepoURL(test.repository); got != test.want {
+			t.Errorf("NormalizeRepoURL(%q) = %q, want %q", test.repository, got, test.want)
+		}
+	}
+}
+
+func TestLookupFind(t *testing.T) {
+
+	lookup := NewLookup([]Service{
+		{ServiceId: "svc-a", RepositoryUrls: []string{"git@github.com:org/a.git"}},
+		{ServiceId: "svc-b", RepositoryUrls: []string{"https://github.com/org/b", "https://github.com/org/b-docs"}},
+	})
+
+	tests := []struct {
+		repository string
+		service    string
+	}{
+		{"https://github.com/org/a", "svc-a"},
+		{"https://GITHUB.com/org/b-docs/", "svc-b"},
+		{"https://github.com/org/c", ""},
+	}
+
+	for _, test := range tests {
+		service, ok := lookup.Find(test.repository)
+		if ok != (test.service != "") || service.ServiceId != test.service {
+			t.Errorf("Find(%q) = %q, %v, want %q", test.repository, service.ServiceId, ok, test.service)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package notify defines the notifications sent to teams about their
+// tickets and the interface of the systems that deliver them.
+package notify
+
+import (
+	"github.com/slack-go/slack"
+	"imp/pkg/catalog"
+	"strings"
+	"sync"
+)
+
+// Notification is the message telling a team about their ticket.
+type Notification struct {
+	RunID      string
+	Service    catalog.Service
+	Repository string
+	Channel    string
+	Text       string
+	Blocks     []slack.Block
+	Data       map[string]interface{}
+}
+
+// Notifier delivers notifications to one chat system.
+type Notifier interface {
+	// Notify sends the notification and returns an identifier of the
+	// message that was posted.
+	Notify(n Notification) (string, error)
+}
+
+// FanOut delivers each notification to several notifiers at once. The
+// notifiers are isolated from each other: every one is tried however the
+// others fare, so a failing or slow sink doesn't hold back the rest.
+type FanOut struct {
+	names     []string
+	notifiers []Notifier
+}
+
+// Add appends a notifier under the name failures are reported with.
+func (f *FanOut) Add(name string, notifier Notifier) {
+
+	f.names = append(f.names, name)
+	f.notifiers = append(f.notifiers, notifier)
+}
+
+// Notifiers returns the notifiers in the order they were added.
+func (f *FanOut) Notifiers() []Notifier {
+
+	return f.notifiers
+}
+
+// Only returns a fan-out to the named notifiers, e.g. to retry the ones that
+// failed.
+func (f *FanOut) Only(names []string) *FanOut {
+
+	only := &FanOut{}
+	for i, name := range f.names {
+		for _, wanted := range names {
+			if name == wanted {
+				only.Add(name, f.notifiers[i])
+				break
+			}
+		}
+	}
+
+	return only
+}
+
+// Notify sends the notification to every notifier and returns the message
+// identifier from the first one, in the order they were added, that
+// succeeded. When any fail the error is a *FanOutError naming them.
+func (f *FanOut) Notify(n Notification) (string, error) {
+
+	ids := make([]string, len(f.notifiers))
+	errs := make([]error, len(f.notifiers))
+
+	var wg sync.WaitGroup
+	for i, notifier := range f.notifiers {
+		wg.Add(1)
+		go func(i int, notifier Notifier) {
+			defer wg.Done()
+			ids[i], errs[i] = notifier.Notify(n)
+		}(i, notifier)
+	}
+	wg.Wait()
+
+	id := ""
+	failed := &FanOutError{}
+	for i, err := range errs {
+		if err != nil {
+			failed.Names = append(failed.Names, f.names[i])
+			failed.Errs = append(failed.Errs, err)
+			continue
+		}
+		if id == "" {
+			id = ids[i]
+		}
+	}
+
+	if len(failed.Names) > 0 {
+		return id, failed
+	}
+
+	return id, nil
+}
+
+// FanOutError reports the notifiers of a fan-out that failed.
+type FanOutError struct {
+	Names []string
+	Errs  []error
+}
+
+func (e *FanOutError) Error() string {
+
+	msgs := make([]string, len(e.Names))
+	for i, name := range e.Names {
+		msgs[i] = name + ": " + e.Errs[i].Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (e *FanOutError) Unwrap() []error {
+	return e.Errs
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNotifier returns its id, or err when set, and counts its calls.
+type fakeNotifier struct {
+	id    string
+	err   error
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (f *fakeNotifier) Notify(n Notification) (string, error) {
+
+	f.calls.Add(1)
+	time.Sleep(f.delay)
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.id, nil
+}
+
+func TestFanOut(t *testing.T) {
+
+	errDown := errors.New("down")
+	errGone := errors.New("gone")
+
+	tests := []struct {
+		name      string
+		notifiers []*fakeNotifier
+		wantID    string
+		wantNames []string
+	}{
+		{
+			name:      "all succeed",
+			notifiers: []*fakeNotifier{{id: "slack-ts"}, {id: "teams"}},
+			wantID:    "slack-ts",
+		},
+		{
+			name:      "id of the first that succeeded",
+			notifiers: []*fakeNotifier{{err: errDown}, {id: "teams", delay: 5 * time.Millisecond}, {id: "webhook"}},
+			wantID:    "teams",
+			wantNames: []string{"n0"},
+		},
+		{
+			name:      "all fail",
+			notifiers: []*fakeNotifier{{err: errDown}, {err: errGone}},
+			wantNames: []string{"n0", "n1"},
+		},
+		{
+			name: "none",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			f := &FanOut{}
+			for i, notifier := range test.notifiers {
+				f.Add(fmt.Sprintf("n%d", i), notifier)
+			}
+
+			id, err := f.Notify(Notification{Repository: "https://github.com/org/a"})
+			if id != test.wantID {
+				t.Errorf("Notify() id = %q, want %q", id, test.wantID)
+			}
+			for i, notifier := range test.notifiers {
+				if calls := notifier.calls.Load(); calls != 1 {
+					t.Errorf("notifier %d called %d times, want once", i, calls)
+				}
+			}
+
+			if test.wantNames == nil {
+				if err != nil {
+					t.Errorf("Notify() error = %v, want nil", err)
+				}
+				return
+			}
+			var failed *FanOutError
+			if !errors.As(err, &failed) {
+				t.Fatalf("Notify() error = %v, want a *FanOutError", err)
+			}
+			if !reflect.DeepEqual(failed.Names, test.wantNames) {
+				t.Errorf("FanOutError.Names = %v, want %v", failed.Names, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestFanOutError(t *testing.T) {
+
+	errDown := errors.New("down")
+	errGone := errors.New("gone")
+	err := error(&FanOutError{Names: []string{"slack", "webhook"}, Errs: []error{errDown, errGone}})
+
+	if got, want := err.Error(), "slack: down; webhook: gone"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, errDown) || !errors.Is(err, errGone) {
+		t.Errorf("errors.Is() doesn't find the notifier errors in %v", err)
+	}
+}
+
+func TestFanOutOnly(t *testing.T) {
+
+	slack, teams, webhook := &fakeNotifier{id: "slack"}, &fakeNotifier{id: "teams"}, &fakeNotifier{id: "webhook"}
+	f := &FanOut{}
+	f.Add("slack", slack)
+	f.Add("teams", teams)
+	f.Add("webhook", webhook)
+
+	only := f.Only([]string{"webhook", "teams", "unknown"})
+	if got, want := only.Notifiers(), []Notifier{teams, webhook}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Only() = %v, want teams and webhook in the order added", got)
+	}
+
+	if _, err := only.Notify(Notification{}); err != nil {
+		t.Fatal(err)
+	}
+	if slack.calls.Load() != 0 || teams.calls.Load() != 1 || webhook.calls.Load() != 1 {
+		t.Errorf("calls = slack %d, teams %d, webhook %d, want only teams and webhook", slack.calls.Load(), teams.calls.Load(), webhook.calls.Load())
+	}
+}
@@ -0,0 +1,121 @@
+// Package run processes the rows of a repository file with a pool of
+// workers and collects their results.
+package run
+
+import (
+	"context"
+	"sync"
+)
+
+// Row statuses reported at the end of a run.
+const (
+	StatusCreated   = "created"
+	StatusUpdated   = "updated"
+	StatusSkipped   = "skipped"
+	StatusUnmatched = "unmatched"
+	StatusDryRun    = "dry-run"
+	StatusPlanned   = "planned"
+	StatusFailed    = "failed"
+	StatusExcluded  = "excluded"
+
+	StatusInterrupted = "interrupted"
+)
+
+// Row is a single line of the repository file: the repository and the
+// remaining columns, both in order and, when the file has a header row, by
+// column name.
+type Row struct {
+	Repository string            `json:"repository"`
+	Columns    []string          `json:"columns,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Result is the outcome of processing one row of the repository file.
+type Result struct {
+	Repository string
+	Service    string
+	JiraKey    string
+	Channel    string
+	Status     string
+	Err        error
+}
+
+// Processor handles a single row. It is called from several workers at once.
+type Processor interface {
+	Process(row Row) Result
+}
+
+// Runner processes every row of a run with a pool of workers.
+type Runner struct {
+	Processor Processor
+
+	// Concurrency is the number of rows processed at once, at least one.
+	Concurrency int
+
+	// Done holds the results of rows completed by an earlier attempt at the
+	// run, by repository. Those rows keep their result and are not
+	// processed again.
+	Done map[string]Result
+
+	// OnResult, when set, is called by the workers with the result of every
+	// row they process.
+	OnResult func(Result)
+}
+
+// Run processes the rows and returns their results in the same order as the
+// rows, regardless of completion order. Once ctx is cancelled no more rows
+// are started, the rows in flight finish and the rows left are reported as
+// interrupted.
+func (r *Runner) Run(ctx context.Context, rows []Row) []Result {
+
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Result, len(rows))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if prior, ok := r.Done[rows[i].Repository]; ok {
+					results[i] = prior
+					continue
+				}
+
+				results[i] = r.Processor.Process(rows[i])
+				if r.OnResult != nil {
+					r.OnResult(results[i])
+				}
+			}
+		}()
+	}
+
+	dispatched := 0
+dispatch:
+	for dispatched < len(rows) {
+		select {
+		case jobs <- dispatched:
+			dispatched++
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+
+	for i := dispatched; i < len(rows); i++ {
+		if prior, ok := r.Done[rows[i].Repository]; ok {
+			results[i] = prior
+			continue
+		}
+		results[i] = Result{Repository: rows[i].Repository, Status: StatusInterrupted}
+	}
+
+	return results
+}
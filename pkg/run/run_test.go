@@ -0,0 +1,171 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// processorFunc adapts a function to a Processor.
+type processorFunc func(row Row) Result
+
+func (f processorFunc) Process(row Row) Result {
+	return f(row)
+}
+
+func testRows(n int) []Row {
+
+	rows := []Row{}
+	for i := 0; i < n; i++ {
+		rows = append(rows, Row{Repository: fmt.Sprintf("r%d", i)})
+	}
+
+	return rows
+}
+
+func TestRunnerKeepsRowOrder(t *testing.T) {
+
+	//Later rows finish first
+	rows := testRows(8)
+	runner := &Runner{
+		Concurrency: 4,
+		Processor: processorFunc(func(row Row) Result {
+			var i int
+			fmt.Sscanf(row.Repository, "r%d", &i)
+			time.Sleep(time.Duration(8-i) * time.Millisecond)
+			return Result{Repository: row.Repository, Status: StatusCreated}
+		}),
+	}
+
+	got := []string{}
+	for _, result := range runner.Run(context.Background(), rows) {
+		got = append(got, result.Repository)
+	}
+	want := []string{"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() = %v, want %v", got, want)
+	}
+}
+
+func TestRunnerConcurrency(t *testing.T) {
+
+	tests := []struct {
+		concurrency int
+		want        int32
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.concurrency), func(t *testing.T) {
+
+			var inFlight, max atomic.Int32
+			runner := &Runner{
+				Concurrency: test.concurrency,
+				Processor: processorFunc(func(row Row) Result {
+					n := inFlight.Add(1)
+					for {
+						m := max.Load()
+						if n <= m || max.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					inFlight.Add(-1)
+					return Result{Repository: row.Repository, Status: StatusCreated}
+				}),
+			}
+
+			results := runner.Run(context.Background(), testRows(9))
+			if len(results) != 9 {
+				t.Fatalf("Run() returned %d results, want 9", len(results))
+			}
+			if got := max.Load(); got > test.want {
+				t.Errorf("%d rows processed at once, want at most %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunnerDone(t *testing.T) {
+
+	var mu sync.Mutex
+	processed := []string{}
+	reported := []string{}
+	runner := &Runner{
+		Concurrency: 2,
+		Done:        map[string]Result{"r1": {Repository: "r1", JiraKey: "MIG-1", Status: StatusCreated}},
+		Processor: processorFunc(func(row Row) Result {
+			mu.Lock()
+			processed = append(processed, row.Repository)
+			mu.Unlock()
+			return Result{Repository: row.Repository, Status: StatusSkipped}
+		}),
+		OnResult: func(result Result) {
+			mu.Lock()
+			reported = append(reported, result.Repository)
+			mu.Unlock()
+		},
+	}
+
+	results := runner.Run(context.Background(), testRows(3))
+
+	if results[1].JiraKey != "MIG-1" || results[1].Status != StatusCreated {
+		t.Errorf("Run() result for a done row = %+v, want the earlier result", results[1])
+	}
+	if results[0].Status != StatusSkipped || results[2].Status != StatusSkipped {
+		t.Errorf("Run() = %+v, want r0 and r2 processed", results)
+	}
+	for _, list := range [][]string{processed, reported} {
+		if len(list) != 2 {
+			t.Errorf("processed and reported %v, want only r0 and r2", list)
+		}
+		for _, repository := range list {
+			if repository == "r1" {
+				t.Errorf("done row r1 was processed or reported again")
+			}
+		}
+	}
+}
+
+func TestRunnerCancellation(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &Runner{
+		Concurrency: 1,
+		Done:        map[string]Result{"r3": {Repository: "r3", JiraKey: "MIG-3", Status: StatusCreated}},
+		Processor: processorFunc(func(row Row) Result {
+			//Cancelled while the only worker is busy, so nothing else is started
+			cancel()
+			time.Sleep(20 * time.Millisecond)
+			return Result{Repository: row.Repository, Status: StatusCreated}
+		}),
+	}
+
+	results := runner.Run(ctx, testRows(5))
+
+	want := []string{StatusCreated, StatusInterrupted, StatusInterrupted, StatusCreated, StatusInterrupted}
+	got := []string{}
+	for _, result := range results {
+		got = append(got, result.Status)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() statuses = %v, want %v", got, want)
+	}
+	if results[3].JiraKey != "MIG-3" {
+		t.Errorf("Run() result for a done row = %+v, want the earlier result", results[3])
+	}
+	for i, result := range results {
+		if result.Repository != fmt.Sprintf("r%d", i) {
+			t.Errorf("Run() result %d is for %s", i, result.Repository)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package tracker defines the issues imp files and the interface of the
+// issue trackers they are filed in.
+package tracker
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"imp/pkg/catalog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Issue is a ticket to file, in the tracker-neutral shape every tracker
+// converts from. Jira-only fields are ignored by the other trackers.
+type Issue struct {
+	ID          string       `json:"id"`
+	Key         string       `json:"key"`
+	ProjectKey  string       `json:"project_key"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Description string       `json:"description"`
+	Repository  string       `json:"repository,omitempty"`
+	Assignee    *jira.User   `json:"assignee,omitempty"`
+	Reporter    *jira.User   `json:"reporter,omitempty"`
+	Watchers    []*jira.User `json:"watchers,omitempty"`
+	Labels      []string     `json:"labels,omitempty"`
+	Components  []string     `json:"components,omitempty"`
+	Epic        string       `json:"epic,omitempty"`
+	Parent      string       `json:"parent,omitempty"`
+	Sprint      string       `json:"sprint,omitempty"`
+	FixVersion  string       `json:"fixVersion,omitempty"`
+	Priority    string       `json:"priority,omitempty"`
+	DueDate     string       `json:"dueDate,omitempty"`
+	StoryPoints float64      `json:"storyPoints,omitempty"`
+
+	CustomFields map[string]interface{} `json:"customFields,omitempty"`
+}
+
+// Tracker is an issue tracker tickets are filed in.
+type Tracker interface {
+	// Project returns where the ticket for a repository of the service is
+	// created: a Jira project key, a GitHub owner/repo or a GitLab
+	// group/project.
+	Project(service catalog.Service, repository string) (string, error)
+
+	// CreateIssue files the issue and returns its key.
+	CreateIssue(issue Issue) (string, error)
+
+	// FindExisting returns the key of an open issue created for the
+	// repository by an earlier run, or an empty string.
+	FindExisting(issue Issue, repository string) (string, error)
+
+	// UpdateDescription replaces the description of an existing issue.
+	UpdateDescription(key string, description string) error
+
+	// Comment adds a comment to an existing issue.
+	Comment(key string, body string) error
+
+	// Transition moves an existing issue to the named status, or through
+	// the named workflow transition.
+	Transition(key string, name string) error
+}
+
+// Factory creates a tracker, configured however the program embedding it is.
+type Factory func() (Tracker, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a tracker available under name, case-insensitively. It is
+// meant to be called from init and panics when name is already taken.
+func Register(name string, factory Factory) {
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic("tracker: Register factory is nil for " + name)
+	}
+	if _, taken := registry[name]; taken {
+		panic("tracker: Register called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates the tracker registered under name.
+func New(name string) (Tracker, error) {
+
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown tracker %q, expected one of %s", name, strings.Join(Names(), ", "))
+	}
+
+	return factory()
+}
+
+// Names returns the registered trackers in alphabetical order.
+func Names() []string {
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,93 @@
+package tracker
+
+import (
+	"errors"
+	"imp/pkg/catalog"
+	"strings"
+	"testing"
+)
+
+// fakeTracker is a Tracker that files nothing.
+type fakeTracker struct {
+	name string
+}
+
+func (f *fakeTracker) Project(service catalog.Service, repository string) (string, error) {
+	return f.name, nil
+}
+
+func (f *fakeTracker) CreateIssue(issue Issue) (string, error) {
+	return "", nil
+}
+
+func (f *fakeTracker) FindExisting(issue Issue, repository string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeTracker) UpdateDescription(key string, description string) error {
+	return nil
+}
+
+func (f *fakeTracker) Comment(key string, body string) error {
+	return nil
+}
+
+func (f *fakeTracker) Transition(key string, name string) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+
+	Register("Test-Alpha", func() (Tracker, error) { return &fakeTracker{name: "alpha"}, nil })
+	Register("test-beta", func() (Tracker, error) { return nil, errors.New("beta is not configured") })
+
+	for _, name := range []string{"test-alpha", "TEST-ALPHA", "Test-Alpha"} {
+		tracker, err := New(name)
+		if err != nil {
+			t.Fatalf("New(%q): %v", name, err)
+		}
+		if project, _ := tracker.Project(catalog.Service{}, ""); project != "alpha" {
+			t.Errorf("New(%q) = %v, want the alpha tracker", name, tracker)
+		}
+	}
+
+	if _, err := New("test-beta"); err == nil || err.Error() != "beta is not configured" {
+		t.Errorf("New(\"test-beta\") error = %v, want the factory's error", err)
+	}
+
+	_, err := New("test-gamma")
+	if err == nil || !strings.Contains(err.Error(), "test-alpha, test-beta") {
+		t.Errorf("New(\"test-gamma\") error = %v, want one listing the registered trackers", err)
+	}
+
+	names := strings.Join(Names(), ",")
+	if !strings.Contains(names, "test-alpha,test-beta") {
+		t.Errorf("Names() = %s, want test-alpha and test-beta in order", names)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+
+	Register("test-taken", func() (Tracker, error) { return &fakeTracker{}, nil })
+
+	tests := []struct {
+		name     string
+		register string
+		factory  Factory
+	}{
+		{"taken", "test-taken", func() (Tracker, error) { return &fakeTracker{}, nil }},
+		{"taken in another case", "TEST-TAKEN", func() (Tracker, error) { return &fakeTracker{}, nil }},
+		{"nil factory", "test-nil", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", test.register)
+				}
+			}()
+			Register(test.register, test.factory)
+		})
+	}
+}
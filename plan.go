@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"imp/pkg/tracker"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+// The key and URL of a ticket to be created are only known once imp apply
+// creates it, so the notifications of a plan refer to them by placeholder.
+const (
+	planKeyPlaceholder = "${jira_ticket}"
+	planURLPlaceholder = "${jira_url}"
+)
+
+// plan is the file written by imp plan and carried out by imp apply.
+type plan struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Tracker   string          `json:"tracker"`
+	BaseURL   string          `json:"baseUrl"`
+	Tickets   []plannedTicket `json:"tickets"`
+}
+
+// plannedTicket is what imp apply does for one repository: create is a new
+// ticket and its notification, update replaces the description of the
+// existing ticket Key, and notify sends the notification of Key, a ticket an
+// earlier run created but could not announce.
+type plannedTicket struct {
+	Action    string          `json:"action"`
+	Row       run.Row         `json:"row"`
+	Service   catalog.Service `json:"service"`
+	Issue     tracker.Issue   `json:"issue"`
+	Key       string          `json:"key,omitempty"`
+	Comment   bool            `json:"comment,omitempty"`
+	Channel   string          `json:"channel,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Blocks    string          `json:"blocks,omitempty"`
+	Mentions  string          `json:"mentions,omitempty"`
+	Usergroup string          `json:"usergroup,omitempty"`
+}
+
+// planRecorder collects the planned tickets from the workers of a run.
+type planRecorder struct {
+	mu      sync.Mutex
+	tickets []plannedTicket
+}
+
+// Add records the ticket planned for a repository.
+func (p *planRecorder) Add(ticket plannedTicket) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tickets = append(p.tickets, ticket)
+}
+
+var planFlags struct {
+	createOptions
+	repoFile string
+	out      string
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [file|-]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Write the tickets imp create would file to a plan file for review",
+	Long: `Render the ticket and notification of every repository as imp create would,
+without creating anything, and write them to a plan file. imp apply then
+files exactly the tickets in the plan, so a reviewer can approve them first.`,
+	RunE: runPlan,
+}
+
+func init() {
+
+	flags := planCmd.Flags()
+
+	//List of repositories to plan tickets for
+	flags.StringVarP(&planFlags.repoFile, "file", "f", "", "list of repositories, - for stdin")
+	addInputFlags(flags)
+
+	//Where the plan is written
+	flags.StringVarP(&planFlags.out, "out", "o", "plan.json", "plan file to write")
+
+	//Same ticket settings as imp create
+	flags.StringVar(&planFlags.summaryTemplate, "summary-temp", "", "jira ticket summary template")
+	flags.StringVar(&planFlags.jiraTemplateFile, "jtemp", "", "jira ticket description template")
+	flags.StringVar(&planFlags.slackTemplateFile, "stemp", "", "slack message template, defaults to slack.messageTemplate or a built-in message")
+	flags.StringVar(&planFlags.blocksTemplate, "blocks-temp", "", "slack block kit layout template")
+	flags.IntVarP(&planFlags.concurrency, "concurrency", "c", 1, "number of repositories to render in parallel")
+	flags.BoolVar(&planFlags.ignoreLedger, "ignore-ledger", false, "do not skip repositories already recorded in the ledger")
+	flags.StringSliceVar(&planFlags.labels, "labels", nil, "comma separated labels added to every ticket")
+	flags.StringVar(&planFlags.epic, "epic", "", "key of an existing epic to link every ticket to, defaults to jira.epic")
+	flags.StringVar(&planFlags.sprint, "sprint", "", "add every ticket to this sprint id, or to the active sprint of its project's board with active")
+	flags.StringVar(&planFlags.fixVersion, "fix-version", "", "fix version set on every ticket and created when missing, defaults to jira.fixVersion")
+	flags.StringVar(&planFlags.mode, "mode", "create", "create: handle existing tickets as jira.duplicates says, upsert: update them and add a comment")
+	flags.StringArrayVar(&planFlags.filters, "filter", nil, "key=value selecting repositories by the team, tier, service, channel or language of their service, repeatable")
+	flags.StringSliceVar(&planFlags.exclude, "exclude", nil, "repositories or service IDs to skip even if listed in the file")
+	flags.StringVar(&planFlags.excludeFile, "exclude-file", "", "file listing repositories or service IDs to skip, one per line")
+	flags.IntVar(&planFlags.offset, "offset", 0, "skip this many repositories of the file, after --filter")
+	flags.IntVar(&planFlags.limit, "limit", 0, "process at most this many repositories, after --offset")
+	flags.IntVar(&planFlags.sample, "sample", 0, "process this many repositories spread evenly over the file, after --filter")
+
+	rootCmd.AddCommand(planCmd)
+}
+
+func runPlan(cmd *cobra.Command, args []string) error {
+
+	repoFile, err := repositoryFileArg(planFlags.repoFile, args)
+	if err != nil {
+		return err
+	}
+
+	repositoryList, err := readRepositoryFile(repoFile)
+	if err != nil {
+		return err
+	}
+
+	opts := planFlags.createOptions
+	opts.dryRun = true
+
+	c, err := newCreator(opts, repositoryList)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	//Parents are created while the subtasks are, which a plan can't wait for
+	if c.subtasks {
+		return configError(fmt.Errorf("imp plan does not support subtasks, use imp create --subtasks"))
+	}
+
+	if len(c.rows) == 0 && len(repositoryList) > 0 {
+		return withExitCode(exitNoMatches, fmt.Errorf("none of the %d repositories were selected by --exclude, --filter and --offset", len(repositoryList)))
+	}
+
+	if err := c.prepare(cmd.Context(), opts); err != nil {
+		return err
+	}
+
+	c.plan = &planRecorder{}
+	results := c.run(cmd.Context(), c.rows)
+
+	//Tickets in the order of the repository file
+	order := make(map[string]int)
+	for i, row := range c.rows {
+		order[row.Repository] = i
+	}
+	tickets := c.plan.tickets
+	sort.SliceStable(tickets, func(i, j int) bool {
+		return order[tickets[i].Row.Repository] < order[tickets[j].Row.Repository]
+	})
+
+	p := plan{
+		Version:   planVersion,
+		CreatedAt: time.Now().UTC(),
+		Tracker:   trackerKind(),
+		BaseURL:   viper.GetString(trackerKind() + ".baseurl"),
+		Tickets:   tickets,
+	}
+	if err := writePlan(p, planFlags.out); err != nil {
+		return err
+	}
+
+	printRunSummary(results)
+	printPlan(p)
+	fmt.Printf("Plan written to %s, file it with: imp apply %s\n", planFlags.out, planFlags.out)
+
+	if failures := printFailures(results); failures > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d of %d repositories could not be planned", failures, len(results)))
+	}
+
+	return nil
+}
+
+// writePlan writes a plan as indented JSON, for reviewing and diffing.
+func writePlan(p plan, fileName string) error {
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, append(data, '\n'), 0644)
+}
+
+// readPlan reads a plan file written by imp plan.
+func readPlan(fileName string) (plan, error) {
+
+	var p plan
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("invalid plan file %s: %w", fileName, err)
+	}
+	if p.Version != planVersion {
+		return p, fmt.Errorf("plan file %s has version %d, this imp reads version %d", fileName, p.Version, planVersion)
+	}
+
+	return p, nil
+}
+
+// printPlan lists what a plan does for each repository.
+func printPlan(p plan) {
+
+	writePlanPreview(os.Stdout, p)
+}
+
+// writePlanPreview writes the list printed by printPlan.
+func writePlanPreview(out io.Writer, p plan) {
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tREPOSITORY\tPROJECT\tTICKET\tSUMMARY")
+	for _, ticket := range p.Tickets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", ticket.Action, ticket.Row.Repository, ticket.Issue.ProjectKey, firstNonEmpty(ticket.Key, "(new)"), ticket.Issue.Name)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "%d tickets planned\n", len(p.Tickets))
+}
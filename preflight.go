@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// createMetaField is a field on the create screen of an issue type, as
+// returned by the createmeta API. Cloud lists them under fields, Data Center
+// under values.
+type createMetaField struct {
+	FieldID         string `json:"fieldId"`
+	Name            string `json:"name"`
+	Required        bool   `json:"required"`
+	HasDefaultValue bool   `json:"hasDefaultValue"`
+}
+
+// alwaysSetFields are the fields imp sets on every ticket, or that Jira
+// fills in itself, so they never count as missing required fields.
+var alwaysSetFields = map[string]bool{
+	"summary":     true,
+	"issuetype":   true,
+	"project":     true,
+	"description": true,
+	"reporter":    true,
+	"parent":      true,
+}
+
+// preflightOptions describes the tickets a run is about to create.
+type preflightOptions struct {
+	labels     []string
+	subtasks   bool
+	createEpic bool
+}
+
+// preflightCreate checks the Jira projects the repositories route to before
+// anything is created, printing each problem found. It fails when there are
+// any, so a broken config stops the run instead of failing every row.
+func preflightCreate(t *jiraTracker, repositoryList []run.Row, repoLookup catalog.Lookup, opts preflightOptions) error {
+
+	projects := map[string]bool{}
+	for _, row := range repositoryList {
+		if service, ok := repoLookup.Find(row.Repository); ok {
+			projects[projectKeyFor(service)] = true
+		}
+	}
+
+	issueTypes := []string{"Task"}
+	if opts.subtasks {
+		issueTypes = []string{
+			firstNonEmpty(viper.GetString("jira.parentType"), "Task"),
+			firstNonEmpty(viper.GetString("jira.subtaskType"), "Sub-task"),
+		}
+	}
+
+	problems := []string{}
+	for _, key := range sortedKeys(projects) {
+		found, err := t.preflight(key, issueTypes, ticketFields(opts.labels))
+		if err != nil {
+			return err
+		}
+		problems = append(problems, found...)
+	}
+
+	if opts.createEpic {
+		fields := []string{}
+		if field := viper.GetString("jira.epicNameField"); field != "" {
+			fields = append(fields, field)
+		}
+		found, err := t.preflight(viper.GetString("jira.projectKey"), []string{"Epic"}, fields)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, found...)
+	}
+
+	for _, problem := range problems {
+		fmt.Printf("preflight: %s\n", problem)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d preflight problems found", len(problems))
+	}
+
+	return nil
+}
+
+// ticketFields returns the IDs of the fields the config sets on tickets,
+// other than those in alwaysSetFields.
+func ticketFields(labels []string) []string {
+
+	fields := []string{}
+
+	add := func(set bool, id string) {
+		if set && id != "" {
+			fields = append(fields, id)
+		}
+	}
+
+	add(len(labels) > 0, "labels")
+	add(viper.GetString("jira.assignee") != "", "assignee")
+	add(len(viper.GetStringSlice("jira.components")) > 0 || len(viper.GetStringMap("jira.componentMap")) > 0, "components")
+	add(viper.GetString("jira.fixVersion") != "", "fixVersions")
+	add(viper.GetString("jira.priority") != "", "priority")
+	add(viper.GetString("jira.dueDate") != "", "duedate")
+	add(viper.GetString("jira.storyPoints") != "", viper.GetString("jira.storyPointsField"))
+	add(viper.GetString("jira.epic") != "", viper.GetString("jira.epicLinkField"))
+
+	for id := range configMap("jira.customFields") {
+		fields = append(fields, id)
+	}
+	mapping, _ := columnFields()
+	for _, field := range mapping {
+		fields = append(fields, field.Field)
+	}
+
+	return fields
+}
+
+// preflight checks that a project exists, offers each issue type, has each
+// field on the create screen of those types, and requires no field imp leaves
+// empty. It returns the problems found.
+func (t *jiraTracker) preflight(projectKey string, issueTypes []string, fields []string) ([]string, error) {
+
+	if projectKey == "" {
+		return []string{"no project key: set jira.projectKey or jira.projects"}, nil
+	}
+
+	t.mu.Lock()
+	project, err := t.projectLocked(projectKey)
+	t.mu.Unlock()
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	problems := []string{}
+	for _, name := range issueTypes {
+		issueType := projectIssueType(project, name)
+		if issueType == nil {
+			problems = append(problems, fmt.Sprintf("project %s has no issue type %q", projectKey, name))
+			continue
+		}
+
+		screen, err := createMetaFields(t.client, projectKey, issueType.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		onScreen := map[string]bool{}
+		for _, field := range screen {
+			onScreen[strings.ToLower(field.FieldID)] = true
+		}
+
+		set := map[string]bool{}
+		for _, id := range fields {
+			set[strings.ToLower(id)] = true
+			if !onScreen[strings.ToLower(id)] {
+				problems = append(problems, fmt.Sprintf("field %s is not on the create screen of %s in %s", id, name, projectKey))
+			}
+		}
+
+		for _, field := range screen {
+			id := strings.ToLower(field.FieldID)
+			if field.Required && !field.HasDefaultValue && !alwaysSetFields[id] && !set[id] {
+				problems = append(problems, fmt.Sprintf("%s in %s requires field %s (%s), which is not set", name, projectKey, field.Name, field.FieldID))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// projectIssueType returns the project's issue type with the given name.
+func projectIssueType(project *jira.Project, name string) *jira.IssueType {
+
+	for i := range project.IssueTypes {
+		if strings.EqualFold(project.IssueTypes[i].Name, name) {
+			return &project.IssueTypes[i]
+		}
+	}
+
+	return nil
+}
+
+// createMetaFields returns the fields on the create screen of an issue type.
+func createMetaFields(jiraClient *jira.Client, projectKey string, issueTypeID string) ([]createMetaField, error) {
+
+	endpoint := fmt.Sprintf("rest/api/2/issue/createmeta/%s/issuetypes/%s?maxResults=1000",
+		url.PathEscape(projectKey), url.PathEscape(issueTypeID))
+
+	req, err := jiraClient.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Fields []createMetaField `json:"fields"`
+		Values []createMetaField `json:"values"`
+	}
+	resp, err := jiraClient.Do(req, &result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get create screen of %s: %w", projectKey, jira.NewJiraError(resp, err))
+	}
+
+	return append(result.Fields, result.Values...), nil
+}
+
+// sortedKeys returns the keys of a set in order.
+func sortedKeys(set map[string]bool) []string {
+
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBarWidth is the number of characters of the bar itself.
+const progressBarWidth = 30
+
+// progress reports how far a run has got. On a terminal it draws a progress
+// bar below the log lines; otherwise it logs a progress line every
+// progress.interval.
+type progress struct {
+	mu        sync.Mutex
+	total     int
+	processed int
+	succeeded int
+	failed    int
+	unmatched int
+	started   time.Time
+
+	bar      bool
+	interval time.Duration
+	logged   time.Time
+}
+
+// newProgress starts reporting the progress of a run over total rows.
+func newProgress(total int, bar bool) *progress {
+
+	now := time.Now()
+	p := &progress{
+		total:    total,
+		started:  now,
+		logged:   now,
+		bar:      bar && isTerminal(os.Stderr),
+		interval: viper.GetDuration("progress.interval"),
+	}
+	if p.bar {
+		stderr.SetStatus(p.line())
+	}
+
+	return p
+}
+
+// Add counts a processed row.
+func (p *progress) Add(result run.Result) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.processed++
+	switch result.Status {
+	case run.StatusFailed:
+		p.failed++
+	case run.StatusUnmatched:
+		p.unmatched++
+	default:
+		p.succeeded++
+	}
+
+	if p.bar {
+		stderr.SetStatus(p.line())
+		return
+	}
+
+	if p.interval > 0 && time.Since(p.logged) >= p.interval {
+		p.logged = time.Now()
+		slog.Info("Progress", "processed", p.processed, "total", p.total, "succeeded", p.succeeded, "failed", p.failed, "unmatched", p.unmatched, "eta", p.eta())
+	}
+}
+
+// Finish removes the progress bar.
+func (p *progress) Finish() {
+
+	if p.bar {
+		stderr.SetStatus("")
+	}
+}
+
+// line renders the progress bar, e.g.
+// [#########---------------------] 12/40 30% ok 10 failed 1 unmatched 1 ETA 2m10s
+func (p *progress) line() string {
+
+	filled := progressBarWidth
+	percent := 100
+	if p.total > 0 {
+		filled = p.processed * progressBarWidth / p.total
+		percent = p.processed * 100 / p.total
+	}
+
+	line := fmt.Sprintf("[%s%s] %d/%d %d%% ok %d failed %d", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		p.processed, p.total, percent, p.succeeded, p.failed)
+	if p.unmatched > 0 {
+		line += fmt.Sprintf(" unmatched %d", p.unmatched)
+	}
+
+	return line + " ETA " + p.eta()
+}
+
+// eta estimates the time left from the average time per row so far.
+func (p *progress) eta() string {
+
+	if p.processed == 0 {
+		return "unknown"
+	}
+
+	left := time.Since(p.started) / time.Duration(p.processed) * time.Duration(p.total-p.processed)
+
+	return left.Round(time.Second).String()
+}
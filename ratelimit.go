@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out calls to an API shared by several workers. A nil
+// rateLimiter does not limit.
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+// newRateLimiter returns a limiter allowing perSecond calls per second, or
+// nil when perSecond is not positive.
+func newRateLimiter(perSecond float64) *rateLimiter {
+
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &rateLimiter{
+		ticker: time.NewTicker(time.Duration(float64(time.Second) / perSecond)),
+	}
+}
+
+// Wait blocks until the next call is allowed.
+func (l *rateLimiter) Wait() {
+
+	if l == nil {
+		return
+	}
+
+	<-l.ticker.C
+}
+
+func (l *rateLimiter) Stop() {
+
+	if l == nil {
+		return
+	}
+
+	l.ticker.Stop()
+}
+
+// channelPacer keeps posts to the same channel at least interval apart.
+// Workers posting to a busy channel queue up behind each other while posts
+// to other channels go ahead. A nil channelPacer does not limit.
+type channelPacer struct {
+	interval time.Duration
+	mu       sync.Mutex
+	channels map[string]*channelSlot
+}
+
+type channelSlot struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// newChannelPacer returns a pacer for the given interval, or nil when the
+// interval is not positive.
+func newChannelPacer(interval time.Duration) *channelPacer {
+
+	if interval <= 0 {
+		return nil
+	}
+
+	return &channelPacer{
+		interval: interval,
+		channels: make(map[string]*channelSlot),
+	}
+}
+
+// Do waits for the channel's turn and then calls post.
+func (p *channelPacer) Do(channel string, post func() error) error {
+
+	if p == nil {
+		return post()
+	}
+
+	p.mu.Lock()
+	slot, ok := p.channels[channel]
+	if !ok {
+		slot = &channelSlot{}
+		p.channels[channel] = slot
+	}
+	p.mu.Unlock()
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	if wait := time.Until(slot.last.Add(p.interval)); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	err := post()
+	slot.last = time.Now()
+
+	return err
+}
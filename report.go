@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/spf13/cobra"
+	"imp/pkg/run"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reportRow is one line of the report written by create --report-out.
+type reportRow struct {
+	Repository   string `json:"repository"`
+	Service      string `json:"serviceId"`
+	JiraKey      string `json:"jiraKey"`
+	JiraUrl      string `json:"jiraUrl"`
+	SlackChannel string `json:"slackChannel"`
+	Status       string `json:"status"`
+	Error        string `json:"error,omitempty"`
+}
+
+var reportFlags struct {
+	repoFile string
+	outFile  string
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report [file|-]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Print the repository to service, team, project and channel mapping as CSV",
+	RunE:  runReport,
+}
+
+func init() {
+
+	flags := reportCmd.Flags()
+	flags.StringVarP(&reportFlags.repoFile, "file", "f", "", "list of repositories, - for stdin")
+	addInputFlags(flags)
+	flags.StringVarP(&reportFlags.outFile, "out", "o", "", "write the report to this file instead of stdout")
+
+	rootCmd.AddCommand(reportCmd)
+}
+
+func runReport(cmd *cobra.Command, args []string) error {
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		return err
+	}
+	repoFile, err := repositoryFileArg(reportFlags.repoFile, args)
+	if err != nil {
+		return err
+	}
+
+	repositoryList, err := readRepositoryFile(repoFile)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if reportFlags.outFile != "" {
+		f, err := os.Create(reportFlags.outFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"repository", "service", "team", "project", "channel"})
+
+	for _, itm := range repositoryList {
+		service, ok := repoLookup.Find(itm.Repository)
+		if !ok {
+			w.Write([]string{itm.Repository, "", "", "", ""})
+			continue
+		}
+		w.Write([]string{itm.Repository, service.ServiceId, service.Team.TeamId, projectKeyFor(service), slackChannelFor(service)})
+	}
+
+	w.Flush()
+
+	return w.Error()
+}
+
+// writeRunReport writes the results of a run as JSON when fileName ends in
+// .json and as CSV otherwise.
+func writeRunReport(results []run.Result, fileName string) error {
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return encodeRunReport(results, f, strings.EqualFold(filepath.Ext(fileName), ".json"))
+}
+
+// encodeRunReport writes the results of a run to out as JSON or CSV.
+func encodeRunReport(results []run.Result, out io.Writer, asJSON bool) error {
+
+	rows := []reportRow{}
+	for _, result := range results {
+		row := reportRow{
+			Repository:   result.Repository,
+			Service:      result.Service,
+			JiraKey:      result.JiraKey,
+			JiraUrl:      issueURL(result.JiraKey),
+			SlackChannel: result.Channel,
+			Status:       result.Status,
+		}
+		if result.Err != nil {
+			row.Error = result.Err.Error()
+		}
+		rows = append(rows, row)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	w := csv.NewWriter(out)
+	w.Write([]string{"repository", "serviceId", "jiraKey", "jiraUrl", "slackChannel", "status", "error"})
+	for _, row := range rows {
+		w.Write([]string{row.Repository, row.Service, row.JiraKey, row.JiraUrl, row.SlackChannel, row.Status, row.Error})
+	}
+	w.Flush()
+
+	return w.Error()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryTransport retries requests that fail with a transport error or a 5xx
+// response, backing off exponentially with jitter between attempts. Throttled
+// requests (429) wait for as long as the server's Retry-After asks and are
+// counted separately, so a busy API slows the run down instead of failing
+// rows. Requests that are not idempotent, such as creating an issue or
+// posting a message, are only retried when they never reached the server, so
+// that a failure after the server acted cannot file a duplicate. It is shared
+// by the Jira and Slack clients.
+type retryTransport struct {
+	base           http.RoundTripper
+	maxAttempts    int
+	maxThrottled   int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// newRetryTransport wraps base using the retry.* settings from the config.
+func newRetryTransport(base http.RoundTripper) *retryTransport {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &retryTransport{
+		base:           base,
+		maxAttempts:    viper.GetInt("retry.maxAttempts"),
+		maxThrottled:   viper.GetInt("retry.maxThrottled"),
+		initialBackoff: viper.GetDuration("retry.initialBackoff"),
+		maxBackoff:     viper.GetDuration("retry.maxBackoff"),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	attempt, throttled := 1, 0
+	for {
+		resp, err := t.base.RoundTrip(req)
+
+		isThrottled := err == nil && resp.StatusCode == http.StatusTooManyRequests
+		if isThrottled {
+			if throttled >= t.maxThrottled || (!isIdempotent(req) && resp.Header.Get("Retry-After") == "") {
+				return resp, err
+			}
+		} else if !isRetryable(req, resp, err) || attempt >= t.maxAttempts {
+			return resp, err
+		}
+
+		//The body has been consumed, so it must be rewound before retrying
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, err
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return resp, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		var delay time.Duration
+		if isThrottled {
+			throttled++
+			delay = retryAfter(resp, t.backoff(throttled))
+			slog.Warn("Request throttled, waiting", "method", req.Method, "host", req.URL.Host, "delay", delay, "throttled", throttled)
+		} else {
+			delay = t.backoff(attempt)
+			attempt++
+			slog.Warn("Retrying request", "method", req.Method, "host", req.URL.Host, "delay", delay, "reason", reason, "attempt", attempt, "maxAttempts", t.maxAttempts)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: the initial backoff
+// doubled for every attempt so far, capped at the max backoff, with jitter
+// so that parallel workers do not retry in lockstep.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+
+	delay := t.initialBackoff << (attempt - 1)
+	if delay <= 0 || delay > t.maxBackoff {
+		delay = t.maxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryAfter returns the delay asked for by a response's Retry-After header,
+// given either in seconds or as an HTTP date, or fallback when there is none.
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return fallback
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(at); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+
+	return fallback
+}
+
+// isRetryable reports whether a failed attempt may be sent again. Idempotent
+// requests are retried on any transport error or 5xx; others only when the
+// connection was never made, since a 5xx or a dropped response may come after
+// the server has already acted on them.
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+
+	if !isIdempotent(req) {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode >= 500
+}
+
+// isIdempotent reports whether sending req twice has the same effect as
+// sending it once.
+func isIdempotent(req *http.Request) bool {
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// validateRetryConfig checks the retry.* settings.
+func validateRetryConfig() error {
+
+	if viper.GetInt("retry.maxAttempts") < 1 {
+		return fmt.Errorf("retry.maxAttempts must be at least 1")
+	}
+
+	if viper.GetInt("retry.maxThrottled") < 0 {
+		return fmt.Errorf("retry.maxThrottled must not be negative")
+	}
+
+	if viper.GetDuration("retry.initialBackoff") <= 0 || viper.GetDuration("retry.maxBackoff") <= 0 {
+		return fmt.Errorf("retry.initialBackoff and retry.maxBackoff must be positive durations")
+	}
+
+	return nil
+}
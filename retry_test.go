@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	read := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name   string
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{"get 502", http.MethodGet, http.StatusBadGateway, nil, true},
+		{"get reset", http.MethodGet, 0, read, true},
+		{"get 404", http.MethodGet, http.StatusNotFound, nil, false},
+		{"put 503", http.MethodPut, http.StatusServiceUnavailable, nil, true},
+		{"post 502", http.MethodPost, http.StatusBadGateway, nil, false},
+		{"post reset", http.MethodPost, 0, read, false},
+		{"post dial", http.MethodPost, 0, dial, true},
+		{"patch dial", http.MethodPatch, 0, dial, true},
+		{"patch 500", http.MethodPatch, http.StatusInternalServerError, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req, _ := http.NewRequest(test.method, "https://example.com/", nil)
+			var resp *http.Response
+			if test.err == nil {
+				resp = &http.Response{StatusCode: test.status}
+			}
+			if got := isRetryable(req, resp, test.err); got != test.want {
+				t.Errorf("isRetryable(%s, %d, %v) = %v, want %v", test.method, test.status, test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// catalogFile is shared by every command that needs the service catalog.
+var catalogFile string
+
+// refreshCatalog bypasses the catalog cache.
+var refreshCatalog bool
+
+// ledgerPath overrides ledger.path for commands that use the run ledger.
+var ledgerPath string
+
+// configFile is an explicit config file path given with --config.
+var configFile string
+
+// metricsAddr is the address /metrics is served on, if any.
+var metricsAddr string
+
+// logLevel and logFormat configure the structured logger.
+var (
+	logLevel  string
+	logFormat string
+)
+
+// profileName selects a profiles.<name> section of the config.
+var profileName string
+
+// campaignName selects a campaigns.<name> section of the config.
+var campaignName string
+
+// rawConfig is the config file as written, with the case of its keys, which
+// viper folds to lower case.
+var rawConfig map[string]interface{}
+
+// configOverrides holds --set key=value pairs applied on top of the config.
+var configOverrides []string
+
+// configFlags binds flags to the config keys they override.
+var configFlags = map[string]string{
+	"jira-url":      "jira.baseurl",
+	"jira-user":     "jira.user",
+	"jira-token":    "jira.token",
+	"jira-project":  "jira.projectKey",
+	"slack-token":   "slack.token",
+	"slack-channel": "slack.defaultChannel",
+}
+
+var rootCmd = &cobra.Command{
+	Use:          "imp",
+	Short:        "Create migration tickets and notify the owning teams",
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := setupLogging(logLevel, logFormat); err != nil {
+			return configError(err)
+		}
+		if metricsAddr != "" {
+			serveMetrics(metricsAddr)
+		}
+		if err := initConfig(); err != nil {
+			return configError(err)
+		}
+		return configError(openAuditLog(cmd.CommandPath()))
+	},
+}
+
+func init() {
+
+	//Unknown or malformed flags are configuration errors too
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return configError(err)
+	})
+
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file (default config.yaml in ., $HOME/.imp or /etc/imp)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "config profile to use, e.g. staging, defaults to the profile key or IMP_PROFILE")
+	rootCmd.PersistentFlags().StringVar(&campaignName, "campaign", "", "campaign to run, e.g. jdk21, defaults to the campaign key or IMP_CAMPAIGN")
+
+	//Offline fallback: read the service catalog from a local file instead of the catalog api
+	rootCmd.PersistentFlags().StringVar(&catalogFile, "catalog-file", "", "read services from a local json file instead of the catalog api")
+
+	rootCmd.PersistentFlags().BoolVar(&refreshCatalog, "refresh-catalog", false, "fetch the catalog again even if the cached copy is fresh")
+
+	//Local record of created tickets, defaults to ledger.path
+	rootCmd.PersistentFlags().StringVar(&ledgerPath, "ledger", "", "path of the run ledger database")
+
+	//Overrides for config.yaml, also settable as IMP_* environment variables
+	for name, key := range configFlags {
+		rootCmd.PersistentFlags().String(name, "", "overrides "+key)
+		viper.BindPFlag(key, rootCmd.PersistentFlags().Lookup(name))
+	}
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format: text or json")
+
+	//Prometheus metrics for long runs and server mode
+	rootCmd.PersistentFlags().StringVar(&metricsAddr, "metrics-addr", "", "serve prometheus metrics on this address, e.g. :9090")
+
+	rootCmd.PersistentFlags().StringArrayVar(&configOverrides, "set", nil, "override any config key, e.g. --set jira.assignee=lead (repeatable)")
+}
+
+func initConfig() error {
+
+	// ----- Config ----!>
+	if configFile != "" {
+		viper.SetConfigFile(configFile) // explicit path, must exist
+	} else {
+		viper.SetConfigName("config")     // name of config file (without extension)
+		viper.SetConfigType("yaml")       // REQUIRED if the config file does not have the extension in the name
+		viper.AddConfigPath(".")          // look for config in the working directory
+		viper.AddConfigPath("$HOME/.imp") // then in the user's home directory
+		viper.AddConfigPath("/etc/imp")   // and finally system wide
+	}
+	err := viper.ReadInConfig() // Find and read the config file
+	if err != nil {             // Handle errors reading the config file
+		//The file is optional when everything comes from the environment
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return fmt.Errorf("fatal error config file: %w", err)
+		}
+	}
+	rawConfig = readRawConfig(viper.ConfigFileUsed())
+
+	//IMP_JIRA_TOKEN overrides jira.token, IMP_JIRA_PROJECTKEY jira.projectKey, etc.
+	viper.SetEnvPrefix("imp")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	if err := applyProfile(firstNonEmpty(profileName, viper.GetString("profile"))); err != nil {
+		return err
+	}
+	campaignName = firstNonEmpty(campaignName, viper.GetString("campaign"))
+	if err := applyCampaign(campaignName); err != nil {
+		return err
+	}
+
+	for _, override := range configOverrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid --set %q, expected key=value", override)
+		}
+		viper.Set(key, value)
+	}
+
+	//Timeouts, connection pools, proxies and TLS of every HTTP client are
+	//needed before anything is fetched
+	viper.SetDefault("http.timeout", "2m")
+	viper.SetDefault("http.connectTimeout", "10s")
+	viper.SetDefault("http.keepAlive", "30s")
+	viper.SetDefault("http.tlsHandshakeTimeout", "10s")
+	viper.SetDefault("http.responseHeaderTimeout", "1m")
+	viper.SetDefault("http.idleConnTimeout", "90s")
+	viper.SetDefault("http.maxIdleConns", 100)
+	viper.SetDefault("http.maxIdleConnsPerHost", 10)
+	viper.SetDefault("http.maxConnsPerHost", 0)
+
+	if err := validateHTTPConfig(); err != nil {
+		return err
+	}
+
+	//Tokens may be references to secrets kept outside the config
+	if err := resolveSecrets(); err != nil {
+		return err
+	}
+
+	//Requests per second allowed against each API when running in parallel
+	viper.SetDefault("jira.requestsPerSecond", 5)
+	viper.SetDefault("slack.requestsPerSecond", 1)
+	viper.SetDefault("slack.channelInterval", "1s")
+	viper.SetDefault("slack.autoJoin", true)
+	viper.SetDefault("slack.snoozeDuration", "72h")
+	viper.SetDefault("slack.deliverUntil", "18:00")
+	viper.SetDefault("slack.skipWeekends", true)
+	viper.SetDefault("github.requestsPerSecond", 1)
+	viper.SetDefault("gitlab.requestsPerSecond", 1)
+
+	viper.SetDefault("ledger.path", "imp.db")
+
+	//Link every new ticket to its repository
+	viper.SetDefault("jira.remoteLink", true)
+	viper.SetDefault("jira.apiVersion", 2)
+	viper.SetDefault("jira.preflight", true)
+
+	viper.SetDefault("bigbrother.pageSize", 100)
+	viper.SetDefault("backstage.pageSize", 500)
+	viper.SetDefault("backstage.slackChannelAnnotation", "slack.com/channel-id")
+	viper.SetDefault("opslevel.url", "https://app.opslevel.com/graphql")
+
+	//How long a catalog fetched from the api is reused
+	viper.SetDefault("catalog.cacheTTL", "1h")
+
+	//Retries for transient Jira and Slack errors
+	viper.SetDefault("retry.maxAttempts", 3)
+	viper.SetDefault("retry.maxThrottled", 10)
+	viper.SetDefault("retry.initialBackoff", "1s")
+	viper.SetDefault("retry.maxBackoff", "30s")
+	viper.SetDefault("retry.notifyDelay", "10s")
+
+	//Progress bar on a terminal, progress log lines otherwise
+	viper.SetDefault("progress.bar", true)
+	viper.SetDefault("progress.interval", "30s")
+
+	//How long imp create waits for approval.channel, and how often it looks
+	viper.SetDefault("approval.timeout", "24h")
+	viper.SetDefault("approval.pollInterval", "10s")
+
+	//Runs imp serve queues, and the rows of each processed in parallel
+	viper.SetDefault("serve.queueSize", 20)
+	viper.SetDefault("serve.concurrency", 1)
+
+	//How far a signed webhook's timestamp may be from the server's clock
+	viper.SetDefault("serve.webhookTolerance", "5m")
+
+	if err := validateRetryConfig(); err != nil {
+		return err
+	}
+
+	if err := validateDescriptionFormat(); err != nil {
+		return err
+	}
+
+	if err := validateJiraAPIVersion(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// applyProfile merges the profiles.<name> section over the rest of the
+// config file, so one file can hold e.g. a Jira sandbox and production.
+// Environment variables, flags and --set still take precedence.
+func applyProfile(name string) error {
+
+	if name == "" {
+		return nil
+	}
+
+	profile := viper.Sub("profiles." + name)
+	if profile == nil {
+		return fmt.Errorf("unknown profile %q, expected one of: %s", name, strings.Join(configSections("profiles"), ", "))
+	}
+
+	if err := viper.MergeConfigMap(profile.AllSettings()); err != nil {
+		return fmt.Errorf("unable to apply profile %s: %w", name, err)
+	}
+	slog.Debug("Using config profile", "profile", name)
+
+	return nil
+}
+
+// applyCampaign merges the campaigns.<name> section over the config and
+// profile, so several migration programs with their own templates, labels,
+// epic, project and Slack wording can run from one install. Unless the
+// campaign sets ledger.path, it gets a ledger of its own next to the shared
+// one, as the same repository is usually part of several campaigns.
+func applyCampaign(name string) error {
+
+	if name == "" {
+		return nil
+	}
+
+	campaign := viper.Sub("campaigns." + name)
+	if campaign == nil {
+		return fmt.Errorf("unknown campaign %q, expected one of: %s", name, strings.Join(configSections("campaigns"), ", "))
+	}
+
+	settings := campaign.AllSettings()
+	if !campaign.IsSet("ledger.path") {
+		ledger, _ := settings["ledger"].(map[string]any)
+		if ledger == nil {
+			ledger = make(map[string]any)
+		}
+		ledger["path"] = campaignFile(firstNonEmpty(viper.GetString("ledger.path"), "imp.db"), name)
+		settings["ledger"] = ledger
+	}
+
+	if err := viper.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("unable to apply campaign %s: %w", name, err)
+	}
+	slog.Debug("Using campaign", "campaign", name, "ledger", viper.GetString("ledger.path"))
+
+	return nil
+}
+
+// campaignFile names the copy of a per-run file belonging to a campaign,
+// imp-jdk21.db for imp.db.
+func campaignFile(path string, name string) string {
+
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// configSections lists the named sections under a config key, e.g. the
+// profiles or campaigns defined in the config.
+func configSections(key string) []string {
+
+	names := []string{}
+	for name := range viper.GetStringMap(key) {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return []string{"none defined"}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// readRawConfig parses a YAML or JSON config file without folding the case
+// of its keys. Other formats, and files viper couldn't read, give nil.
+func readRawConfig(path string) map[string]interface{} {
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+	default:
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+
+	return raw
+}
+
+// configMap returns a map from the config like viper.GetStringMap, but with
+// its keys, and those of the objects nested in it, in the case they were
+// written in the config file, the selected profile or the campaign. Keys
+// that only come from --set or the environment stay lower case.
+func configMap(key string) map[string]interface{} {
+
+	value := viper.GetStringMap(key)
+
+	sources := []interface{}{}
+	for _, prefix := range []string{"", "profiles." + firstNonEmpty(profileName, viper.GetString("profile")) + ".", "campaigns." + campaignName + "."} {
+		if section := rawSection(rawConfig, prefix+key); section != nil {
+			sources = append(sources, section)
+		}
+	}
+
+	restored, _ := restoreKeyCase(value, sources).(map[string]interface{})
+	return restored
+}
+
+// rawSection looks up a dotted key in a raw config, ignoring case like viper.
+func rawSection(raw map[string]interface{}, key string) interface{} {
+
+	var value interface{} = raw
+	for _, part := range strings.Split(key, ".") {
+		section, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = nil
+		for name, itm := range section {
+			if strings.EqualFold(name, part) {
+				value = itm
+				break
+			}
+		}
+	}
+
+	return value
+}
+
+// restoreKeyCase returns value with the keys of its maps spelled as in the
+// first of sources that has them.
+func restoreKeyCase(value interface{}, sources []interface{}) interface{} {
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		restored := make(map[string]interface{}, len(v))
+		for key, itm := range v {
+			name, nested := key, []interface{}{}
+			for _, source := range sources {
+				section, _ := source.(map[string]interface{})
+				for original, sub := range section {
+					if strings.EqualFold(original, key) {
+						if name == key {
+							name = original
+						}
+						nested = append(nested, sub)
+					}
+				}
+			}
+			restored[name] = restoreKeyCase(itm, nested)
+		}
+		return restored
+
+	case []interface{}:
+		restored := make([]interface{}, len(v))
+		for i, itm := range v {
+			nested := []interface{}{}
+			for _, source := range sources {
+				if list, ok := source.([]interface{}); ok && i < len(list) {
+					nested = append(nested, list[i])
+				}
+			}
+			restored[i] = restoreKeyCase(itm, nested)
+		}
+		return restored
+	}
+
+	return value
+}
+
+// openRunLedger opens the ledger selected by --ledger or ledger.path.
+func openRunLedger() (*ledger, error) {
+	return openLedger(firstNonEmpty(ledgerPath, viper.GetString("ledger.path")))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"time"
+)
+
+var scheduleFlags struct {
+	createOptions
+	cron    string
+	filters []string
+	now     bool
+}
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Args:  cobra.NoArgs,
+	Short: "Periodically create the tickets missing for catalog services matching a filter",
+	Long: `Periodically fetch the catalog again, find the repositories of the services
+matching --filter that have no ticket in the run ledger yet, and create their
+tickets and notifications as imp create does. Services added to the catalog
+after the campaign started are picked up by the next run.`,
+	RunE: runSchedule,
+}
+
+func init() {
+
+	flags := scheduleCmd.Flags()
+
+	//When to run, in cron syntax
+	flags.StringVar(&scheduleFlags.cron, "cron", "", "cron expression of when to run, e.g. \"0 9 * * MON\", defaults to schedule.cron")
+
+	//Services the campaign covers
+	flags.StringArrayVar(&scheduleFlags.filters, "filter", nil, "key=value selecting services by the team, tier, service, channel or language, repeatable")
+
+	//Run once straight away instead of waiting for the first scheduled time
+	flags.BoolVar(&scheduleFlags.now, "now", false, "also run as soon as the command starts")
+
+	//Same ticket settings as imp create
+	flags.StringVar(&scheduleFlags.summaryTemplate, "summary-temp", "", "jira ticket summary template")
+	flags.StringVar(&scheduleFlags.jiraTemplateFile, "jtemp", "", "jira ticket description template")
+	flags.StringVar(&scheduleFlags.slackTemplateFile, "stemp", "", "slack message template, defaults to slack.messageTemplate or a built-in message")
+	flags.StringVar(&scheduleFlags.blocksTemplate, "blocks-temp", "", "slack block kit layout template")
+	flags.BoolVar(&scheduleFlags.dryRun, "dry-run", false, "print the jira tickets and slack messages without creating them")
+	flags.IntVarP(&scheduleFlags.concurrency, "concurrency", "c", 1, "number of repositories to process in parallel")
+	flags.StringSliceVar(&scheduleFlags.labels, "labels", nil, "comma separated labels added to every ticket")
+	flags.StringVar(&scheduleFlags.epic, "epic", "", "key of an existing epic to link every ticket to, defaults to jira.epic")
+	flags.StringVar(&scheduleFlags.sprint, "sprint", "", "add every ticket to this sprint id, or to the active sprint of its project's board with active")
+	flags.StringVar(&scheduleFlags.fixVersion, "fix-version", "", "fix version set on every ticket and created when missing, defaults to jira.fixVersion")
+	flags.BoolVar(&scheduleFlags.subtasks, "subtasks", false, "create one parent ticket per service and a subtask per repository, defaults to jira.subtasks")
+
+	rootCmd.AddCommand(scheduleCmd)
+}
+
+func runSchedule(cmd *cobra.Command, args []string) error {
+
+	expr := firstNonEmpty(scheduleFlags.cron, viper.GetString("schedule.cron"))
+	if expr == "" {
+		return configError(errors.New("no schedule: use --cron or set schedule.cron"))
+	}
+
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return configError(err)
+	}
+
+	filter, err := parseServiceFilter(append(viper.GetStringSlice("schedule.filters"), scheduleFlags.filters...))
+	if err != nil {
+		return configError(err)
+	}
+
+	//Ctrl-C stops waiting, or finishes the rows in flight of a run
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	if scheduleFlags.now {
+		reconcileScheduled(ctx, filter)
+	}
+
+	for ctx.Err() == nil {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return configError(fmt.Errorf("cron expression %q never matches", expr))
+		}
+		slog.Info("Waiting for the next run", "at", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			reconcileScheduled(ctx, filter)
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	slog.Info("Stopped scheduling")
+
+	return nil
+}
+
+// reconcileScheduled runs reconcile and logs its failure, so a scheduled run
+// that fails, e.g. because the catalog is unavailable, is retried at the next
+// scheduled time.
+func reconcileScheduled(ctx context.Context, filter serviceFilter) {
+
+	if err := reconcile(ctx, scheduleFlags.createOptions, filter); err != nil {
+		slog.Error("Scheduled run failed", "error", err)
+	}
+}
+
+// reconcile creates the tickets missing for the repositories of the services
+// selected by the filter.
+func reconcile(ctx context.Context, opts createOptions, filter serviceFilter) error {
+
+	//Always look at the current catalog, then let the run use the copy just
+	//fetched rather than fetching it again
+	refreshCatalog = true
+	services, err := fetchServices(catalogFile)
+	refreshCatalog = false
+	if err != nil {
+		return withExitCode(exitCatalog, err)
+	}
+
+	rows, err := missingTickets(services, filter)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		slog.Info("Every matching repository has a ticket")
+		return nil
+	}
+	slog.Info("Found repositories without a ticket", "count", len(rows))
+
+	opts.catalogRows = true
+	c, err := newCreator(opts, rows)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.prepare(ctx, opts); err != nil {
+		return err
+	}
+
+	results := c.run(ctx, rows)
+
+	printRunSummary(results)
+	c.share(results, "csv")
+
+	if failures := printFailures(results); failures > 0 {
+		return fmt.Errorf("%d of %d repositories failed", failures, len(results))
+	}
+
+	return nil
+}
+
+// missingTickets returns a row for every repository of the services selected
+// by the filter that the ledger has no ticket for.
+func missingTickets(services []catalog.Service, filter serviceFilter) ([]run.Row, error) {
+
+	l, err := openRunLedger()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := l.All()
+	l.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	//Runs may have been given the repositories in another form than the
+	//catalog lists them in
+	ticketed := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.JiraKey != "" {
+			ticketed[catalog.NormalizeRepoURL(entry.Repository)] = true
+		}
+	}
+
+	rows := []run.Row{}
+	for _, service := range services {
+		if !filter.Match(service) {
+			continue
+		}
+		for _, repository := range service.RepositoryUrls {
+			key := catalog.NormalizeRepoURL(repository)
+			if ticketed[key] {
+				continue
+			}
+			//A repository listed by several services gets one ticket
+			ticketed[key] = true
+			rows = append(rows, run.Row{Repository: repository, Columns: []string{}, Fields: map[string]string{}})
+		}
+	}
+
+	return rows, nil
+}
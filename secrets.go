@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"log/slog"
+	"strings"
+)
+
+// secretKeys are the config keys whose values may be references to secrets
+// kept outside the config file.
+var secretKeys = []string{
+	"jira.token",
+	"slack.token",
+	"slack.appToken",
+	"serve.token",
+	"serve.webhookSecret",
+	"github.token",
+	"gitlab.token",
+	"bigbrother.token",
+	"backstage.token",
+	"opslevel.token",
+}
+
+// secretStore reads a secret given the reference that follows its prefix.
+type secretStore interface {
+	Read(reference string) (string, error)
+}
+
+// secretBackends are the places secrets can be read from, by the prefix of
+// the config value that refers to them.
+var secretBackends = []struct {
+	prefix string
+	name   string
+	open   func() (secretStore, error)
+}{
+	{vaultPrefix, "Vault", func() (secretStore, error) { return newVaultClient() }},
+	{secretsManagerPrefix, "AWS Secrets Manager", func() (secretStore, error) { return newAWSClient("secretsmanager") }},
+	{parameterStorePrefix, "AWS SSM Parameter Store", func() (secretStore, error) { return newAWSClient("ssm") }},
+}
+
+// resolveSecrets replaces secret references in secretKeys with the secrets.
+// A backend is only contacted when at least one value refers to it.
+func resolveSecrets() error {
+
+	stores := map[string]secretStore{}
+	for _, key := range secretKeys {
+		value := viper.GetString(key)
+		for _, backend := range secretBackends {
+			if !strings.HasPrefix(value, backend.prefix) {
+				continue
+			}
+
+			store, ok := stores[backend.prefix]
+			if !ok {
+				var err error
+				if store, err = backend.open(); err != nil {
+					return err
+				}
+				stores[backend.prefix] = store
+			}
+
+			secret, err := store.Read(strings.TrimPrefix(value, backend.prefix))
+			if err != nil {
+				return fmt.Errorf("unable to resolve %s: %w", key, err)
+			}
+			viper.Set(key, secret)
+			slog.Debug("Resolved secret", "key", key, "from", backend.name)
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a run submitted to imp serve.
+const (
+	runQueued      = "queued"
+	runRunning     = "running"
+	runDone        = "done"
+	runFailed      = "failed"
+	runInterrupted = "interrupted"
+)
+
+// maxSubmitBytes caps the size of a submitted repository list.
+const maxSubmitBytes = 10 << 20
+
+var serveFlags struct {
+	addr string
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Args:  cobra.NoArgs,
+	Short: "Serve an HTTP API to submit runs and fetch their status and reports",
+	RunE:  runServe,
+}
+
+func init() {
+
+	serveCmd.Flags().StringVar(&serveFlags.addr, "addr", "", "address to listen on, defaults to serve.addr or :8080")
+
+	rootCmd.AddCommand(serveCmd)
+}
+
+// serverRun is a run submitted over the API. The run ID is also the run's ID
+// in the ledger, so imp status, undo and close work on it as usual.
+type serverRun struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"`
+	DryRun      bool           `json:"dryRun"`
+	Rows        int            `json:"rows"`
+	SubmittedAt time.Time      `json:"submittedAt"`
+	StartedAt   *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time     `json:"finishedAt,omitempty"`
+	Counts      map[string]int `json:"counts,omitempty"`
+	Error       string         `json:"error,omitempty"`
+
+	rows    []run.Row
+	opts    createOptions
+	results []run.Result
+}
+
+// runRequest is the JSON body of POST /runs.
+type runRequest struct {
+	Repositories []string `json:"repositories"`
+	DryRun       bool     `json:"dryRun"`
+	Labels       []string `json:"labels"`
+	Epic         string   `json:"epic"`
+	CreateEpic   string   `json:"createEpic"`
+	Mode         string   `json:"mode"`
+	Sprint       string   `json:"sprint"`
+	FixVersion   string   `json:"fixVersion"`
+	Subtasks     bool     `json:"subtasks"`
+	Filter       []string `json:"filter"`
+}
+
+// server queues submitted runs and processes them one at a time, since runs
+// share the ledger and the rate limits of the APIs they call.
+type server struct {
+	token string
+	queue chan *serverRun
+
+	mu    sync.Mutex
+	runs  map[string]*serverRun
+	order []string
+
+	//Webhook signatures seen recently, so a webhook can't be replayed
+	signatures map[string]time.Time
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+
+	addr := firstNonEmpty(serveFlags.addr, viper.GetString("serve.addr"), ":8080")
+
+	s := &server{
+		token:      viper.GetString("serve.token"),
+		queue:      make(chan *serverRun, viper.GetInt("serve.queueSize")),
+		runs:       make(map[string]*serverRun),
+		signatures: make(map[string]time.Time),
+	}
+	if s.token == "" {
+		if !loopbackAddr(addr) {
+			return configError(fmt.Errorf("serve.token is not set: set it, or listen on a loopback address such as 127.0.0.1:8080 to serve without authentication"))
+		}
+		slog.Warn("serve.token is not set, the API accepts unauthenticated requests from this host", "addr", addr)
+	}
+
+	//Ctrl-C stops taking requests and finishes the rows in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	worker := make(chan struct{})
+	go func() {
+		defer close(worker)
+		for {
+			select {
+			case r := <-s.queue:
+				s.execute(ctx, r)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	srv := &http.Server{Addr: addr, Handler: s.routes(), ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Serving the imp API", "addr", addr)
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	srv.Close()
+	<-worker
+	s.interruptQueued()
+	slog.Info("Stopped serving")
+
+	return nil
+}
+
+// routes returns the API's handler.
+func (s *server) routes() http.Handler {
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handleSubmit)
+	mux.HandleFunc("GET /runs", s.handleList)
+	mux.HandleFunc("GET /runs/{id}", s.handleGet)
+	mux.HandleFunc("GET /runs/{id}/report", s.handleReport)
+	mux.HandleFunc("POST /webhooks/runs", s.handleWebhook)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	return s.authenticate(mux)
+}
+
+// authenticate requires the serve.token bearer token, when one is set, on
+// everything but the health check and webhooks, which are signed instead.
+func (s *server) authenticate(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.URL.Path != "/healthz" && !strings.HasPrefix(r.URL.Path, "/webhooks/") {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSubmit queues a run for the repositories in the request: a JSON
+// runRequest, a CSV body in the repository file format, or a multipart form
+// with the CSV as its file field. CSV submissions take their options from
+// the query string or form fields.
+func (s *server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBytes)
+
+	rows, opts, err := parseSubmission(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.accept(w, rows, opts)
+}
+
+// accept queues a submitted run and answers with it, or with why it was
+// refused.
+func (s *server) accept(w http.ResponseWriter, rows []run.Row, opts createOptions) {
+
+	if len(rows) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no repositories in the request"))
+		return
+	}
+	if opts.mode != "" && opts.mode != "create" && opts.mode != "upsert" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown mode %q, expected create or upsert", opts.mode))
+		return
+	}
+
+	submitted, err := s.submit(rows, opts)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	slog.Info("Queued run", "run", submitted.ID, "rows", len(rows), "dryRun", opts.dryRun)
+
+	w.Header().Set("Location", "/runs/"+submitted.ID)
+	writeJSON(w, http.StatusAccepted, submitted)
+}
+
+// apply copies the options of the request.
+func (req runRequest) apply(opts *createOptions) {
+
+	opts.dryRun = req.DryRun
+	opts.labels = req.Labels
+	opts.epic = req.Epic
+	opts.createEpic = req.CreateEpic
+	opts.mode = req.Mode
+	opts.sprint = req.Sprint
+	opts.fixVersion = req.FixVersion
+	opts.subtasks = req.Subtasks
+	opts.filters = req.Filter
+}
+
+// parseSubmission reads the rows and options of a submitted run.
+func parseSubmission(r *http.Request) ([]run.Row, createOptions, error) {
+
+	opts := createOptions{concurrency: viper.GetInt("serve.concurrency")}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var req runRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, opts, fmt.Errorf("invalid json body: %w", err)
+		}
+
+		rows := []run.Row{}
+		for _, repository := range req.Repositories {
+			if repository = strings.TrimSpace(repository); repository != "" {
+				rows = append(rows, run.Row{Repository: repository, Columns: []string{}, Fields: map[string]string{}})
+			}
+		}
+
+		req.apply(&opts)
+		return rows, opts, nil
+
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, opts, fmt.Errorf("no file field in the form: %w", err)
+		}
+		defer file.Close()
+
+		rows, err := readRepositories(file)
+		if err != nil {
+			return nil, opts, fmt.Errorf("invalid csv: %w", err)
+		}
+		formOptions(&opts, r.FormValue)
+		return rows, opts, nil
+
+	case "text/csv", "text/plain", "":
+		rows, err := readRepositories(r.Body)
+		if err != nil {
+			return nil, opts, fmt.Errorf("invalid csv: %w", err)
+		}
+		formOptions(&opts, r.URL.Query().Get)
+		return rows, opts, nil
+	}
+
+	return nil, opts, fmt.Errorf("unsupported content type %q, expected application/json, text/csv or multipart/form-data", mediaType)
+}
+
+// formOptions reads the options of a CSV submission, named as in runRequest.
+func formOptions(opts *createOptions, value func(string) string) {
+
+	opts.dryRun, _ = strconv.ParseBool(value("dryRun"))
+	opts.subtasks, _ = strconv.ParseBool(value("subtasks"))
+	if labels := value("labels"); labels != "" {
+		opts.labels = strings.Split(labels, ",")
+	}
+	opts.epic = value("epic")
+	opts.createEpic = value("createEpic")
+	opts.mode = value("mode")
+	opts.sprint = value("sprint")
+	opts.fixVersion = value("fixVersion")
+	if filter := value("filter"); filter != "" {
+		opts.filters = strings.Split(filter, ",")
+	}
+}
+
+// submit queues a run, failing when the queue is full.
+func (s *server) submit(rows []run.Row, opts createOptions) (serverRun, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := newRunID()
+	r := &serverRun{
+		ID:          id,
+		Status:      runQueued,
+		DryRun:      opts.dryRun,
+		Rows:        len(rows),
+		SubmittedAt: time.Now().UTC(),
+		rows:        rows,
+		opts:        opts,
+	}
+
+	select {
+	case s.queue <- r:
+	default:
+		return serverRun{}, fmt.Errorf("%d runs are already queued, try again later", cap(s.queue))
+	}
+
+	s.runs[id] = r
+	s.order = append(s.order, id)
+
+	return *r, nil
+}
+
+// loopbackAddr reports whether a listen address only accepts connections
+// from the local host. An empty host listens on every interface.
+func loopbackAddr(addr string) bool {
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// execute processes a queued run and records its outcome.
+func (s *server) execute(ctx context.Context, r *serverRun) {
+
+	s.update(r, func(r *serverRun) {
+		now := time.Now().UTC()
+		r.Status = runRunning
+		r.StartedAt = &now
+	})
+
+	results, err := s.process(ctx, r)
+
+	s.update(r, func(r *serverRun) {
+		now := time.Now().UTC()
+		r.FinishedAt = &now
+		r.results = results
+		r.Counts = make(map[string]int)
+		for _, result := range results {
+			r.Counts[result.Status]++
+		}
+
+		switch {
+		case err != nil:
+			r.Status = runFailed
+			r.Error = err.Error()
+		case ctx.Err() != nil:
+			r.Status = runInterrupted
+		default:
+			r.Status = runDone
+		}
+	})
+
+	if err != nil {
+		slog.Error("Run failed", "run", r.ID, "error", err)
+		return
+	}
+	slog.Info("Finished run", "run", r.ID, "counts", r.Counts)
+}
+
+// process creates the tickets of a run, as imp create does.
+func (s *server) process(ctx context.Context, r *serverRun) ([]run.Result, error) {
+
+	c, err := newCreator(r.opts, r.rows)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if err := c.prepare(ctx, r.opts); err != nil {
+		return nil, err
+	}
+	c.runID = r.ID
+
+	results := c.run(ctx, c.rows)
+
+	format, _ := runReportFormat("")
+	c.share(results, format)
+
+	return results, nil
+}
+
+// update changes a run under the lock.
+func (s *server) update(r *serverRun, change func(*serverRun)) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(r)
+}
+
+// interruptQueued marks the runs that never started when the server stops.
+func (s *server) interruptQueued() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.runs {
+		if r.Status == runQueued {
+			r.Status = runInterrupted
+		}
+	}
+}
+
+// snapshot returns a copy of a run that is safe to encode.
+func (s *server) snapshot(id string) (serverRun, []run.Result, bool) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.runs[id]
+	if !ok {
+		return serverRun{}, nil, false
+	}
+
+	return *r, r.results, true
+}
+
+func (s *server) handleList(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	runs := make([]serverRun, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		runs = append(runs, *s.runs[s.order[i]])
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *server) handleGet(w http.ResponseWriter, r *http.Request) {
+
+	found, _, ok := s.snapshot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run %s", r.PathValue("id")))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, found)
+}
+
+// handleReport returns the report of a finished run, as json or, with
+// ?format=csv, as csv.
+func (s *server) handleReport(w http.ResponseWriter, r *http.Request) {
+
+	found, results, ok := s.snapshot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run %s", r.PathValue("id")))
+		return
+	}
+	if found.FinishedAt == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s is %s", found.ID, found.Status))
+		return
+	}
+
+	format := firstNonEmpty(r.URL.Query().Get("format"), "json")
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=imp-run-%s.csv", found.ID))
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q, expected json or csv", format))
+		return
+	}
+
+	if err := encodeRunReport(results, w, format == "json"); err != nil {
+		slog.Error("Unable to write run report", "run", found.ID, "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestLoopbackAddr(t *testing.T) {
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{":8080", false},
+		{"0.0.0.0:8080", false},
+		{"10.0.0.5:8080", false},
+		{"[::]:8080", false},
+		{"127.0.0.1:8080", true},
+		{"127.0.0.2:8080", true},
+		{"[::1]:8080", true},
+		{"localhost:8080", true},
+		{"imp.example.com:8080", false},
+		{"8080", false},
+	}
+
+	for _, test := range tests {
+		if got := loopbackAddr(test.addr); got != test.want {
+			t.Errorf("loopbackAddr(%q) = %v, want %v", test.addr, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleWebhook queues a run for the repositories in a webhook payload, e.g.
+// from the migration planning tool. The payload is signed with
+// serve.webhookSecret rather than sent with the API token; the response holds
+// the run ID to poll GET /runs/{id} with.
+func (s *server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+
+	secret := viper.GetString("serve.webhookSecret")
+	if secret == "" {
+		writeError(w, http.StatusNotFound, errors.New("webhooks are not enabled, set serve.webhookSecret"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSubmitBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	header := firstNonEmpty(viper.GetString("serve.webhookSignatureHeader"), "X-Imp-Signature")
+	signature := r.Header.Get(header)
+	if err := checkTimestamp(r.Header.Get(webhookTimestampHeader), time.Now(), viper.GetDuration("serve.webhookTolerance")); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if !validSignature(r.Header.Get(webhookTimestampHeader), body, signature, secret) {
+		writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid %s signature", header))
+		return
+	}
+	if !s.firstDelivery(signature, viper.GetDuration("serve.webhookTolerance")) {
+		writeError(w, http.StatusUnauthorized, errors.New("the webhook was already delivered"))
+		return
+	}
+
+	rows, opts, err := parseWebhook(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.accept(w, rows, opts)
+}
+
+// webhookTimestampHeader carries the Unix time a webhook was signed at.
+const webhookTimestampHeader = "X-Imp-Timestamp"
+
+// checkTimestamp rejects webhooks signed further than tolerance from now, so
+// a captured request can't be replayed later.
+func checkTimestamp(value string, now time.Time, tolerance time.Duration) error {
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid %s header, expected the unix time the request was signed at", webhookTimestampHeader)
+	}
+
+	if skew := now.Sub(time.Unix(seconds, 0)).Abs(); skew > tolerance {
+		return fmt.Errorf("the webhook was signed %s away from the server's time, more than serve.webhookTolerance (%s)", skew.Round(time.Second), tolerance)
+	}
+
+	return nil
+}
+
+// validSignature checks a signature header of the form sha256=<hex>, the
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret.
+// The sha256= prefix may be left out.
+func validSignature(timestamp string, body []byte, signature string, secret string) bool {
+
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.TrimSpace(timestamp) + "."))
+	mac.Write(body)
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// firstDelivery reports whether a signature hasn't been seen in the last
+// tolerance, the window its timestamp is accepted in, and remembers it.
+func (s *server) firstDelivery(signature string, tolerance time.Duration) bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for seen, at := range s.signatures {
+		if now.Sub(at) > 2*tolerance {
+			delete(s.signatures, seen)
+		}
+	}
+
+	key := strings.TrimPrefix(strings.TrimSpace(signature), "sha256=")
+	if _, ok := s.signatures[key]; ok {
+		return false
+	}
+	s.signatures[key] = now
+
+	return true
+}
+
+// parseWebhook reads the repositories of a webhook payload from the list at
+// serve.webhookRepositories, a dot separated path defaulting to
+// repositories. The list holds URLs, or objects with the URL in a url,
+// repository or repositoryUrl field. The run options are read from the top
+// level of the payload, named as in a POST /runs request.
+func parseWebhook(body []byte) ([]run.Row, createOptions, error) {
+
+	opts := createOptions{concurrency: viper.GetInt("serve.concurrency")}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, opts, fmt.Errorf("invalid json payload: %w", err)
+	}
+
+	//The repositories may be objects, so they are left to the path below
+	var req struct {
+		runRequest
+		Repositories json.RawMessage `json:"repositories"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, opts, fmt.Errorf("invalid run options in payload: %w", err)
+	}
+	req.runRequest.apply(&opts)
+
+	path := firstNonEmpty(viper.GetString("serve.webhookRepositories"), "repositories")
+	var value interface{} = payload
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, opts, fmt.Errorf("payload has no %s", path)
+		}
+		value = object[key]
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, opts, fmt.Errorf("payload has no list of repositories at %s", path)
+	}
+
+	rows := []run.Row{}
+	for _, itm := range list {
+		repository := ""
+		switch v := itm.(type) {
+		case string:
+			repository = v
+		case map[string]interface{}:
+			for _, field := range []string{"url", "repository", "repositoryUrl"} {
+				if s, ok := v[field].(string); ok && s != "" {
+					repository = s
+					break
+				}
+			}
+		}
+		if repository = strings.TrimSpace(repository); repository != "" {
+			rows = append(rows, run.Row{Repository: repository, Columns: []string{}, Fields: map[string]string{}})
+		}
+	}
+
+	return rows, opts, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+
+	now := time.Unix(1790000000, 0)
+	body := []byte(`{"repositories": ["https://github.com/org/a"]}`)
+	sign := func(timestamp string, body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(timestamp + "." + body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	unsigned := hmac.New(sha256.New, []byte("secret"))
+	unsigned.Write(body)
+	bodyOnly := "sha256=" + hex.EncodeToString(unsigned.Sum(nil))
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		want      bool
+	}{
+		{"valid", "1790000000", sign("1790000000", string(body)), true},
+		{"within the tolerance", "1789999800", sign("1789999800", string(body)), true},
+		{"too old", "1789999000", sign("1789999000", string(body)), false},
+		{"in the future", "1790001000", sign("1790001000", string(body)), false},
+		{"timestamp changed", "1790000001", sign("1790000000", string(body)), false},
+		{"body changed", "1790000000", sign("1790000000", "{}"), false},
+		{"body only", "1790000000", bodyOnly, false},
+		{"no timestamp", "", sign("", string(body)), false},
+		{"no signature", "1790000000", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := checkTimestamp(test.timestamp, now, 5*time.Minute) == nil && validSignature(test.timestamp, body, test.signature, "secret")
+			if got != test.want {
+				t.Errorf("signed webhook accepted = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+
+	s := &server{signatures: make(map[string]time.Time)}
+	if !s.firstDelivery("sha256=abc", time.Minute) {
+		t.Error("firstDelivery() = false for a new signature")
+	}
+	if s.firstDelivery("abc", time.Minute) {
+		t.Error("firstDelivery() = true for a signature already seen")
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+
+	rows, opts, err := parseWebhook([]byte(`{"dryRun": true, "labels": ["wave-3"], "repositories": [{"url": "https://github.com/org/a"}, "https://github.com/org/b"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Repository != "https://github.com/org/a" || rows[1].Repository != "https://github.com/org/b" {
+		t.Errorf("parseWebhook() rows = %v, want a and b", rows)
+	}
+	if !opts.dryRun {
+		t.Error("parseWebhook() ignored dryRun")
+	}
+
+	if _, _, err := parseWebhook([]byte(`{"dryRun": "yes", "repositories": ["https://github.com/org/a"]}`)); err == nil {
+		t.Error("parseWebhook() accepted a string dryRun")
+	}
+}
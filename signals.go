@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// abortCtx is cancelled on a second interrupt. Every API request is bound to
+// it by httpTransport, so requests in flight fail straight away instead of
+// being waited for.
+var abortCtx, abortRequests = context.WithCancel(context.Background())
+
+// interruptible returns a context cancelled by the first Ctrl-C or SIGTERM.
+// Commands check it between rows, so the rows in flight finish and are
+// recorded before the command stops and prints what it got through. A second
+// signal aborts the requests in flight and a third exits immediately. stop
+// restores the default signal handling.
+func interruptible(parent context.Context) (context.Context, func()) {
+
+	ctx, cancel := context.WithCancel(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		received := 0
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+
+			received++
+			switch received {
+			case 1:
+				slog.Warn("Interrupted, finishing the rows in progress. Interrupt again to abort them")
+				cancel()
+			case 2:
+				slog.Warn("Aborting the requests in progress")
+				abortRequests()
+			default:
+				os.Exit(exitInterrupted)
+			}
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+
+	return ctx, stop
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/notify"
+	"net/http"
+	"time"
+)
+
+// slackWebhookMode reports whether Slack notifications go through incoming
+// webhooks, for workspaces that hand out webhooks but won't approve a bot.
+// It is used when no slack.token is set and webhooks are configured.
+func slackWebhookMode() bool {
+
+	if viper.GetString("slack.token") != "" {
+		return false
+	}
+
+	return viper.GetString("slack.webhookUrl") != "" || len(viper.GetStringMapString("slack.webhooks")) > 0
+}
+
+// slackWebhookNotifier posts notifications to Slack incoming webhooks. Each
+// webhook is bound to one channel when it is created, so the channel is
+// picked by choosing the webhook.
+type slackWebhookNotifier struct {
+	client *http.Client
+	limit  *rateLimiter
+}
+
+func newSlackWebhookNotifier(limit *rateLimiter) *slackWebhookNotifier {
+	return &slackWebhookNotifier{
+		client: &http.Client{Transport: newRetryTransport(newMetricsTransport("slack", nil))},
+		limit:  limit,
+	}
+}
+
+// slackWebhookFor returns the webhook for a notification: the slack.webhooks
+// entry for its channel ID or name, or slack.webhookUrl.
+func slackWebhookFor(n notify.Notification) string {
+
+	webhooks := viper.GetStringMapString("slack.webhooks")
+	for _, channel := range []string{n.Channel, n.Service.SlackGeneralChannel.ChannelName} {
+		if channel == "" {
+			continue
+		}
+		if webhook, ok := webhooks[normalizeChannelName(channel)]; ok && webhook != "" {
+			return webhook
+		}
+	}
+
+	return viper.GetString("slack.webhookUrl")
+}
+
+func (s *slackWebhookNotifier) Notify(n notify.Notification) (string, error) {
+
+	webhook := slackWebhookFor(n)
+	if webhook == "" {
+		return "", fmt.Errorf("no slack webhook for channel %s: set slack.webhooks or slack.webhookUrl", n.Channel)
+	}
+
+	msg := &slack.WebhookMessage{Text: n.Text}
+	if len(n.Blocks) > 0 {
+		msg.Blocks = &slack.Blocks{BlockSet: n.Blocks}
+	}
+
+	s.limit.Wait()
+	if err := slack.PostWebhookCustomHTTP(webhook, s.client, msg); err != nil {
+		slackFailures.Inc()
+		return "", fmt.Errorf("unable to post to slack webhook for channel %s: %w", n.Channel, redactWebhookError(err))
+	}
+
+	//Webhooks do not return the message timestamp
+	return "slack-webhook:" + time.Now().UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"strings"
+)
+
+// slashCommandUsage is the reply to a slash command imp doesn't understand.
+const slashCommandUsage = "Usage: `%s migrate <repository-url>` creates the migration ticket for a repository of your team's service."
+
+// handleCommand answers a slash command. migrate is acknowledged straight
+// away, since Slack only waits three seconds, and the outcome is posted to
+// the command's response URL once the ticket exists. The replies are only
+// shown to the user who typed the command.
+func (l *listener) handleCommand(ctx context.Context, command slack.SlashCommand) map[string]string {
+
+	args := strings.Fields(command.Text)
+	if len(args) != 2 || !strings.EqualFold(args[0], "migrate") {
+		return ephemeral(fmt.Sprintf(slashCommandUsage, command.Command))
+	}
+
+	//Slack sends links as <url> or <url|label>
+	repository := strings.TrimSuffix(strings.TrimPrefix(args[1], "<"), ">")
+	repository, _, _ = strings.Cut(repository, "|")
+
+	l.commands.Add(1)
+	go func() {
+		defer l.commands.Done()
+		reply := l.migrate(ctx, command, repository)
+		msg := &slack.WebhookMessage{ResponseType: slack.ResponseTypeEphemeral, Text: reply}
+		//Reply even when interrupted, the run has finished its row by now
+		if err := slack.PostWebhookCustomHTTPContext(context.Background(), command.ResponseURL, l.replies, msg); err != nil {
+			slog.Warn("Unable to reply to slash command", "user", command.UserID, "error", err)
+		}
+	}()
+
+	return ephemeral(fmt.Sprintf("Creating the migration ticket for %s...", repository))
+}
+
+// migrate checks the user may migrate the repository, creates its ticket and
+// notification as imp create does, and returns the reply to the user.
+func (l *listener) migrate(ctx context.Context, command slack.SlashCommand, repository string) string {
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		slog.Error("Unable to load the catalog for slash command", "error", err)
+		return fmt.Sprintf("Sorry, imp could not load the service catalog: %s", err)
+	}
+
+	service, ok := repoLookup.Find(repository)
+	if !ok {
+		return fmt.Sprintf("No service in the catalog lists %s.", repository)
+	}
+
+	allowed, err := l.mayMigrate(command.UserID, service)
+	if err != nil {
+		slog.Error("Unable to check slash command user", "user", command.UserID, "error", err)
+		return fmt.Sprintf("Sorry, imp could not check who you are: %s", err)
+	}
+	if !allowed {
+		slog.Warn("Refused slash command", "user", command.UserName, "repository", repository, "service", service.ServiceId)
+		return fmt.Sprintf("Only members of team %s can migrate the repositories of %s.", service.Team.TeamId, service.ServiceId)
+	}
+
+	//Runs share the ledger, which only one of them can have open
+	l.commandMu.Lock()
+	defer l.commandMu.Unlock()
+
+	slog.Info("Creating ticket for slash command", "user", command.UserName, "repository", repository, "service", service.ServiceId)
+
+	rows := []run.Row{{Repository: repository, Columns: []string{}, Fields: map[string]string{}}}
+	opts := createOptions{concurrency: 1}
+
+	//Button clicks wait while the ledger is opened, then share it
+	l.ledgerMu.Lock()
+	c, err := newCreator(opts, rows)
+	if err == nil {
+		l.ledger = c.ledger
+	}
+	l.ledgerMu.Unlock()
+	if err != nil {
+		return fmt.Sprintf("Sorry, imp could not start the run: %s", err)
+	}
+	defer c.Close()
+	defer func() {
+		l.ledgerMu.Lock()
+		l.ledger = nil
+		l.ledgerMu.Unlock()
+	}()
+
+	if err := c.prepare(ctx, opts); err != nil {
+		return fmt.Sprintf("Sorry, imp could not start the run: %s", err)
+	}
+
+	result := c.run(ctx, rows)[0]
+	link := result.JiraKey
+	if url := issueURL(result.JiraKey); url != "" {
+		link = fmt.Sprintf("<%s|%s>", url, result.JiraKey)
+	}
+
+	switch result.Status {
+	case run.StatusCreated:
+		return fmt.Sprintf(":white_check_mark: Created %s for %s (%s).", link, repository, service.ServiceId)
+	case run.StatusUpdated:
+		return fmt.Sprintf(":white_check_mark: Updated %s for %s (%s).", link, repository, service.ServiceId)
+	case run.StatusSkipped:
+		return fmt.Sprintf("%s already has a migration ticket: %s.", repository, link)
+	case run.StatusInterrupted:
+		return "imp is shutting down, try again in a moment."
+	}
+
+	return fmt.Sprintf("Sorry, imp could not create the ticket for %s: %s", repository, result.Err)
+}
+
+// mayMigrate reports whether a Slack user may create tickets for a service:
+// the lead and members of the service's team, matched by email, and the users
+// listed by ID or email in slack.commandUsers.
+func (l *listener) mayMigrate(userID string, service catalog.Service) (bool, error) {
+
+	admins := viper.GetStringSlice("slack.commandUsers")
+	for _, admin := range admins {
+		if admin == userID {
+			return true, nil
+		}
+	}
+
+	user, err := l.api.GetUserInfo(userID)
+	if err != nil {
+		return false, err
+	}
+	email := user.Profile.Email
+	if email == "" {
+		return false, nil
+	}
+
+	emails := append([]string{service.Team.Lead.Email}, admins...)
+	for _, member := range service.Team.TeamMembers {
+		emails = append(emails, member.User.Email)
+	}
+	for _, e := range emails {
+		if strings.EqualFold(e, email) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// ephemeral is a slash command response only shown to the user.
+func ephemeral(text string) map[string]string {
+
+	return map[string]string{"response_type": slack.ResponseTypeEphemeral, "text": text}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/viper"
+	"strconv"
+	"strings"
+)
+
+// addToSprint moves a new ticket into the sprint given with --sprint, either
+// a sprint ID or "active" for the active sprint of the project's board.
+func (t *jiraTracker) addToSprint(key string, projectKey string, sprint string) error {
+
+	sprintID, err := t.sprintFor(projectKey, sprint)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.client.Sprint.MoveIssuesToSprint(sprintID, []string{key}); err != nil {
+		return fmt.Errorf("unable to add %s to sprint %d: %w", key, sprintID, err)
+	}
+
+	return nil
+}
+
+// sprintFor resolves the sprint of a project, looking the active sprint up
+// once per project.
+func (t *jiraTracker) sprintFor(projectKey string, sprint string) (int, error) {
+
+	if !strings.EqualFold(sprint, "active") {
+		id, err := strconv.Atoi(sprint)
+		if err != nil {
+			return 0, fmt.Errorf("invalid sprint %q, expected a sprint id or active", sprint)
+		}
+		return id, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id, ok := t.sprints[projectKey]; ok {
+		return id, nil
+	}
+
+	id, err := activeSprint(t.client, projectKey)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.sprints == nil {
+		t.sprints = make(map[string]int)
+	}
+	t.sprints[projectKey] = id
+
+	return id, nil
+}
+
+// activeSprint returns the active sprint on the project's board: the board in
+// jira.boards for the project, or else the first scrum board of the project
+// that has an active sprint.
+func activeSprint(jiraClient *jira.Client, projectKey string) (int, error) {
+
+	boardIDs := []int{}
+	if board := viper.GetInt("jira.boards." + strings.ToLower(projectKey)); board != 0 {
+		boardIDs = append(boardIDs, board)
+	} else {
+		boards, _, err := jiraClient.Board.GetAllBoards(&jira.BoardListOptions{BoardType: "scrum", ProjectKeyOrID: projectKey})
+		if err != nil {
+			return 0, fmt.Errorf("unable to list boards of %s: %w", projectKey, err)
+		}
+		for _, board := range boards.Values {
+			boardIDs = append(boardIDs, board.ID)
+		}
+	}
+
+	for _, boardID := range boardIDs {
+		sprints, _, err := jiraClient.Board.GetAllSprintsWithOptions(boardID, &jira.GetAllSprintsOptions{State: "active"})
+		if err != nil {
+			return 0, fmt.Errorf("unable to list sprints of board %d: %w", boardID, err)
+		}
+		if len(sprints.Values) > 0 {
+			return sprints.Values[0].ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no active sprint found for project %s", projectKey)
+}
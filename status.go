@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/spf13/cobra"
+	"imp/pkg/catalog"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// statusBatchSize is the number of ticket keys looked up per search.
+const statusBatchSize = 50
+
+// jiraKeyPattern matches Jira issue keys, to leave out tickets filed in other
+// trackers.
+var jiraKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-\d+$`)
+
+// descriptionURLPattern finds repository URLs in ticket descriptions.
+var descriptionURLPattern = regexp.MustCompile(`(https?://|git@|ssh://)[^\s|\]\[<>()"]+`)
+
+var statusFlags struct {
+	runID   string
+	jql     string
+	by      string
+	outFile string
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "Report how far the migration tickets have progressed, by team or service",
+	RunE:  runStatus,
+}
+
+// ticketStatus is a migration ticket and the status category it is in.
+type ticketStatus struct {
+	Key        string
+	Repository string
+	Service    string
+	Team       string
+	Category   string
+}
+
+// progressRow counts the tickets of one team or service by status category.
+type progressRow struct {
+	Group      string `json:"group"`
+	Open       int    `json:"open"`
+	InProgress int    `json:"inProgress"`
+	Done       int    `json:"done"`
+	Total      int    `json:"total"`
+}
+
+func init() {
+
+	flags := statusCmd.Flags()
+	flags.StringVar(&statusFlags.runID, "run", "", "only the tickets created by this run, instead of every ticket in the ledger")
+	flags.StringVar(&statusFlags.jql, "jql", "", "the tickets matching this JQL query, instead of those in the ledger")
+	flags.StringVar(&statusFlags.by, "by", "team", "group tickets by team or service")
+	flags.StringVarP(&statusFlags.outFile, "out", "o", "", "write the report to this file, as JSON when it ends in .json and CSV otherwise")
+
+	rootCmd.AddCommand(statusCmd)
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+
+	if trackerKind() != "jira" {
+		return fmt.Errorf("status is only supported by the jira tracker")
+	}
+	if statusFlags.by != "team" && statusFlags.by != "service" {
+		return fmt.Errorf("unknown --by %q, expected team or service", statusFlags.by)
+	}
+	if statusFlags.runID != "" && statusFlags.jql != "" {
+		return fmt.Errorf("--run and --jql cannot be used together")
+	}
+
+	jiraClient, err := newJiraClient()
+	if err != nil {
+		return err
+	}
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		return err
+	}
+
+	var tickets []ticketStatus
+	if statusFlags.jql != "" {
+		tickets, err = jqlTicketStatuses(jiraClient, statusFlags.jql, repoLookup)
+	} else {
+		tickets, err = ledgerTicketStatuses(jiraClient, statusFlags.runID, repoLookup)
+	}
+	if err != nil {
+		return err
+	}
+
+	rows := progressBy(tickets, statusFlags.by)
+
+	if statusFlags.outFile != "" {
+		return writeProgress(rows, statusFlags.outFile)
+	}
+
+	printProgress(rows, statusFlags.by)
+
+	return nil
+}
+
+// ledgerTicketStatuses looks up the tickets recorded in the ledger, for one
+// run or for every repository.
+func ledgerTicketStatuses(jiraClient *jira.Client, runID string, repoLookup catalog.Lookup) ([]ticketStatus, error) {
+
+	l, err := openRunLedger()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	var entries []LedgerEntry
+	if runID != "" {
+		entries, err = l.Run(runID)
+	} else {
+		entries, err = l.All()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]LedgerEntry{}
+	keys := []string{}
+	for _, entry := range entries {
+		if !jiraKeyPattern.MatchString(entry.JiraKey) {
+			continue
+		}
+		if _, ok := byKey[entry.JiraKey]; !ok {
+			keys = append(keys, entry.JiraKey)
+		}
+		byKey[entry.JiraKey] = entry
+	}
+
+	tickets := []ticketStatus{}
+	for start := 0; start < len(keys); start += statusBatchSize {
+		batch := keys[start:min(start+statusBatchSize, len(keys))]
+
+		found, err := searchAllIssues(jiraClient, fmt.Sprintf("key in (%s)", strings.Join(batch, ",")), []string{"status"})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, issue := range found {
+			entry, ok := byKey[issue.Key]
+			if !ok {
+				continue
+			}
+			delete(byKey, issue.Key)
+
+			ticket := ticketStatus{Key: issue.Key, Repository: entry.Repository, Service: entry.Service, Category: statusCategory(issue)}
+			if service, ok := repoLookup.Find(entry.Repository); ok {
+				ticket.Service, ticket.Team = service.ServiceId, service.Team.TeamId
+			}
+			tickets = append(tickets, ticket)
+		}
+	}
+
+	//Tickets that were deleted or moved out of reach
+	for key, entry := range byKey {
+		slog.Warn("Ticket in the ledger not found in Jira", "ticket", key, "repository", entry.Repository)
+	}
+
+	return tickets, nil
+}
+
+// jqlTicketStatuses looks up the tickets matching a JQL query, finding each
+// one's service from the repository URL in its description.
+func jqlTicketStatuses(jiraClient *jira.Client, jql string, repoLookup catalog.Lookup) ([]ticketStatus, error) {
+
+	found, err := searchAllIssues(jiraClient, jql, []string{"status", "description"})
+	if err != nil {
+		return nil, err
+	}
+
+	tickets := []ticketStatus{}
+	for _, issue := range found {
+		ticket := ticketStatus{Key: issue.Key, Category: statusCategory(issue)}
+
+		description := ""
+		if issue.Fields != nil {
+			description = issue.Fields.Description
+		}
+		for _, repo := range descriptionURLPattern.FindAllString(description, -1) {
+			if service, ok := repoLookup.Find(repo); ok {
+				ticket.Repository, ticket.Service, ticket.Team = repo, service.ServiceId, service.Team.TeamId
+				break
+			}
+		}
+		if ticket.Service == "" {
+			slog.Debug("No repository found in ticket description", "ticket", issue.Key)
+		}
+
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, nil
+}
+
+// searchAllIssues returns every issue matching jql, following the pages of
+// results.
+func searchAllIssues(jiraClient *jira.Client, jql string, fields []string) ([]jira.Issue, error) {
+
+	issues := []jira.Issue{}
+	for {
+		page, resp, err := jiraClient.Issue.Search(jql, &jira.SearchOptions{
+			StartAt:    len(issues),
+			MaxResults: 100,
+			Fields:     fields,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to search Jira: %w", err)
+		}
+		issues = append(issues, page...)
+
+		if len(page) == 0 || len(issues) >= resp.Total {
+			return issues, nil
+		}
+	}
+}
+
+// statusCategory sorts a ticket into open, in progress or done by the
+// category of its status, so custom workflows are counted correctly.
+func statusCategory(issue jira.Issue) string {
+
+	if issue.Fields == nil || issue.Fields.Status == nil {
+		return "open"
+	}
+
+	switch issue.Fields.Status.StatusCategory.Key {
+	case jira.StatusCategoryComplete:
+		return "done"
+	case jira.StatusCategoryInProgress:
+		return "in progress"
+	default:
+		return "open"
+	}
+}
+
+// progressBy counts tickets per team or service, sorted by name, with the
+// total across all of them last.
+func progressBy(tickets []ticketStatus, by string) []progressRow {
+
+	groups := map[string]*progressRow{}
+	total := progressRow{Group: "total"}
+
+	for _, ticket := range tickets {
+		name := ticket.Team
+		if by == "service" {
+			name = ticket.Service
+		}
+		name = firstNonEmpty(name, "(unknown)")
+
+		row, ok := groups[name]
+		if !ok {
+			row = &progressRow{Group: name}
+			groups[name] = row
+		}
+
+		for _, r := range []*progressRow{row, &total} {
+			switch ticket.Category {
+			case "done":
+				r.Done++
+			case "in progress":
+				r.InProgress++
+			default:
+				r.Open++
+			}
+			r.Total++
+		}
+	}
+
+	rows := []progressRow{}
+	for _, row := range groups {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Group < rows[j].Group })
+
+	return append(rows, total)
+}
+
+// percentDone returns the share of a row's tickets that are done.
+func (r progressRow) percentDone() string {
+
+	if r.Total == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(r.Done*100/r.Total) + "%"
+}
+
+func printProgress(rows []progressRow, by string) {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tOPEN\tIN PROGRESS\tDONE\tTOTAL\tDONE %%\n", strings.ToUpper(by))
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n", row.Group, row.Open, row.InProgress, row.Done, row.Total, row.percentDone())
+	}
+	w.Flush()
+}
+
+// writeProgress writes the progress report as JSON when fileName ends in
+// .json and as CSV otherwise.
+func writeProgress(rows []progressRow, fileName string) error {
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"group", "open", "inProgress", "done", "total"})
+	for _, row := range rows {
+		w.Write([]string{row.Group, strconv.Itoa(row.Open), strconv.Itoa(row.InProgress), strconv.Itoa(row.Done), strconv.Itoa(row.Total)})
+	}
+	w.Flush()
+
+	return w.Error()
+}
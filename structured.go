@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"imp/pkg/run"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// structuredRepoKeys are the keys holding the repository of an object in a
+// JSON or YAML repository file, unless --repo-column names another.
+var structuredRepoKeys = []string{"repo", "repository", "url"}
+
+// isStructuredFile reports whether a repository file is JSON or YAML, by its
+// extension.
+func isStructuredFile(fileName string) bool {
+
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+
+	return false
+}
+
+// readStructuredRepositories reads a JSON or YAML repository file: a list of
+// objects such as {"repo": "https://github.com/org/a", "priority": "High"},
+// or an object with the list under repositories. Every key but the
+// repository becomes a column of the row, named after the key, for templates
+// and the per-repository Jira fields.
+func readStructuredRepositories(fileName string, data []byte) ([]run.Row, error) {
+
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	var doc interface{}
+	var err error
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		err = d.Decode(&doc)
+	} else {
+		err = yaml.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository file %s: %w", fileName, err)
+	}
+
+	if object, ok := doc.(map[string]interface{}); ok {
+		doc = object["repositories"]
+	}
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid repository file %s: expected a list of repositories", fileName)
+	}
+
+	repoKeys := structuredRepoKeys
+	if inputFlags.repoColumn != "" {
+		repoKeys = []string{inputFlags.repoColumn}
+	}
+
+	rows := []run.Row{}
+	for i, itm := range list {
+		object, ok := itm.(map[string]interface{})
+		if !ok {
+			//A plain list of repositories
+			if repository := structuredValue(itm); repository != "" {
+				rows = append(rows, run.Row{Repository: repository, Columns: []string{}, Fields: map[string]string{}})
+			}
+			continue
+		}
+
+		//Objects have no column order, so columns are in key order
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		//The first of repoKeys the entry has is the repository, whatever the
+		//order of its keys
+		repoKey := ""
+		for _, name := range repoKeys {
+			for _, key := range keys {
+				if repoKey == "" && strings.EqualFold(key, name) {
+					repoKey = key
+				}
+			}
+		}
+		if repoKey == "" {
+			return nil, fmt.Errorf("invalid repository file %s: entry %d has no %s", fileName, i+1, strings.Join(repoKeys, " or "))
+		}
+
+		row := run.Row{Repository: strings.TrimSpace(structuredValue(object[repoKey])), Columns: []string{}, Fields: map[string]string{}}
+		if row.Repository == "" {
+			continue
+		}
+
+		for _, key := range keys {
+			if key == repoKey {
+				continue
+			}
+			value := structuredValue(object[key])
+			row.Columns = append(row.Columns, value)
+			row.Fields[key] = value
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// structuredValue turns a JSON or YAML value into the text of a column.
+// Dates are written as 2006-01-02, lists and objects as JSON.
+func structuredValue(value interface{}) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case []interface{}, map[string]interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	return fmt.Sprint(value)
+}
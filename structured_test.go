@@ -0,0 +1,98 @@
+package main
+
+import (
+	"imp/pkg/run"
+	"reflect"
+	"testing"
+)
+
+func TestReadStructuredRepositories(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		fileName string
+		data     string
+		want     []run.Row
+		err      bool
+	}{
+		{
+			name:     "json objects",
+			fileName: "repos.json",
+			data:     `[{"repo": "https://github.com/org/a", "priority": "High", "points": 3}]`,
+			want: []run.Row{
+				{Repository: "https://github.com/org/a", Columns: []string{"3", "High"}, Fields: map[string]string{"points": "3", "priority": "High"}},
+			},
+		},
+		{
+			name:     "yaml under repositories",
+			fileName: "repos.yaml",
+			data:     "repositories:\n  - repository: https://github.com/org/a\n    deadline: 2026-12-31\n    owners: [ann, bob]\n",
+			want: []run.Row{
+				{Repository: "https://github.com/org/a", Columns: []string{"2026-12-31", `["ann","bob"]`}, Fields: map[string]string{"deadline": "2026-12-31", "owners": `["ann","bob"]`}},
+			},
+		},
+		{
+			name:     "plain list",
+			fileName: "repos.yml",
+			data:     "- https://github.com/org/a\n- \" https://github.com/org/b \"\n",
+			want: []run.Row{
+				{Repository: "https://github.com/org/a", Columns: []string{}, Fields: map[string]string{}},
+				{Repository: "https://github.com/org/b", Columns: []string{}, Fields: map[string]string{}},
+			},
+		},
+		{
+			name:     "repo wins over url, whatever the key order",
+			fileName: "repos.json",
+			data:     `[{"url": "https://example.com/a", "Repo": "https://github.com/org/a"}, {"URL": "https://github.com/org/b"}]`,
+			want: []run.Row{
+				{Repository: "https://github.com/org/a", Columns: []string{"https://example.com/a"}, Fields: map[string]string{"url": "https://example.com/a"}},
+				{Repository: "https://github.com/org/b", Columns: []string{}, Fields: map[string]string{}},
+			},
+		},
+		{
+			name:     "empty repositories are skipped",
+			fileName: "repos.json",
+			data:     "\ufeff" + `[{"repo": " "}, {"repo": null}, {"repo": "https://github.com/org/a"}]`,
+			want: []run.Row{
+				{Repository: "https://github.com/org/a", Columns: []string{}, Fields: map[string]string{}},
+			},
+		},
+		{
+			name:     "entry without a repository",
+			fileName: "repos.json",
+			data:     `[{"name": "a"}]`,
+			err:      true,
+		},
+		{
+			name:     "not a list",
+			fileName: "repos.json",
+			data:     `{"repo": "https://github.com/org/a"}`,
+			err:      true,
+		},
+		{
+			name:     "invalid yaml",
+			fileName: "repos.yaml",
+			data:     "- [",
+			err:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			got, err := readStructuredRepositories(test.fileName, []byte(test.data))
+			if test.err {
+				if err == nil {
+					t.Errorf("readStructuredRepositories() = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("readStructuredRepositories() = %#v, want %#v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/tracker"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Templates used in subtask mode when none are configured.
+const (
+	defaultSubtaskSummaryTemplate    = "Migrate {{.repository}}"
+	defaultParentDescriptionTemplate = "Migration of the {{.service}} repositories, tracked in the subtasks of this ticket."
+)
+
+// parentIssues creates the one parent ticket per service that repositories
+// become subtasks of in subtask mode, shared by all workers.
+type parentIssues struct {
+	summaryTmpl     *template.Template
+	descriptionTmpl *template.Template
+
+	mu        sync.Mutex
+	byService map[string]*parentIssue
+}
+
+type parentIssue struct {
+	once sync.Once
+	key  string
+	err  error
+}
+
+// newParentIssues loads jira.parentSummaryTemplate, defaulting to the usual
+// per-service summary, and jira.parentDescriptionTemplate.
+func newParentIssues() (*parentIssues, error) {
+
+	summaryTmpl, err := loadTemplate("parentSummaryTemplate", viper.GetString("jira.parentSummaryTemplate"), defaultSummaryTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptionTmpl, err := loadTemplate("parentDescriptionTemplate", viper.GetString("jira.parentDescriptionTemplate"), defaultParentDescriptionTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parentIssues{
+		summaryTmpl:     summaryTmpl,
+		descriptionTmpl: descriptionTmpl,
+		byService:       make(map[string]*parentIssue),
+	}, nil
+}
+
+// parentFor returns the key of the service's parent ticket, finding or
+// creating it for the first of the service's repositories.
+func (c *creator) parentFor(service catalog.Service, issue tracker.Issue, data map[string]interface{}) (string, error) {
+
+	c.parents.mu.Lock()
+	parent, ok := c.parents.byService[service.ServiceId]
+	if !ok {
+		parent = &parentIssue{}
+		c.parents.byService[service.ServiceId] = parent
+	}
+	c.parents.mu.Unlock()
+
+	parent.once.Do(func() {
+		parent.key, parent.err = c.createParent(service, issue, data)
+	})
+
+	return parent.key, parent.err
+}
+
+// createParent creates the parent ticket of a service from the first
+// repository's ticket, keeping its project, labels, epic and other fields,
+// unless an earlier run already created it.
+func (c *creator) createParent(service catalog.Service, issue tracker.Issue, data map[string]interface{}) (string, error) {
+
+	summary, err := renderTemplate(c.parents.summaryTmpl, data)
+	if err != nil {
+		return "", err
+	}
+
+	description, err := renderTemplate(c.parents.descriptionTmpl, data)
+	if err != nil {
+		return "", err
+	}
+
+	parent := issue
+	parent.Name = strings.TrimSpace(summary)
+	parent.Description = description
+	parent.Type = firstNonEmpty(viper.GetString("jira.parentType"), "Task")
+	parent.Repository = ""
+
+	if duplicateAction() != "create" {
+		c.trackerLimit.Wait()
+		existing, err := c.tracker.FindExisting(parent, service.ServiceId)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			slog.Info("Reusing parent ticket", "ticket", existing, "service", service.ServiceId)
+			return existing, nil
+		}
+	}
+
+	if c.dryRun {
+		return fmt.Sprintf("(new parent %q)", parent.Name), nil
+	}
+
+	c.trackerLimit.Wait()
+	key, err := c.tracker.CreateIssue(parent)
+	if err != nil {
+		return "", fmt.Errorf("unable to create parent ticket for %s: %w", service.ServiceId, err)
+	}
+	slog.Info("Created parent ticket", "ticket", key, "service", service.ServiceId)
+	ticketsCreated.Inc()
+
+	return key, nil
+}
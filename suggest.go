@@ -0,0 +1,82 @@
+package main
+
+import (
+	"imp/pkg/catalog"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of "did you mean" candidates shown for an
+// unmatched repository.
+const maxSuggestions = 3
+
+// suggestRepositories returns the catalog repositories closest to one that
+// could not be matched: those with the same repository name first, then
+// those within a small edit distance, which catches typos in hand-written
+// files.
+func suggestRepositories(repository string, lookup catalog.Lookup) []string {
+
+	target := catalog.NormalizeRepoURL(repository)
+	name := strings.ToLower(path.Base(target))
+
+	type candidate struct {
+		repo     string
+		sameName bool
+		distance int
+	}
+
+	//Allow roughly one typo per five characters of the owner/repo path
+	_, repoPath, _ := strings.Cut(strings.TrimPrefix(target, "https://"), "/")
+	limit := max(1, len(repoPath)/5)
+
+	candidates := []candidate{}
+	for repo := range lookup {
+		sameName := strings.ToLower(path.Base(repo)) == name
+		distance := levenshtein(strings.ToLower(target), strings.ToLower(repo))
+		if sameName || distance <= limit {
+			candidates = append(candidates, candidate{repo: repo, sameName: sameName, distance: distance})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].sameName != candidates[j].sameName {
+			return candidates[i].sameName
+		}
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].repo < candidates[j].repo
+	})
+
+	suggestions := []string{}
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].repo)
+	}
+
+	return suggestions
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a string, b string) int {
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
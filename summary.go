@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/run"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// summaryStatuses is the order statuses are listed in run summaries.
+var summaryStatuses = []string{run.StatusCreated, run.StatusUpdated, run.StatusSkipped, run.StatusDryRun, run.StatusPlanned, run.StatusUnmatched, run.StatusExcluded, run.StatusFailed, run.StatusInterrupted}
+
+// summaryLinesPerReply caps the number of repositories listed in each thread
+// reply so long runs stay under Slack's message size limit.
+const summaryLinesPerReply = 50
+
+// printRunSummary prints one line per row, in input order, followed by the
+// number of rows in each status.
+func printRunSummary(results []run.Result) {
+
+	counts := make(map[string]int)
+
+	fmt.Println("Run summary:")
+	for _, result := range results {
+		counts[result.Status]++
+		fmt.Printf("  %-10s %-12s %s\n", result.Status, result.JiraKey, result.Repository)
+	}
+
+	for _, status := range summaryStatuses {
+		if counts[status] > 0 {
+			fmt.Printf("%s: %d\n", status, counts[status])
+		}
+	}
+}
+
+// printFailures lists every failed row with its error and returns how many
+// rows failed.
+func printFailures(results []run.Result) int {
+
+	failures := 0
+	for _, result := range results {
+		if result.Err == nil {
+			continue
+		}
+		if failures == 0 {
+			fmt.Println("Failures:")
+		}
+		failures++
+		fmt.Printf("  %s: %s\n", result.Repository, result.Err)
+	}
+
+	return failures
+}
+
+// postRunSummary posts the number of rows in each status to the channel, with
+// the per-repository breakdown as replies in the message's thread.
+func postRunSummary(api *slack.Client, channelId string, runID string, results []run.Result) {
+
+	text := runSummaryText(runID, results)
+
+	_, ts, err := api.PostMessage(channelId, slack.MsgOptionText(text, false))
+	if err != nil {
+		slog.Error("Unable to post run summary", "error", err)
+		return
+	}
+
+	lines := []string{}
+	for _, result := range results {
+		line := fmt.Sprintf("%s `%s`", result.Status, result.Repository)
+		if result.JiraKey != "" {
+			line += " " + result.JiraKey
+		}
+		if result.Err != nil {
+			line += ": " + result.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+
+	for start := 0; start < len(lines); start += summaryLinesPerReply {
+		end := start + summaryLinesPerReply
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		_, _, err := api.PostMessage(channelId,
+			slack.MsgOptionText(strings.Join(lines[start:end], "\n"), false),
+			slack.MsgOptionTS(ts),
+		)
+		if err != nil {
+			slog.Error("Unable to post run summary breakdown", "error", err)
+			return
+		}
+	}
+}
+
+// runSummaryText is the one line digest of a run posted to Slack.
+func runSummaryText(runID string, results []run.Result) string {
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	parts := []string{}
+	for _, status := range summaryStatuses {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+
+	return fmt.Sprintf("Migration run %s finished: %s", runID, strings.Join(parts, ", "))
+}
+
+// uploadRunReport uploads the run report to the channel as a CSV or JSON
+// file, with the run's digest as the message it is shared with.
+func uploadRunReport(api *slack.Client, channelId string, runID string, results []run.Result, format string) error {
+
+	var buf bytes.Buffer
+	if err := encodeRunReport(results, &buf, format == "json"); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("imp-run-%s.%s", runID, format)
+	_, err := api.UploadFileV2(slack.UploadFileV2Parameters{
+		Reader:         &buf,
+		FileSize:       buf.Len(),
+		Filename:       name,
+		Title:          fmt.Sprintf("Migration run %s", runID),
+		InitialComment: runSummaryText(runID, results),
+		Channel:        channelId,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to upload %s to slack channel %s: %w", name, channelId, err)
+	}
+	slog.Info("Uploaded run report", "channel", channelId, "file", name)
+
+	return nil
+}
+
+// runReportFormat returns the format the report is uploaded in:
+// slack.reportFormat, else that of --report-out, else csv.
+func runReportFormat(reportFile string) (string, error) {
+
+	format := strings.ToLower(viper.GetString("slack.reportFormat"))
+	if format == "" && strings.EqualFold(filepath.Ext(reportFile), ".json") {
+		format = "json"
+	}
+
+	switch format {
+	case "", "csv":
+		return "csv", nil
+	case "json":
+		return "json", nil
+	}
+
+	return "", fmt.Errorf("unknown slack.reportFormat %q, expected csv or json", format)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/notify"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// teamsNotifier posts an Adaptive Card to a Microsoft Teams incoming webhook.
+type teamsNotifier struct {
+	client *http.Client
+	tmpl   *template.Template
+}
+
+// newTeamsNotifier creates the Teams notifier. Messages use teams.template
+// when set and the Slack message otherwise.
+func newTeamsNotifier() (*teamsNotifier, error) {
+
+	t := &teamsNotifier{
+		client: &http.Client{Transport: newRetryTransport(newMetricsTransport("teams", nil))},
+	}
+
+	if file := viper.GetString("teams.template"); file != "" {
+		tmpl, err := loadTemplate("teamsTemplate", file, "")
+		if err != nil {
+			return nil, err
+		}
+		t.tmpl = tmpl
+	}
+
+	return t, nil
+}
+
+// teamsWebhookFor returns the webhook a service's notification is posted to:
+// the teams.webhooks entry for its team, or teams.defaultWebhook.
+func teamsWebhookFor(service catalog.Service) string {
+
+	if webhook, ok := viper.GetStringMapString("teams.webhooks")[strings.ToLower(service.Team.TeamId)]; ok && webhook != "" {
+		return webhook
+	}
+
+	return viper.GetString("teams.defaultWebhook")
+}
+
+func (t *teamsNotifier) Notify(n notify.Notification) (string, error) {
+
+	webhook := teamsWebhookFor(n.Service)
+	if webhook == "" {
+		return "", fmt.Errorf("no teams webhook for team %q: set teams.webhooks or teams.defaultWebhook", n.Service.Team.TeamId)
+	}
+
+	text := n.Text
+	if t.tmpl != nil {
+		rendered, err := renderTemplate(t.tmpl, n.Data)
+		if err != nil {
+			return "", err
+		}
+		text = rendered
+	}
+
+	payload, err := json.Marshal(teamsCard(text, issueURLFromData(n.Data)))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := t.client.Post(webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("unable to post to teams: %w", redactWebhookError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("teams returned %s: %s", resp.Status, string(body))
+	}
+
+	//Webhooks do not return a message id
+	return "teams:" + time.Now().UTC().Format(time.RFC3339), nil
+}
+
+// teamsCard wraps the message in an Adaptive Card with a button linking to
+// the ticket.
+func teamsCard(text string, ticketURL string) map[string]interface{} {
+
+	card := map[string]interface{}{
+		"type":    "AdaptiveCard",
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true},
+		},
+	}
+
+	if ticketURL != "" {
+		card["actions"] = []interface{}{
+			map[string]interface{}{"type": "Action.OpenUrl", "title": "Open ticket", "url": ticketURL},
+		}
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content":     card,
+			},
+		},
+	}
+}
+
+// issueURLFromData returns the jira_url template variable, if set.
+func issueURLFromData(data map[string]interface{}) string {
+
+	url, _ := data["jira_url"].(string)
+	return url
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// defaultSummaryTemplate is used when no summary template is configured.
+const defaultSummaryTemplate = "Migration: {{.service}}"
+
+// defaultSlackTemplate is the notification used when no Slack template is
+// given with --stemp or slack.messageTemplate.
+const defaultSlackTemplate = `Hi {{.team}}, a migration ticket has been created for {{.service}}: {{.jira_url}}
+Repository: {{.repository}}`
+
+// templateFuncs are available to every template.
+var templateFuncs = template.FuncMap{
+	"json": toJSON,
+}
+
+// loadTemplate parses the template in fileName, or the fallback text when no
+// file is given.
+func loadTemplate(name string, fileName string, fallback string) (*template.Template, error) {
+
+	content := fallback
+	if fileName != "" {
+		var err error
+		content, err = getTemplate(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return template.New(name).Funcs(templateFuncs).Parse(content)
+}
+
+// templateData builds the variables available to the jira and slack
+// templates. The short keys are kept for existing templates; catalog exposes
+// the full Service, columns the rest of the repository file row and fields
+// the same columns by header name. Named columns are also available directly,
+// e.g. .deadline, unless they clash with a built-in variable. Headers that
+// aren't valid template names are also given as one, so Go Live is .go_live.
+func templateData(row run.Row, service catalog.Service) map[string]interface{} {
+
+	data := make(map[string]interface{})
+	for name, value := range row.Fields {
+		data[name] = value
+	}
+	for name, value := range row.Fields {
+		if key := templateKey(name); key != "" {
+			if _, ok := data[key]; !ok {
+				data[key] = value
+			}
+		}
+	}
+
+	data["repository"] = row.Repository
+	data["service"] = service.ServiceId
+	data["team"] = service.Team.TeamId
+	data["catalog"] = service
+	data["lead"] = service.Team.Lead
+	data["members"] = teamMembers(service.Team)
+	data["columns"] = row.Columns
+	data["fields"] = row.Fields
+	data["campaign"] = campaignName
+	data["mentions"] = ""
+	data["usergroup"] = ""
+	data["jira_ticket"] = ""
+	data["jira_url"] = ""
+	data["jira_parent"] = ""
+	data["message"] = ""
+
+	return data
+}
+
+// templateKey turns a column header into a name templates can use: lower
+// case, with every run of other characters than letters and digits made an
+// underscore.
+func templateKey(header string) string {
+
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(header)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteRune('_')
+			}
+			underscore = false
+			b.WriteRune(r)
+			continue
+		}
+		underscore = true
+	}
+
+	key := b.String()
+	if key != "" && unicode.IsDigit(rune(key[0])) {
+		key = "_" + key
+	}
+
+	return key
+}
+
+// teamMembers returns the users in a team, for templates to range over.
+func teamMembers(team catalog.Team) []catalog.User {
+
+	members := []catalog.User{}
+	for _, member := range team.TeamMembers {
+		members = append(members, member.User)
+	}
+
+	return members
+}
+
+func renderTemplate(tmpl *template.Template, data map[string]interface{}) (string, error) {
+
+	buf := bytes.NewBufferString("")
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// templateUses reports whether the template refers to the named variable.
+func templateUses(tmpl *template.Template, name string) bool {
+	return tmpl.Tree != nil && strings.Contains(tmpl.Tree.Root.String(), "."+name)
+}
+
+func firstNonEmpty(values ...string) string {
+
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
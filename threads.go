@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"imp/pkg/run"
+	"log/slog"
+	"sync"
+)
+
+// defaultThreadParentText starts the thread of a channel's notifications
+// when slack.threadParentText is not set.
+const defaultThreadParentText = "New migration tickets for services in this channel: %d repositories, one reply each in this thread."
+
+// slackThreads groups a run's notifications into one thread per channel for
+// channels that get several of them, so a busy team channel sees a single
+// message instead of a burst.
+type slackThreads struct {
+	counts map[string]int
+	min    int
+
+	mu      sync.Mutex
+	parents map[string]string
+}
+
+// newSlackThreads counts the notifications each channel will get in a run.
+func newSlackThreads(rows []run.Row, repoLookup catalog.Lookup) *slackThreads {
+
+	counts := map[string]int{}
+	for _, row := range rows {
+		if service, ok := repoLookup.Find(row.Repository); ok {
+			counts[slackChannelFor(service)]++
+		}
+	}
+
+	return &slackThreads{
+		counts:  counts,
+		min:     max(viper.GetInt("slack.threadMinMessages"), 2),
+		parents: make(map[string]string),
+	}
+}
+
+// parent returns the timestamp of the channel's thread, posting the parent
+// message first when needed. It returns an empty string for channels that
+// get too few notifications to be grouped.
+func (t *slackThreads) parent(api *slack.Client, limit *rateLimiter, channel string) (string, error) {
+
+	if t.counts[channel] < t.min {
+		return "", nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ts, ok := t.parents[channel]; ok {
+		return ts, nil
+	}
+
+	text := viper.GetString("slack.threadParentText")
+	if text == "" {
+		text = fmt.Sprintf(defaultThreadParentText, t.counts[channel])
+	}
+
+	limit.Wait()
+	ts, err := sendSlackNotification(api, channel, text, nil)
+	if err != nil {
+		return "", err
+	}
+	slog.Debug("Started Slack thread", "channel", channel, "ts", ts)
+
+	t.parents[channel] = ts
+
+	return ts, nil
+}
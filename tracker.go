@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/spf13/viper"
+	"imp/pkg/tracker"
+	"strings"
+)
+
+// trackerKind returns the configured tracker, jira unless set otherwise.
+func trackerKind() string {
+
+	return strings.ToLower(firstNonEmpty(viper.GetString("tracker"), "jira"))
+}
+
+// newTracker creates the client for the configured tracker.
+func newTracker() (tracker.Tracker, error) {
+
+	return tracker.New(trackerKind())
+}
+
+// issueURL returns the browse URL of a ticket in the configured tracker, or
+// an empty string when there is no ticket.
+func issueURL(key string) string {
+
+	if key == "" {
+		return ""
+	}
+
+	switch trackerKind() {
+	case "github":
+		return githubIssueURL(key)
+	case "gitlab":
+		return gitlabIssueURL(key)
+	}
+
+	return jiraIssueURL(key)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpAPIs are the clients whose transport can be configured, each with its
+// own <api>.http section on top of the shared http section.
+var httpAPIs = []string{"jira", "slack", "bigbrother", "backstage", "opslevel", "github", "gitlab", "teams", "webhook", "vault", "aws", "google"}
+
+var (
+	transportsMu sync.Mutex
+	transports   = map[string]http.RoundTripper{}
+)
+
+// httpSetting returns <api>.http.<key>, or http.<key> when the API doesn't
+// set it.
+func httpSetting(api string, key string) string {
+
+	return firstNonEmpty(viper.GetString(api+".http."+key), viper.GetString("http."+key))
+}
+
+// httpTransport returns the transport for an API's client, built once from
+// its proxy and TLS settings. The settings are checked by validateHTTPConfig
+// at startup.
+func httpTransport(api string) http.RoundTripper {
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if transport, ok := transports[api]; ok {
+		return transport
+	}
+
+	transport, err := newHTTPTransport(api)
+	if err != nil {
+		slog.Error("Invalid http config, using the default transport", "api", api, "error", err)
+		return http.DefaultTransport
+	}
+
+	//Each attempt gets the timeout, retries are made above this transport
+	var wrapped http.RoundTripper = &boundedTransport{base: transport, timeout: cast.ToDuration(httpSetting(api, "timeout"))}
+	if auditedAPIs[api] {
+		wrapped = &auditTransport{api: api, base: wrapped}
+	}
+	transports[api] = wrapped
+
+	return wrapped
+}
+
+// boundedTransport bounds a request, including reading its response body,
+// by the timeout, so a proxy that stops answering can't stall a run, and by
+// abortCtx, so a second Ctrl-C doesn't wait for it.
+type boundedTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *boundedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(req.Context(), t.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(req.Context())
+	}
+	stopAbort := context.AfterFunc(abortCtx, cancel)
+	release := func() {
+		stopAbort()
+		cancel()
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: release}
+
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// newHTTPTransport clones the default transport, which honours the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, and applies the
+// timeout, connection pool, proxy, noProxy, caFile and insecureSkipVerify
+// settings.
+func newHTTPTransport(api string) (*http.Transport, error) {
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	durations := map[string]time.Duration{}
+	for _, key := range []string{"connectTimeout", "keepAlive", "tlsHandshakeTimeout", "responseHeaderTimeout", "idleConnTimeout", "timeout"} {
+		d, err := cast.ToDurationE(httpSetting(api, key))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid http.%s %q for %s", key, httpSetting(api, key), api)
+		}
+		durations[key] = d
+	}
+	ints := map[string]int{}
+	for _, key := range []string{"maxIdleConns", "maxIdleConnsPerHost", "maxConnsPerHost"} {
+		n, err := cast.ToIntE(httpSetting(api, key))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid http.%s %q for %s", key, httpSetting(api, key), api)
+		}
+		ints[key] = n
+	}
+
+	dialer := &net.Dialer{Timeout: durations["connectTimeout"], KeepAlive: durations["keepAlive"]}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = durations["tlsHandshakeTimeout"]
+	transport.ResponseHeaderTimeout = durations["responseHeaderTimeout"]
+	transport.IdleConnTimeout = durations["idleConnTimeout"]
+	transport.MaxIdleConns = ints["maxIdleConns"]
+	transport.MaxIdleConnsPerHost = ints["maxIdleConnsPerHost"]
+	transport.MaxConnsPerHost = ints["maxConnsPerHost"]
+
+	if proxy := httpSetting(api, "proxy"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid %s proxy %q", api, proxy)
+		}
+		noProxy := splitNoProxy(httpSetting(api, "noProxy"))
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname(), noProxy) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	caFile := httpSetting(api, "caFile")
+	insecure := viper.GetBool(api+".http.insecureSkipVerify") || viper.GetBool("http.insecureSkipVerify")
+	if caFile == "" && !insecure {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s ca bundle: %w", api, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	tlsConfig.InsecureSkipVerify = insecure
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// validateHTTPConfig builds every API's transport so a bad proxy or CA
+// bundle fails at startup.
+func validateHTTPConfig() error {
+
+	insecure := []string{}
+	for _, api := range httpAPIs {
+		transport, err := newHTTPTransport(api)
+		if err != nil {
+			return err
+		}
+		if transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify {
+			insecure = append(insecure, api)
+		}
+	}
+
+	if len(insecure) > 0 {
+		slog.Warn("TLS certificate verification is disabled", "apis", insecure)
+	}
+
+	return nil
+}
+
+// splitNoProxy splits a comma separated NO_PROXY style list.
+func splitNoProxy(list string) []string {
+
+	entries := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// bypassProxy reports whether host matches a noProxy entry: * for every
+// host, an IP address or CIDR range, or a domain that also matches its
+// subdomains, with or without a leading dot or *.
+func bypassProxy(host string, noProxy []string) bool {
+
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+		if ip != nil {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			if entryIP := net.ParseIP(entry); entryIP != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+
+		//Ports are not considered
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		domain := strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestBypassProxy(t *testing.T) {
+
+	tests := []struct {
+		host    string
+		noProxy string
+		want    bool
+	}{
+		{"example.com", "", false},
+		{"example.com", "*", true},
+		{"example.com", "example.com", true},
+		{"api.example.com", "example.com", true},
+		{"api.example.com", ".example.com", true},
+		{"api.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", true},
+		{"notexample.com", "example.com", false},
+		{"API.Example.COM", "EXAMPLE.com", true},
+		{"example.com", "other.org, example.com:8080", true},
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"192.168.1.1", "10.0.0.0/8", false},
+		{"192.168.1.1", "192.168.1.1", true},
+		{"192.168.1.1", "example.com", false},
+		{"::1", "::1", true},
+	}
+
+	for _, test := range tests {
+		if got := bypassProxy(test.host, splitNoProxy(test.noProxy)); got != test.want {
+			t.Errorf("bypassProxy(%q, %q) = %v, want %v", test.host, test.noProxy, got, test.want)
+		}
+	}
+}
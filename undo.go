@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+var undoFlags struct {
+	runID      string
+	action     string
+	transition string
+	retract    bool
+	dryRun     bool
+	yes        bool
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Args:  cobra.NoArgs,
+	Short: "Cancel or delete every ticket created by a run",
+	RunE:  runUndo,
+}
+
+func init() {
+
+	flags := undoCmd.Flags()
+	flags.StringVar(&undoFlags.runID, "run", "", "ID of the run to undo, as shown in its summary")
+	flags.StringVar(&undoFlags.action, "action", "cancel", "cancel: transition the tickets, delete: delete them")
+	flags.StringVar(&undoFlags.transition, "transition", "", "transition or status used to cancel tickets, defaults to jira.cancelTransition or Cancelled")
+	flags.BoolVar(&undoFlags.retract, "retract", false, "reply to each Slack notification that the ticket was withdrawn")
+	flags.BoolVar(&undoFlags.dryRun, "dry-run", false, "list the tickets without changing anything")
+	flags.BoolVarP(&undoFlags.yes, "yes", "y", false, "undo without asking for confirmation")
+
+	undoCmd.MarkFlagRequired("run")
+
+	rootCmd.AddCommand(undoCmd)
+}
+
+func runUndo(cmd *cobra.Command, args []string) error {
+
+	if undoFlags.action != "cancel" && undoFlags.action != "delete" {
+		return fmt.Errorf("unknown --action %q, expected cancel or delete", undoFlags.action)
+	}
+	if undoFlags.action == "delete" && trackerKind() != "jira" {
+		return fmt.Errorf("--action delete is only supported by the jira tracker")
+	}
+
+	tr, err := newTracker()
+	if err != nil {
+		return err
+	}
+
+	//Deleting goes around the tracker interface, which has no delete
+	var jiraClient *jira.Client
+	if undoFlags.action == "delete" {
+		jiraClient, err = newJiraClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := openRunLedger()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	entries, err := l.Run(undoFlags.runID)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Printf("Run %s has no tickets left to undo\n", undoFlags.runID)
+		return nil
+	}
+
+	transition := firstNonEmpty(undoFlags.transition, viper.GetString("jira.cancelTransition"), "Cancelled")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKET\tREPOSITORY\tSERVICE")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.JiraKey, entry.Repository, entry.Service)
+	}
+	w.Flush()
+
+	verb, done := "Cancel", "cancelled"
+	if undoFlags.action == "delete" {
+		verb, done = "Delete", "deleted"
+	}
+
+	if undoFlags.dryRun {
+		fmt.Printf("%d tickets would be %s\n", len(entries), done)
+		return nil
+	}
+
+	if !undoFlags.yes {
+		ok, err := confirm(fmt.Sprintf("%s these %d tickets?", verb, len(entries)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	var api *slack.Client
+	if undoFlags.retract {
+		api = newSlackClient()
+	}
+
+	limit := newRateLimiter(viper.GetFloat64("jira.requestsPerSecond"))
+	defer limit.Stop()
+
+	//Ctrl-C from here on stops after the ticket in flight
+	ctx, stop := interruptible(cmd.Context())
+	defer stop()
+
+	attempted, failed := 0, 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		attempted++
+
+		limit.Wait()
+
+		if undoFlags.action == "delete" {
+			_, err = jiraClient.Issue.Delete(entry.JiraKey)
+		} else {
+			err = tr.Transition(entry.JiraKey, transition)
+		}
+		if err != nil {
+			slog.Error("Unable to undo ticket", "ticket", entry.JiraKey, "repository", entry.Repository, "error", err)
+			failed++
+			continue
+		}
+		slog.Info("Undid ticket", "action", undoFlags.action, "ticket", entry.JiraKey, "repository", entry.Repository)
+
+		if err := l.Remove(entry); err != nil {
+			return err
+		}
+
+		if api != nil {
+			if err := retractNotification(api, entry, done); err != nil {
+				slog.Warn("Unable to retract Slack notification", "ticket", entry.JiraKey, "channel", entry.SlackChannel, "error", err)
+			}
+		}
+	}
+
+	fmt.Printf("%d of %d tickets %s\n", attempted-failed, len(entries), done)
+
+	if ctx.Err() != nil {
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted with %d of %d tickets not attempted", len(entries)-attempted, len(entries)))
+	}
+
+	if failed > 0 {
+		return withExitCode(exitPartial, fmt.Errorf("%d tickets could not be %s", failed, done))
+	}
+
+	return nil
+}
+
+// retractNotification replies in the thread of a ticket's Slack notification
+// that the ticket was withdrawn. Notifications sent elsewhere are left alone.
+func retractNotification(api *slack.Client, entry LedgerEntry, done string) error {
+
+	if entry.SlackChannel == "" || !isSlackTs(entry.SlackTs) {
+		return nil
+	}
+
+	text := fmt.Sprintf("Please disregard this message: %s was created by mistake and has been %s.", entry.JiraKey, done)
+	_, _, err := api.PostMessage(entry.SlackChannel, slack.MsgOptionText(text, false), slack.MsgOptionTS(entry.SlackTs))
+
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// usergroupIDPattern matches Slack usergroup IDs, which are used as-is;
+// anything else is treated as a usergroup handle.
+var usergroupIDPattern = regexp.MustCompile(`^S[A-Z0-9]{6,}$`)
+
+// slackUsergroups maps teams to the Slack usergroup that owns them, from the
+// slack.usergroups config (team ID to usergroup ID or handle) or the team's
+// slackUsergroup catalog field. Handles are resolved with one usergroups.list
+// call on first use.
+type slackUsergroups struct {
+	api *slack.Client
+
+	once    sync.Once
+	handles map[string]string
+	err     error
+
+	mu     sync.Mutex
+	warned map[string]bool
+}
+
+func newSlackUsergroups(api *slack.Client) *slackUsergroups {
+	return &slackUsergroups{
+		api:    api,
+		warned: make(map[string]bool),
+	}
+}
+
+// usergroupFor returns the usergroup configured for a team, if any. The
+// config takes precedence over the catalog.
+func usergroupFor(team catalog.Team) string {
+
+	if group, ok := viper.GetStringMapString("slack.usergroups")[strings.ToLower(team.TeamId)]; ok && group != "" {
+		return group
+	}
+
+	return team.SlackUsergroup
+}
+
+// Mention returns the <!subteam^ID> mention of the team's usergroup, or an
+// empty string when the team has none or it can't be resolved.
+func (g *slackUsergroups) Mention(team catalog.Team, wait func()) string {
+
+	group := strings.TrimSpace(usergroupFor(team))
+	if group == "" {
+		return ""
+	}
+
+	id, err := g.Resolve(group, wait)
+	if err != nil {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if !g.warned[group] {
+			g.warned[group] = true
+			slog.Warn("Unable to mention Slack usergroup", "team", team.TeamId, "usergroup", group, "error", err)
+		}
+		return ""
+	}
+
+	return fmt.Sprintf("<!subteam^%s>", id)
+}
+
+// Resolve returns the ID of a usergroup given its ID or handle, with or
+// without the leading @.
+func (g *slackUsergroups) Resolve(group string, wait func()) (string, error) {
+
+	if usergroupIDPattern.MatchString(group) {
+		return group, nil
+	}
+
+	g.once.Do(func() {
+		wait()
+		g.handles, g.err = g.list()
+	})
+	if g.err != nil {
+		return "", g.err
+	}
+
+	id, ok := g.handles[strings.ToLower(strings.TrimPrefix(group, "@"))]
+	if !ok {
+		return "", fmt.Errorf("no usergroup with handle %s", group)
+	}
+
+	return id, nil
+}
+
+// list returns the workspace's usergroup IDs by handle.
+func (g *slackUsergroups) list() (map[string]string, error) {
+
+	groups, err := g.api.GetUserGroups()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list slack usergroups: %w", err)
+	}
+
+	handles := map[string]string{}
+	for _, group := range groups {
+		handles[strings.ToLower(group.Handle)] = group.ID
+	}
+	slog.Debug("Listed Slack usergroups", "usergroups", len(handles))
+
+	return handles, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"github.com/andygrunwald/go-jira"
+	"github.com/slack-go/slack"
+	"github.com/spf13/viper"
+	"imp/pkg/catalog"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// teamAssigneeEmail returns the email of the team member a ticket is assigned
+// to, according to jira.assignee:
+//
+//	first  the first member of the team
+//	lead   the team lead, or the first member when the team has no lead
+//
+// Any other value, including the default empty string, leaves tickets
+// unassigned.
+func teamAssigneeEmail(service catalog.Service) string {
+
+	first := ""
+	if len(service.Team.TeamMembers) > 0 {
+		first = service.Team.TeamMembers[0].User.Email
+	}
+
+	switch viper.GetString("jira.assignee") {
+	case "first":
+		return first
+	case "lead":
+		return firstNonEmpty(service.Team.Lead.Email, first)
+	}
+
+	return ""
+}
+
+// reporterFor returns the user to set as reporter according to jira.reporter:
+// lead for the team lead, an email address, or an account ID (username on
+// Data Center) used as-is. It returns nil when jira.reporter is not set, which
+// leaves the token owner as reporter.
+func (u *jiraUsers) reporterFor(service catalog.Service) (*jira.User, error) {
+
+	reporter := strings.TrimSpace(viper.GetString("jira.reporter"))
+
+	switch {
+	case reporter == "":
+		return nil, nil
+	case strings.EqualFold(reporter, "lead"):
+		if service.Team.Lead.Email == "" {
+			return nil, fmt.Errorf("team %s has no lead", service.Team.TeamId)
+		}
+		return u.Resolve(service.Team.Lead.Email)
+	case strings.Contains(reporter, "@"):
+		return u.Resolve(reporter)
+	default:
+		return jiraUserRef(jira.User{AccountID: reporter, Name: reporter}), nil
+	}
+}
+
+// teamEmails returns the email addresses of the team lead and members,
+// without duplicates.
+func teamEmails(team catalog.Team) []string {
+
+	emails := []string{}
+	seen := map[string]bool{}
+
+	add := func(email string) {
+		key := strings.ToLower(strings.TrimSpace(email))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			emails = append(emails, email)
+		}
+	}
+
+	add(team.Lead.Email)
+	for _, member := range team.TeamMembers {
+		add(member.User.Email)
+	}
+
+	return emails
+}
+
+// jiraUsers resolves email addresses to Jira users. Addresses listed in the
+// jira.users map (email to account ID or username) are used as-is, anything
+// else is looked up through the user search API. Results are cached for the
+// lifetime of the run.
+type jiraUsers struct {
+	client *jira.Client
+	mu     sync.Mutex
+	cache  map[string]*jira.User
+}
+
+func newJiraUsers(client *jira.Client) *jiraUsers {
+	return &jiraUsers{
+		client: client,
+		cache:  make(map[string]*jira.User),
+	}
+}
+
+func (u *jiraUsers) Resolve(email string) (*jira.User, error) {
+
+	key := strings.ToLower(email)
+
+	u.mu.Lock()
+	user, ok := u.cache[key]
+	u.mu.Unlock()
+	if ok {
+		return user, nil
+	}
+
+	user, err := u.lookup(email)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	u.cache[key] = user
+	u.mu.Unlock()
+
+	return user, nil
+}
+
+func (u *jiraUsers) lookup(email string) (*jira.User, error) {
+
+	//Explicit mappings win over the search API
+	mapped := viper.GetStringMapString("jira.users")
+	if id, ok := mapped[strings.ToLower(email)]; ok {
+		return jiraUserRef(jira.User{AccountID: id, Name: id}), nil
+	}
+
+	//Cloud matches on query, Data Center on username
+	escaped := url.QueryEscape(email)
+	found, _, err := u.client.User.Find(escaped, jira.WithUsername(escaped))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, itm := range found {
+		if strings.EqualFold(itm.EmailAddress, email) || len(found) == 1 {
+			return jiraUserRef(itm), nil
+		}
+	}
+
+	return nil, fmt.Errorf("no Jira user found for %s", email)
+}
+
+// jiraUserRef reduces a user to the identifier Jira expects when setting a
+// user field: the account ID on Cloud, the username on Data Center.
+func jiraUserRef(user jira.User) *jira.User {
+
+	if viper.GetString("jira.deployment") == "server" {
+		return &jira.User{Name: firstNonEmpty(user.Name, user.AccountID)}
+	}
+
+	return &jira.User{AccountID: firstNonEmpty(user.AccountID, user.Name)}
+}
+
+// slackUsers resolves email addresses to Slack user IDs, caching results for
+// the lifetime of the run.
+type slackUsers struct {
+	api   *slack.Client
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+func newSlackUsers(api *slack.Client) *slackUsers {
+	return &slackUsers{
+		api:   api,
+		cache: make(map[string]string),
+	}
+}
+
+func (u *slackUsers) Resolve(email string) (string, error) {
+
+	key := strings.ToLower(email)
+
+	u.mu.Lock()
+	id, ok := u.cache[key]
+	u.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	user, err := u.api.GetUserByEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("no Slack user found for %s: %w", email, err)
+	}
+
+	u.mu.Lock()
+	u.cache[key] = user.ID
+	u.mu.Unlock()
+
+	return user.ID, nil
+}
+
+// Mentions returns a <@ID> mention for every team member that could be
+// resolved. Members that cannot be resolved are logged and left out.
+func (u *slackUsers) Mentions(team catalog.Team, wait func()) string {
+
+	mentions := []string{}
+
+	for _, member := range team.TeamMembers {
+		if member.User.Email == "" {
+			continue
+		}
+
+		wait()
+		id, err := u.Resolve(member.User.Email)
+		if err != nil {
+			slog.Warn("Unable to mention team member", "email", member.User.Email, "error", err)
+			continue
+		}
+
+		mentions = append(mentions, fmt.Sprintf("<@%s>", id))
+	}
+
+	return strings.Join(mentions, " ")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var validateFlags struct {
+	repoFile          string
+	jiraTemplateFile  string
+	slackTemplateFile string
+	offline           bool
+	subtasks          bool
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [file|-]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Check the repository file, templates and Jira projects without creating anything",
+	RunE:  runValidate,
+}
+
+func init() {
+
+	flags := validateCmd.Flags()
+	flags.StringVarP(&validateFlags.repoFile, "file", "f", "", "list of repositories, - for stdin")
+	addInputFlags(flags)
+	flags.StringVar(&validateFlags.jiraTemplateFile, "jtemp", "", "jira ticket template")
+	flags.StringVar(&validateFlags.slackTemplateFile, "stemp", "", "slack message template")
+	flags.BoolVar(&validateFlags.offline, "offline", false, "skip the checks against the Jira projects")
+	flags.BoolVar(&validateFlags.subtasks, "subtasks", false, "check the parent and subtask issue types, defaults to jira.subtasks")
+
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+
+	//Templates are optional here, but must parse when given
+	templates := map[string]string{
+		"summary":     viper.GetString("jira.summaryTemplate"),
+		"description": viper.GetString("jira.descriptionTemplate"),
+		"slack":       firstNonEmpty(validateFlags.slackTemplateFile, viper.GetString("slack.messageTemplate")),
+		"blocks":      viper.GetString("slack.blocksTemplate"),
+	}
+	if validateFlags.jiraTemplateFile != "" {
+		templates["description"] = validateFlags.jiraTemplateFile
+	}
+
+	for name, fileName := range templates {
+		if fileName == "" {
+			continue
+		}
+		if _, err := loadTemplate(name, fileName, ""); err != nil {
+			return fmt.Errorf("invalid %s template: %w", name, err)
+		}
+	}
+
+	if err := validateCustomFields(); err != nil {
+		return err
+	}
+
+	repoLookup, err := loadRepoLookup(catalogFile)
+	if err != nil {
+		return err
+	}
+	repoFile, err := repositoryFileArg(validateFlags.repoFile, args)
+	if err != nil {
+		return err
+	}
+
+	repositoryList, err := readRepositoryFile(repoFile)
+	if err != nil {
+		return err
+	}
+
+	opts := preflightOptions{
+		labels:   issueLabels(nil),
+		subtasks: validateFlags.subtasks || viper.GetBool("jira.subtasks"),
+	}
+	repositoryList = dedupeRows(repositoryList, repoLookup, !opts.subtasks && !inputFlags.all)
+
+	unmatched := []string{}
+	for _, itm := range repositoryList {
+		if _, ok := repoLookup.Find(itm.Repository); !ok {
+			unmatched = append(unmatched, itm.Repository)
+		}
+	}
+
+	fmt.Printf("%d of %d repositories matched a service\n", len(repositoryList)-len(unmatched), len(repositoryList))
+	reportUnmatched(unmatched, repoLookup, "")
+
+	if len(unmatched) > 0 {
+		return fmt.Errorf("%d repositories could not be matched", len(unmatched))
+	}
+
+	if validateFlags.offline || trackerKind() != "jira" {
+		return nil
+	}
+
+	tr, err := newTracker()
+	if err != nil {
+		return err
+	}
+
+	if err := preflightCreate(tr.(*jiraTracker), repositoryList, repoLookup, opts); err != nil {
+		return err
+	}
+
+	fmt.Println("Jira projects, issue types and fields look good")
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultPrefix marks a secret read from HashiCorp Vault, as
+// vault:<path>#<key>, e.g. vault:secret/data/imp#jira_token.
+const vaultPrefix = "vault:"
+
+// defaultServiceAccountToken is where Kubernetes mounts the pod's service
+// account token, used to log in with the Vault kubernetes auth method.
+const defaultServiceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultClient reads secrets over the Vault HTTP API.
+type vaultClient struct {
+	client    *http.Client
+	address   string
+	namespace string
+	token     string
+
+	//Secrets are cached per path, several keys often live in one secret
+	secrets map[string]map[string]interface{}
+}
+
+// newVaultClient logs in to Vault at vault.address (or VAULT_ADDR) with the
+// method set by vault.auth: token, the default, uses vault.token, VAULT_TOKEN
+// or ~/.vault-token; kubernetes logs in with the pod's service account as
+// vault.role.
+func newVaultClient() (*vaultClient, error) {
+
+	v := &vaultClient{
+		client:    &http.Client{Transport: newMetricsTransport("vault", nil), Timeout: 30 * time.Second},
+		address:   strings.TrimSuffix(firstNonEmpty(viper.GetString("vault.address"), os.Getenv("VAULT_ADDR")), "/"),
+		namespace: firstNonEmpty(viper.GetString("vault.namespace"), os.Getenv("VAULT_NAMESPACE")),
+		secrets:   make(map[string]map[string]interface{}),
+	}
+	if v.address == "" {
+		return nil, fmt.Errorf("vault secrets need vault.address or VAULT_ADDR")
+	}
+
+	switch auth := firstNonEmpty(viper.GetString("vault.auth"), "token"); auth {
+	case "token":
+		v.token = firstNonEmpty(viper.GetString("vault.token"), os.Getenv("VAULT_TOKEN"), readVaultTokenFile())
+		if v.token == "" {
+			return nil, fmt.Errorf("no vault token: set vault.token or VAULT_TOKEN, or log in with the vault cli")
+		}
+	case "kubernetes":
+		if err := v.kubernetesLogin(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown vault.auth %q, expected token or kubernetes", auth)
+	}
+
+	return v, nil
+}
+
+// readVaultTokenFile returns the token the vault cli stores after a login.
+func readVaultTokenFile() string {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	token, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(token))
+}
+
+// kubernetesLogin exchanges the pod's service account token for a Vault
+// token.
+func (v *vaultClient) kubernetesLogin() error {
+
+	role := viper.GetString("vault.role")
+	if role == "" {
+		return fmt.Errorf("vault kubernetes auth needs vault.role")
+	}
+
+	jwt, err := os.ReadFile(firstNonEmpty(viper.GetString("vault.serviceAccountToken"), defaultServiceAccountToken))
+	if err != nil {
+		return fmt.Errorf("unable to read the service account token: %w", err)
+	}
+
+	mount := firstNonEmpty(viper.GetString("vault.authPath"), "kubernetes")
+	payload, err := json.Marshal(map[string]string{"jwt": strings.TrimSpace(string(jwt)), "role": role})
+	if err != nil {
+		return err
+	}
+
+	var login struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := v.do(http.MethodPost, "auth/"+mount+"/login", payload, &login); err != nil {
+		return fmt.Errorf("unable to log in to vault as %s: %w", role, err)
+	}
+	v.token = login.Auth.ClientToken
+
+	return nil
+}
+
+// Read returns one key of a secret given as path#key. KV version 2 secrets
+// are read through their data/ path, e.g. secret/data/imp#jira_token.
+func (v *vaultClient) Read(reference string) (string, error) {
+
+	path, key, ok := strings.Cut(reference, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid vault reference %q, expected vault:<path>#<key>", vaultPrefix+reference)
+	}
+	path = strings.Trim(path, "/")
+
+	data, ok := v.secrets[path]
+	if !ok {
+		var secret struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := v.do(http.MethodGet, path, nil, &secret); err != nil {
+			return "", fmt.Errorf("unable to read %s from vault: %w", path, err)
+		}
+
+		//KV version 2 nests the secret and its metadata under data
+		data = secret.Data
+		if nested, ok := data["data"].(map[string]interface{}); ok {
+			if _, hasMetadata := data["metadata"]; hasMetadata {
+				data = nested
+			}
+		}
+		v.secrets[path] = data
+	}
+
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no string key %s", path, key)
+	}
+
+	return value, nil
+}
+
+// do sends a request to the Vault API and decodes the JSON response into out.
+func (v *vaultClient) do(method string, path string, body []byte, out interface{}) error {
+
+	req, err := http.NewRequest(method, v.address+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("vault returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"imp/pkg/notify"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// webhookNotifier posts a JSON payload about each ticket to every URL in
+// webhook.urls, for internal automation.
+type webhookNotifier struct {
+	client  *http.Client
+	urls    []string
+	headers map[string]string
+	tmpl    *template.Template
+
+	//delivered holds the URLs each notification already reached, so that
+	//retrying a partly failed notification only posts to the rest
+	mu        sync.Mutex
+	delivered map[string]bool
+}
+
+// webhookPayload is the body sent when no webhook.template is configured.
+type webhookPayload struct {
+	Service    string `json:"service"`
+	Repository string `json:"repository"`
+	Team       string `json:"team"`
+	Ticket     string `json:"ticket"`
+	TicketURL  string `json:"ticketUrl"`
+	Channel    string `json:"channel"`
+}
+
+// newWebhookNotifier creates the webhook notifier from webhook.urls,
+// webhook.headers and the optional webhook.template payload.
+func newWebhookNotifier() (*webhookNotifier, error) {
+
+	w := &webhookNotifier{
+		client:    &http.Client{Transport: newRetryTransport(newMetricsTransport("webhook", nil))},
+		urls:      viper.GetStringSlice("webhook.urls"),
+		headers:   viper.GetStringMapString("webhook.headers"),
+		delivered: map[string]bool{},
+	}
+
+	if len(w.urls) == 0 {
+		return nil, fmt.Errorf("the webhook notifier needs at least one url in webhook.urls")
+	}
+
+	if file := viper.GetString("webhook.template"); file != "" {
+		tmpl, err := loadTemplate("webhookTemplate", file, "")
+		if err != nil {
+			return nil, err
+		}
+		w.tmpl = tmpl
+	}
+
+	return w, nil
+}
+
+func (w *webhookNotifier) Notify(n notify.Notification) (string, error) {
+
+	payload, err := w.payload(n)
+	if err != nil {
+		return "", err
+	}
+
+	//Every URL is tried, however the others fare
+	var errs []error
+	for _, endpoint := range w.urls {
+		key := n.RunID + "\x00" + n.Repository + "\x00" + endpoint
+		w.mu.Lock()
+		delivered := w.delivered[key]
+		w.mu.Unlock()
+		if delivered {
+			continue
+		}
+
+		if err := w.post(endpoint, payload); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		w.mu.Lock()
+		w.delivered[key] = true
+		w.mu.Unlock()
+	}
+
+	if len(errs) > 0 {
+		return "", errors.Join(errs...)
+	}
+
+	return "webhook:" + time.Now().UTC().Format(time.RFC3339), nil
+}
+
+// payload renders webhook.template, which must produce valid JSON, or the
+// default payload.
+func (w *webhookNotifier) payload(n notify.Notification) ([]byte, error) {
+
+	if w.tmpl == nil {
+		ticket, _ := n.Data["jira_ticket"].(string)
+		return json.Marshal(webhookPayload{
+			Service:    n.Service.ServiceId,
+			Repository: n.Repository,
+			Team:       n.Service.Team.TeamId,
+			Ticket:     ticket,
+			TicketURL:  issueURLFromData(n.Data),
+			Channel:    n.Channel,
+		})
+	}
+
+	rendered, err := renderTemplate(w.tmpl, n.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !json.Valid([]byte(rendered)) {
+		return nil, fmt.Errorf("webhook template did not render valid json: %s", rendered)
+	}
+
+	return []byte(rendered), nil
+}
+
+func (w *webhookNotifier) post(endpoint string, payload []byte) error {
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid url in webhook.urls: %w", redactWebhookError(err))
+	}
+	host := req.URL.Host
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s failed: %w", host, redactWebhookError(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook %s returned %s: %s", host, resp.Status, string(body))
+	}
+
+	return nil
+}
+
+// redactWebhookError strips the path and query from the URL an HTTP client
+// error names. Webhook URLs carry their credentials, and errors end up in the
+// log, the ledger and the run result.
+func redactWebhookError(err error) error {
+
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+
+	redacted := urlErr.URL
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+		redacted = u.Scheme + "://" + u.Host + "/***"
+	} else {
+		redacted = "***"
+	}
+
+	return &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"imp/pkg/notify"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWebhookNotifierPartialFailure(t *testing.T) {
+
+	var mu sync.Mutex
+	posts := map[string]int{}
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posts[r.URL.Path]++
+		if r.URL.Path == "/b/secret" && failing {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	w := &webhookNotifier{
+		client:    server.Client(),
+		urls:      []string{server.URL + "/a/secret", server.URL + "/b/secret", server.URL + "/c/secret"},
+		delivered: map[string]bool{},
+	}
+	n := notify.Notification{RunID: "run", Repository: "https://github.com/org/a"}
+
+	_, err := w.Notify(n)
+	if err == nil {
+		t.Fatal("Notify() succeeded, want the error from /b")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("Notify() error %q contains the webhook path", err)
+	}
+	if posts["/a/secret"] != 1 || posts["/b/secret"] != 1 || posts["/c/secret"] != 1 {
+		t.Errorf("posts after the first attempt = %v, want one to every url", posts)
+	}
+
+	//The retry only goes to the url that failed
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	if _, err := w.Notify(n); err != nil {
+		t.Fatal(err)
+	}
+	if posts["/a/secret"] != 1 || posts["/b/secret"] != 2 || posts["/c/secret"] != 1 {
+		t.Errorf("posts after the retry = %v, want a second one to /b only", posts)
+	}
+}
+
+func TestRedactWebhookError(t *testing.T) {
+
+	w := &webhookNotifier{client: &http.Client{}}
+	err := w.post("http://127.0.0.1:1/hooks/T000/B000/secret", []byte("{}"))
+	if err == nil {
+		t.Fatal("post() succeeded, want a connection error")
+	}
+	if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("post() error = %q, want only the host", err)
+	}
+}
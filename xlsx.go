@@ -0,0 +1,334 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxSignature starts every zip file, and so every Excel workbook.
+var xlsxSignature = []byte("PK\x03\x04")
+
+// xlsxMaxPartBytes caps the uncompressed size of a file in the workbook.
+const xlsxMaxPartBytes = 100 << 20
+
+// xlsxWorkbook is the list of sheets in xl/workbook.xml.
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 string `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRelationships maps the relationship IDs of the workbook to the files of
+// its sheets.
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a string, either plain or made of formatted runs.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+
+	var b strings.Builder
+	b.WriteString(t.T)
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+
+	return b.String()
+}
+
+// xlsxSharedStrings holds the text of the cells, which refer to it by index.
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+// xlsxStyles holds the number formats of xl/styles.xml, which cells refer to
+// through the index of their cell format.
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// xlsxSheet holds the cells of a worksheet.
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string    `xml:"r,attr"`
+			Type   string    `xml:"t,attr"`
+			Style  int       `xml:"s,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the rows of a sheet of an Excel workbook as text, the way
+// the CSV reader returns them. The sheet is given by name or, when no sheet
+// has that name, zero-based index, the first sheet when empty. Dates, which
+// Excel stores as numbers, are returned as YYYY-MM-DD. Empty rows are left
+// out.
+func readXLSX(data []byte, sheet string) ([][]string, error) {
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %w", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := readXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := readXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	rid := ""
+	for _, s := range workbook.Sheets {
+		names = append(names, s.Name)
+		if strings.EqualFold(s.Name, sheet) {
+			rid = s.RID
+			break
+		}
+	}
+	//A sheet named 1 wins over the second sheet
+	if index, err := strconv.Atoi(firstNonEmpty(sheet, "0")); rid == "" && err == nil && index >= 0 && index < len(workbook.Sheets) {
+		rid = workbook.Sheets[index].RID
+	}
+	if rid == "" {
+		return nil, fmt.Errorf("sheet %q not found in the workbook, it has %s", sheet, strings.Join(names, ", "))
+	}
+
+	sheetFile := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == rid {
+			//Targets are relative to xl/ unless absolute
+			sheetFile = strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(sheetFile, "xl/") {
+				sheetFile = path.Join("xl", sheetFile)
+			}
+		}
+	}
+
+	//Workbooks without text cells have no shared strings
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := readXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	//Without styles no cell is formatted as a date
+	var styles xlsxStyles
+	if _, ok := files["xl/styles.xml"]; ok {
+		if err := readXLSXPart(files, "xl/styles.xml", &styles); err != nil {
+			return nil, err
+		}
+	}
+	dateStyles := xlsxDateStyles(styles)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if workbook.Properties.Date1904 == "1" || workbook.Properties.Date1904 == "true" {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	var ws xlsxSheet
+	if err := readXLSXPart(files, sheetFile, &ws); err != nil {
+		return nil, err
+	}
+
+	records := [][]string{}
+	for _, row := range ws.Rows {
+		record := []string{}
+		for i, cell := range row.Cells {
+			//Empty cells are left out of the file, the reference says
+			//which column a cell is in
+			column := xlsxColumn(cell.Ref)
+			if column < 0 {
+				column = i
+			}
+			for len(record) < column {
+				record = append(record, "")
+			}
+
+			value := cell.Value
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid shared string in cell %s", cell.Ref)
+				}
+				value = shared.Items[index].String()
+			case "inlineStr":
+				if cell.Inline != nil {
+					value = cell.Inline.String()
+				}
+			case "", "n":
+				if dateStyles[cell.Style] {
+					value = xlsxDate(cell.Value, epoch)
+				}
+			}
+
+			if column < len(record) {
+				record[column] = value
+			} else {
+				record = append(record, value)
+			}
+		}
+
+		if strings.TrimSpace(strings.Join(record, "")) != "" {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// readXLSXPart decodes one XML file of the workbook.
+func readXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid xlsx file: %s is missing", name)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := xml.NewDecoder(io.LimitReader(r, xlsxMaxPartBytes)).Decode(v); err != nil {
+		return fmt.Errorf("invalid xlsx file: %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// xlsxDateStyles returns the indexes of the cell formats that show a date:
+// the built-in date formats and custom formats with a day or year in them.
+func xlsxDateStyles(styles xlsxStyles) map[int]bool {
+
+	dateFormats := make(map[int]bool)
+	for _, id := range []int{14, 15, 16, 17, 22, 27, 28, 29, 30, 31, 34, 35, 36, 50, 51, 52, 53, 54, 57, 58} {
+		dateFormats[id] = true
+	}
+	for _, f := range styles.NumFmts {
+		dateFormats[f.ID] = xlsxDateFormat(f.Code)
+	}
+
+	dates := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if dateFormats[xf.NumFmtID] {
+			dates[i] = true
+		}
+	}
+
+	return dates
+}
+
+// xlsxDateFormat reports whether a custom number format code shows a date,
+// ignoring quoted text, escaped characters and bracketed colors and locales.
+func xlsxDateFormat(code string) bool {
+
+	quoted, bracketed, escaped := false, false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '\\':
+			escaped = true
+		case r == '[':
+			bracketed = true
+		case r == ']':
+			bracketed = false
+		case bracketed:
+		case r == 'd' || r == 'y':
+			return true
+		}
+	}
+
+	return false
+}
+
+// xlsxDate converts the serial number of a date cell, days since epoch, to
+// YYYY-MM-DD, with the time after it when there is one. Values that aren't
+// numbers are returned as they are.
+func xlsxDate(value string, epoch time.Time) string {
+
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 0 {
+		return value
+	}
+
+	//Excel counts 1900-02-29, which didn't exist, so earlier serials are a
+	//day off from the epoch
+	if epoch.Year() == 1899 && serial < 61 {
+		serial++
+	}
+
+	//Rounded to the second, as the fraction of a day rarely is exact
+	total := math.Round(serial * 24 * 60 * 60)
+	days := math.Floor(total / (24 * 60 * 60))
+	seconds := total - days*24*60*60
+	date := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	if seconds == 0 {
+		return date.Format(dateLayout)
+	}
+
+	return date.Format("2006-01-02T15:04:05")
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as C12,
+// or -1 when there is none.
+func xlsxColumn(ref string) int {
+
+	column := 0
+	letters := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 {
+		return -1
+	}
+
+	return column - 1
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testWorkbook builds an xlsx file with a sheet per name, each holding a
+// row with the sheet's name and one with a date formatted cell.
+func testWorkbook(t *testing.T, names []string) []byte {
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, content string) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+
+	sheets, rels := "", ""
+	for i, name := range names {
+		id := string(rune('1' + i))
+		sheets += `<sheet name="` + name + `" sheetId="` + id + `" r:id="rId` + id + `"/>`
+		rels += `<Relationship Id="rId` + id + `" Target="worksheets/sheet` + id + `.xml"/>`
+		write("xl/worksheets/sheet"+id+".xml", `<worksheet><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>`+name+`</t></is></c></row>
+<row r="2"><c r="A2" s="1"><v>45678</v></c><c r="B2" s="2"><v>45678.5</v></c><c r="C2" s="3"><v>45678</v></c><c r="D2"><v>45678</v></c></row>
+</sheetData></worksheet>`)
+	}
+	write("xl/workbook.xml", `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`+sheets+`</sheets></workbook>`)
+	write("xl/_rels/workbook.xml.rels", `<Relationships>`+rels+`</Relationships>`)
+	write("xl/styles.xml", `<styleSheet>
+<numFmts><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd\ hh:mm"/><numFmt numFmtId="165" formatCode="#,##0 &quot;days&quot;"/></numFmts>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/><xf numFmtId="165"/></cellXfs>
+</styleSheet>`)
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadXLSX(t *testing.T) {
+
+	data := testWorkbook(t, []string{"Wave 1", "2", "Wave 3"})
+
+	tests := []struct {
+		sheet string
+		want  string
+	}{
+		{"", "Wave 1"},
+		{"wave 3", "Wave 3"},
+		{"0", "Wave 1"},
+		{"2", "2"},
+		{"1", "2"},
+	}
+
+	for _, test := range tests {
+		records, err := readXLSX(data, test.sheet)
+		if err != nil {
+			t.Fatalf("readXLSX(%q): %v", test.sheet, err)
+		}
+		if records[0][0] != test.want {
+			t.Errorf("readXLSX(%q) read sheet %q, want %q", test.sheet, records[0][0], test.want)
+		}
+	}
+
+	records, err := readXLSX(data, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2025-01-21", "2025-01-21T12:00:00", "45678", "45678"}
+	if !reflect.DeepEqual(records[1], want) {
+		t.Errorf("readXLSX() dates = %q, want %q", records[1], want)
+	}
+
+	if _, err := readXLSX(data, "Wave 4"); err == nil {
+		t.Error("readXLSX() found a sheet that doesn't exist")
+	}
+}
+
+func TestXLSXDate(t *testing.T) {
+
+	epoch1900 := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	epoch1904 := time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		epoch time.Time
+		want  string
+	}{
+		{"1", epoch1900, "1900-01-01"},
+		{"59", epoch1900, "1900-02-28"},
+		{"61", epoch1900, "1900-03-01"},
+		{"45678", epoch1900, "2025-01-21"},
+		{"45678.25", epoch1900, "2025-01-21T06:00:00"},
+		{"45678.99999999", epoch1900, "2025-01-22"},
+		{"0", epoch1904, "1904-01-01"},
+		{"44216", epoch1904, "2025-01-21"},
+		{"n/a", epoch1900, "n/a"},
+	}
+
+	for _, test := range tests {
+		if got := xlsxDate(test.value, test.epoch); got != test.want {
+			t.Errorf("xlsxDate(%q, %d) = %q, want %q", test.value, test.epoch.Year(), got, test.want)
+		}
+	}
+}